@@ -0,0 +1,225 @@
+// log-decrypt streams the plaintext of log files written by log.EncryptedWriter, optionally reformatting
+// records written by the JSONFormatter with another formatter
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+func main() {
+	key := flag.String("key", "", "hex encoded AES key the log was encrypted with")
+	keyFile := flag.String("key-file", "", "file containing the raw AES key")
+	privateKeyFile := flag.String("private-key", "", "PEM file containing the RSA private key for envelope encrypted logs")
+	format := flag.String("format", "", "reformat JSON records with a formatter (default, logfmt, csv, json or raw)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file ...]\n\nreads from stdin if no file is provided\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	newReader, err := readerFactory(*key, *keyFile, *privateKeyFile)
+	if err == nil && *format != "" {
+		_, err = newFormatter(*format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	defer output.Flush()
+	for _, file := range files {
+		if err := decrypt(newReader, file, *format, output); err != nil {
+			output.Flush()
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func readerFactory(key string, keyFile string, privateKeyFile string) (func(io.Reader) *log.DecryptingReader, error) {
+	switch {
+	case key != "":
+		decoded, err := hex.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			return nil, err
+		}
+		return func(reader io.Reader) *log.DecryptingReader { return log.NewDecryptingReader(reader, decoded) }, nil
+	case keyFile != "":
+		decoded, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return func(reader io.Reader) *log.DecryptingReader { return log.NewDecryptingReader(reader, decoded) }, nil
+	case privateKeyFile != "":
+		privateKey, err := readPrivateKey(privateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return func(reader io.Reader) *log.DecryptingReader { return log.NewEnvelopeDecryptingReader(reader, privateKey) }, nil
+	}
+	return nil, fmt.Errorf("one of -key, -key-file or -private-key is required")
+}
+
+func readPrivateKey(file string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded key", file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain an RSA key", file)
+	}
+	return rsaKey, nil
+}
+
+func decrypt(newReader func(io.Reader) *log.DecryptingReader, file string, format string, output io.Writer) error {
+	var input io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+	reader := newReader(input)
+
+	if format == "" {
+		if _, err := io.Copy(output, reader); err != nil {
+			return err
+		}
+	} else {
+		formatter, _ := newFormatter(format)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(nil, 1<<24)
+		for scanner.Scan() {
+			io.WriteString(output, reformat(formatter, scanner.Bytes()))
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	if reader.Skipped() > 0 {
+		fmt.Fprintf(os.Stderr, "%s: skipped %d bytes of corrupted or undecryptable data\n", file, reader.Skipped())
+	}
+	return nil
+}
+
+// timestampedFormatter is a formatter whose clock is set to the time of the record before formatting it
+type timestampedFormatter struct {
+	log.RecordFormatter
+	clock *clock.Mock
+}
+
+func newFormatter(format string) (*timestampedFormatter, error) {
+	mock := clock.NewMock()
+	switch format {
+	case "default":
+		formatter := log.NewDefaultFormatter()
+		formatter.Clock = mock
+		return &timestampedFormatter{formatter, mock}, nil
+	case "logfmt":
+		formatter := log.NewLogfmtFormatter()
+		formatter.Clock = mock
+		return &timestampedFormatter{formatter, mock}, nil
+	case "csv":
+		formatter := log.NewCSVFormatter()
+		formatter.Clock = mock
+		return &timestampedFormatter{formatter, mock}, nil
+	case "json":
+		formatter := log.NewJSONFormatter()
+		formatter.Clock = mock
+		return &timestampedFormatter{formatter, mock}, nil
+	case "raw":
+		return &timestampedFormatter{rawRecordFormatter{log.NewRawFormatter()}, mock}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+type rawRecordFormatter struct {
+	*log.RawFormatter
+}
+
+func (f rawRecordFormatter) FormatRecord(record *log.Record) string {
+	return f.Format(record.Level, record.Message)
+}
+
+// reformat parses a line written by the JSONFormatter and formats it again, lines that are no JSON records are kept as they are
+func reformat(formatter *timestampedFormatter, line []byte) string {
+	entries := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&entries); err != nil {
+		return string(line) + "\n"
+	}
+
+	record := &log.Record{Level: log.InfoLevel}
+	keys := []string{}
+	for key, value := range entries {
+		text, _ := value.(string)
+		switch key {
+		case "time":
+			record.Time, _ = time.Parse(time.RFC3339Nano, text)
+		case "level":
+			for _, level := range []log.Level{log.DebugLevel, log.InfoLevel, log.ErrorLevel} {
+				if level.String() == text {
+					record.Level = level
+				}
+			}
+		case "msg":
+			record.Message = text
+		case "package":
+			record.Package = text
+		case "function":
+			record.Function = text
+		default:
+			keys = append(keys, key)
+		}
+	}
+	if record.Package == "" && record.Function == "" {
+		// an empty caller keeps formatters from looking up the caller of this function
+		record.Caller = &log.Caller{}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		record.Fields = append(record.Fields, log.Field{Key: strings.TrimPrefix(key, "fields."), Value: entries[key]})
+	}
+
+	formatter.clock.Set(record.Time)
+	return formatter.FormatRecord(record)
+}
@@ -0,0 +1,87 @@
+// log-verify checks audit logs written by log.AuditOutput for gaps, reordered and modified records
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+func main() {
+	key := flag.String("key", "", "hex encoded HMAC key the audit log was written with")
+	keyFile := flag.String("key-file", "", "file containing the raw HMAC key")
+	publicKey := flag.String("public-key", "", "hex encoded ed25519 public key checkpoints were signed with")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file ...]\n\nreads from stdin if no file is provided\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	verifier := log.NewAuditVerifier(nil)
+	var err error
+	switch {
+	case *key != "":
+		verifier.Key, err = hex.DecodeString(strings.TrimSpace(*key))
+	case *keyFile != "":
+		verifier.Key, err = ioutil.ReadFile(*keyFile)
+	default:
+		err = fmt.Errorf("either -key or -key-file is required")
+	}
+	if err == nil && *publicKey != "" {
+		verifier.PublicKey, err = hex.DecodeString(strings.TrimSpace(*publicKey))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	valid := true
+	for _, file := range files {
+		ok, err := verify(verifier, file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			os.Exit(2)
+		}
+		valid = valid && ok
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+func verify(verifier *log.AuditVerifier, file string) (bool, error) {
+	var reader io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		reader = f
+	}
+
+	report, err := verifier.Verify(reader)
+	if err != nil {
+		return false, err
+	}
+
+	for _, violation := range report.Violations {
+		fmt.Printf("%s: %s\n", file, violation)
+	}
+	if report.LastCheckpoint < report.LastSequence {
+		fmt.Printf("%s: warning: records after %d are not covered by a checkpoint\n", file, report.LastCheckpoint)
+	}
+	fmt.Printf("%s: %d records, %d checkpoints, %d violations\n", file, report.Records, report.Checkpoints, len(report.Violations))
+	return len(report.Violations) == 0, nil
+}
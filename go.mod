@@ -1,10 +1,11 @@
 module github.com/timbasel/go-log
 
-go 1.17
+go 1.20
 
 require (
 	github.com/acarl005/stripansi v0.0.0-20180116102854-5a71ef0e047d
 	github.com/benbjohnson/clock v0.0.0-20161215174838-7dc76406b6d3
+	github.com/golang/snappy v0.0.4
 	github.com/gookit/color v1.1.7
 	github.com/stretchr/testify v1.3.0
 )
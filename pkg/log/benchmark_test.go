@@ -0,0 +1,100 @@
+package log_test
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+func prepareBenchmarkLogger(formatter log.Formatter) *log.Logger {
+	logger := log.NewLogger()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{ioutil.Discard: formatter})
+	return logger
+}
+
+func benchmarkFormatter(b *testing.B, formatter log.Formatter) {
+	logger := prepareBenchmarkLogger(formatter)
+	fields := []log.Field{{Key: "user", Value: "alice"}, {Key: "attempt", Value: 3}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.WithFields(fields...).Info("this is a benchmark message")
+	}
+}
+
+func BenchmarkDefaultFormatter(b *testing.B) {
+	formatter := log.NewDefaultFormatter()
+	formatter.ColorsDisabled = true
+	benchmarkFormatter(b, formatter)
+}
+
+func BenchmarkRawFormatter(b *testing.B) {
+	benchmarkFormatter(b, log.NewRawFormatter())
+}
+
+func BenchmarkJSONFormatter(b *testing.B) {
+	benchmarkFormatter(b, log.NewJSONFormatter())
+}
+
+func BenchmarkLogfmtFormatter(b *testing.B) {
+	benchmarkFormatter(b, log.NewLogfmtFormatter())
+}
+
+func BenchmarkCSVFormatter(b *testing.B) {
+	benchmarkFormatter(b, log.NewCSVFormatter())
+}
+
+func BenchmarkDebugDisabled(b *testing.B) {
+	logger := prepareBenchmarkLogger(log.NewDefaultFormatter())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Debug("this is a benchmark message")
+	}
+}
+
+func BenchmarkDebugWhitelisted(b *testing.B) {
+	logger := prepareBenchmarkLogger(log.NewRawFormatter())
+	logger.SetDebugMode(true)
+	logger.WhitelistPackages("github.com/timbasel/go-log/pkg/log_test")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Debug("this is a benchmark message")
+	}
+}
+
+func BenchmarkDebugBlacklisted(b *testing.B) {
+	logger := prepareBenchmarkLogger(log.NewRawFormatter())
+	logger.SetDebugMode(true)
+	logger.BlacklistFunctions("BenchmarkDebugBlacklisted")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Debug("this is a benchmark message")
+	}
+}
+
+func TestDebugDisabledAllocations(t *testing.T) {
+	logger := prepareBenchmarkLogger(log.NewDefaultFormatter())
+	allocations := testing.AllocsPerRun(100, func() {
+		logger.Debug("this is a test message")
+		logger.Debugf("this is a %s message", "test")
+	})
+	assert.Equal(t, float64(0), allocations)
+
+	// the caller of filtered debug messages is resolved from the cache
+	logger.SetDebugMode(true)
+	logger.BlacklistPackages("github.com/timbasel/go-log/pkg/log_test")
+	allocations = testing.AllocsPerRun(100, func() {
+		logger.Debug("this is a test message")
+	})
+	assert.Equal(t, float64(0), allocations)
+}
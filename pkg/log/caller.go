@@ -0,0 +1,229 @@
+package log
+
+import (
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const maxCallerDepth = 64
+
+// A Caller describes the location of the function that wrote a record
+type Caller struct {
+	File     string
+	Line     int
+	Package  string
+	Receiver string
+	Function string
+	Module   string
+	Version  string
+}
+
+// ShortPackage returns the last element of the package path
+func (caller Caller) ShortPackage() string {
+	return caller.Package[strings.LastIndex(caller.Package, "/")+1:]
+}
+
+// QualifiedFunction returns the function name prefixed with its receiver, like "(*Logger).Info" or "Level.String"
+func (caller Caller) QualifiedFunction() string {
+	switch {
+	case caller.Receiver == "":
+		return caller.Function
+	case strings.HasPrefix(caller.Receiver, "*"):
+		return "(" + caller.Receiver + ")." + caller.Function
+	default:
+		return caller.Receiver + "." + caller.Function
+	}
+}
+
+// Location returns the base name of the file and the line, like "main.go:12"
+func (caller Caller) Location() string {
+	if caller.File == "" {
+		return ""
+	}
+	return filepath.Base(caller.File) + ":" + strconv.Itoa(caller.Line)
+}
+
+// helperFunctions holds the names of the functions marked by Helper
+var helperFunctions sync.Map
+
+// Helper marks the calling function as a logging helper, so records are attributed to the caller of the helper
+// instead, like testing.T.Helper
+func Helper() {
+	var pcs [1]uintptr
+	if runtime.Callers(2, pcs[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	helperFunctions.Store(frame.Function, struct{}{})
+}
+
+// A callerFrame is the resolved innermost frame of a program counter
+type callerFrame struct {
+	symbol string
+	inLog  bool
+	caller *Caller
+}
+
+var (
+	callerCacheMutex sync.RWMutex
+	callerCache      = map[uintptr]*callerFrame{}
+
+	// unknownCaller is returned if no caller outside of this package could be found
+	unknownCaller = &Caller{}
+)
+
+// findCaller returns the first caller outside of this package that is not a helper, skipping additional callers for
+// wrapper functions. The returned caller is shared between all records written from the same location and must not
+// be modified.
+func findCaller(skip int) *Caller {
+	_, caller := findCallSite(skip)
+	return caller
+}
+
+// findCallSite returns the program counter and the caller found like findCaller, the program counter is 0 if no
+// caller could be found
+func findCallSite(skip int) (uintptr, *Caller) {
+	var pcs [maxCallerDepth]uintptr
+	for _, pc := range pcs[:runtime.Callers(2, pcs[:])] {
+		frame := resolveCallerFrame(pc)
+		if frame.caller == nil || frame.inLog {
+			continue
+		}
+		if _, helper := helperFunctions.Load(frame.symbol); helper {
+			continue
+		}
+		if skip <= 0 {
+			return pc, frame.caller
+		}
+		skip--
+	}
+	return 0, unknownCaller
+}
+
+// resolveCallerFrame resolves the frame of the program counter, which is only done once per program counter
+func resolveCallerFrame(pc uintptr) *callerFrame {
+	callerCacheMutex.RLock()
+	frame, ok := callerCache[pc]
+	callerCacheMutex.RUnlock()
+	if ok {
+		return frame
+	}
+
+	resolved, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	frame = &callerFrame{symbol: resolved.Function}
+	if resolved.Function != "" {
+		packageName, receiver, function := splitFunctionName(resolved.Function)
+		frame.inLog = packageName == logPackage
+		frame.caller = &Caller{File: resolved.File, Line: resolved.Line, Package: packageName, Receiver: receiver, Function: function}
+		frame.caller.Module, frame.caller.Version = moduleVersion(packageName)
+	}
+
+	callerCacheMutex.Lock()
+	callerCache[pc] = frame
+	callerCacheMutex.Unlock()
+	return frame
+}
+
+// splitFunctionName splits the symbol name of a function into package path, receiver and function, where closures
+// keep the name of their enclosing function (like "main.func1") and type arguments of generic functions are removed
+func splitFunctionName(name string) (packageName string, receiver string, function string) {
+	name = stripTypeArguments(name)
+
+	// only the last element of the package path may contain dots, which are escaped in symbol names
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", "", name
+	}
+	packageName, function = name[:slash+1+dot], name[slash+2+dot:]
+	if unescaped, err := url.PathUnescape(packageName); err == nil {
+		packageName = unescaped
+	}
+
+	if strings.HasPrefix(function, "(") {
+		if end := strings.Index(function, ")."); end > 0 {
+			return packageName, function[1:end], function[end+2:]
+		}
+	}
+	if parts := strings.SplitN(function, ".", 3); len(parts) > 1 && !isClosureName(parts[1]) {
+		return packageName, parts[0], strings.Join(parts[1:], ".")
+	}
+	return packageName, "", function
+}
+
+// stripTypeArguments removes the bracketed type arguments of generic functions and types from the symbol name
+func stripTypeArguments(name string) string {
+	if !strings.Contains(name, "[") {
+		return name
+	}
+	builder, depth := &strings.Builder{}, 0
+	for _, r := range name {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// isClosureName reports if the name element belongs to a closure, like "func1", "2" or "gowrap1"
+func isClosureName(name string) bool {
+	for _, prefix := range []string{"func", "gowrap", "deferwrap"} {
+		if strings.HasPrefix(name, prefix) {
+			name = name[len(prefix):]
+			break
+		}
+	}
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	buildInfoOnce  sync.Once
+	moduleVersions map[string]string
+)
+
+// moduleVersion returns the path and version of the module the package belongs to, using the build information
+// embedded in the binary
+func moduleVersion(packageName string) (module string, version string) {
+	buildInfoOnce.Do(func() {
+		moduleVersions = map[string]string{}
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		moduleVersions[info.Main.Path] = info.Main.Version
+		for _, dependency := range info.Deps {
+			moduleVersions[dependency.Path] = dependency.Version
+			if dependency.Replace != nil {
+				moduleVersions[dependency.Path] = dependency.Replace.Version
+			}
+		}
+	})
+
+	for path, moduleVersion := range moduleVersions {
+		if path == "" || len(path) <= len(module) {
+			continue
+		}
+		if packageName == path || strings.HasPrefix(packageName, path+"/") {
+			module, version = path, moduleVersion
+		}
+	}
+	return module, version
+}
@@ -0,0 +1,143 @@
+package log_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+	wrapper "github.com/timbasel/go-log/pkg/log/internal/wrapper.v2"
+)
+
+type genericList[T any] struct {
+	logger *log.Logger
+	items  []T
+}
+
+func (list *genericList[T]) Add(item T) {
+	list.items = append(list.items, item)
+	list.logger.Info("item added")
+}
+
+func logGeneric[T any](logger *log.Logger, value T) {
+	logger.Info("generic")
+}
+
+func logGenericClosure[T any](logger *log.Logger, value T) {
+	func() {
+		logger.Info("generic closure")
+	}()
+}
+
+func infoWrapper(logger *log.Logger, msg string) {
+	logger.Info(msg)
+}
+
+func prepareTestCallerLogger() (*log.Logger, *recordingOutput) {
+	output := &recordingOutput{}
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	return logger, output
+}
+
+func lastCaller(output *recordingOutput) *log.Caller {
+	output.Flush()
+	return output.records[len(output.records)-1].Caller
+}
+
+func TestCaller(t *testing.T) {
+	logger, output := prepareTestCallerLogger()
+
+	logger.Info("direct")
+	caller := lastCaller(output)
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test", caller.Package)
+	assert.Equal(t, "log_test", caller.ShortPackage())
+	assert.Equal(t, "", caller.Receiver)
+	assert.Equal(t, "TestCaller", caller.Function)
+	assert.True(t, strings.HasSuffix(caller.File, "/pkg/log/caller_test.go"))
+	assert.Regexp(t, `^caller_test.go:\d+$`, caller.Location())
+	assert.Equal(t, "github.com/timbasel/go-log", caller.Module)
+	assert.Equal(t, "(devel)", caller.Version)
+
+	record := output.records[len(output.records)-1]
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test", record.Package)
+	assert.Equal(t, "TestCaller", record.Function)
+}
+
+func TestCallerClosure(t *testing.T) {
+	logger, output := prepareTestCallerLogger()
+
+	func() {
+		logger.Info("closure")
+	}()
+	caller := lastCaller(output)
+	assert.Equal(t, "", caller.Receiver)
+	assert.Equal(t, "TestCallerClosure.func1", caller.Function)
+
+	logGenericClosure(logger, 1)
+	caller = lastCaller(output)
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test", caller.Package)
+	assert.Equal(t, "logGenericClosure.func1", caller.Function)
+}
+
+func TestCallerGenerics(t *testing.T) {
+	logger, output := prepareTestCallerLogger()
+
+	logGeneric(logger, "value")
+	caller := lastCaller(output)
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test", caller.Package)
+	assert.Equal(t, "logGeneric", caller.Function)
+
+	list := &genericList[int]{logger: logger}
+	list.Add(1)
+	caller = lastCaller(output)
+	assert.Equal(t, "*genericList", caller.Receiver)
+	assert.Equal(t, "Add", caller.Function)
+	assert.Equal(t, "(*genericList).Add", caller.QualifiedFunction())
+}
+
+func TestCallerDottedPackage(t *testing.T) {
+	logger, output := prepareTestCallerLogger()
+
+	wrapper.Logger{Logger: logger}.Info("wrapped")
+	caller := lastCaller(output)
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log/internal/wrapper.v2", caller.Package)
+	assert.Equal(t, "wrapper.v2", caller.ShortPackage())
+	assert.Equal(t, "Logger", caller.Receiver)
+	assert.Equal(t, "Info", caller.Function)
+	assert.Equal(t, "Logger.Info", caller.QualifiedFunction())
+}
+
+func TestCallerHelper(t *testing.T) {
+	logger, output := prepareTestCallerLogger()
+
+	wrapper.HelperInfo(logger, "helper")
+	caller := lastCaller(output)
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test", caller.Package)
+	assert.Equal(t, "TestCallerHelper", caller.Function)
+}
+
+func TestCallerSkip(t *testing.T) {
+	logger, output := prepareTestCallerLogger()
+
+	infoWrapper(logger, "unskipped")
+	assert.Equal(t, "infoWrapper", lastCaller(output).Function)
+
+	logger.SetCallerSkip(1)
+	infoWrapper(logger, "skipped")
+	assert.Equal(t, "TestCallerSkip", lastCaller(output).Function)
+}
+
+func TestCallerLocation(t *testing.T) {
+	formatter := prepareTestDefaultFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerLocation = true
+
+	output := &strings.Builder{}
+	logger := log.NewLogger()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{output: formatter})
+
+	logger.Info("located")
+	assert.Regexp(t, `^INFO <log_test.TestCallerLocation caller_test.go:\d+>: located\n$`, output.String())
+}
@@ -0,0 +1,71 @@
+package log
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// callSiteState counts the calls of the call site helpers like InfoOnce from a single program counter
+type callSiteState struct {
+	calls int64
+
+	mutex   sync.Mutex
+	written time.Time
+}
+
+// callSite returns the state of the program counter that called the helper together with its caller
+func (logger *Logger) callSite() (*callSiteState, *Caller) {
+	pc, caller := findCallSite(logger.callerSkip)
+	state, ok := logger.callSites.Load(pc)
+	if !ok {
+		state, _ = logger.callSites.LoadOrStore(pc, &callSiteState{})
+	}
+	return state.(*callSiteState), caller
+}
+
+// count counts the call and returns the number of calls including it
+func (state *callSiteState) count() int64 {
+	return atomic.AddInt64(&state.calls, 1)
+}
+
+// due reports if the interval passed since the last written record, which is the case for the first call
+func (state *callSiteState) due(now time.Time, interval time.Duration) bool {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if !state.written.IsZero() && now.Sub(state.written) < interval {
+		return false
+	}
+	state.written = now
+	return true
+}
+
+// writeCallSite writes the message of a call site helper attributed to its caller
+func (logger *Logger) writeCallSite(level Level, msg string, caller *Caller) {
+	if sampled, caller := logger.sample(level, msg, caller); sampled {
+		logger.write(level, msg, nil, caller)
+	}
+}
+
+// InfoOnce writes an info message the first time it is called from a call site
+func (logger *Logger) InfoOnce(msg ...string) {
+	if state, caller := logger.callSite(); state.count() == 1 {
+		logger.writeCallSite(InfoLevel, strings.Join(msg, " "), caller)
+	}
+}
+
+// InfoEveryN writes an info message the first and then every n-th time it is called from a call site
+func (logger *Logger) InfoEveryN(n int, msg ...string) {
+	if state, caller := logger.callSite(); n <= 1 || (state.count()-1)%int64(n) == 0 {
+		logger.writeCallSite(InfoLevel, strings.Join(msg, " "), caller)
+	}
+}
+
+// InfoEvery writes an info message at most once per interval from a call site
+func (logger *Logger) InfoEvery(interval time.Duration, msg ...string) {
+	if state, caller := logger.callSite(); state.due(logger.clock.Now(), interval) {
+		logger.writeCallSite(InfoLevel, strings.Join(msg, " "), caller)
+	}
+}
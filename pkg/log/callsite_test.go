@@ -0,0 +1,108 @@
+package log_test
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+func TestInfoOnce(t *testing.T) {
+	logger, output := prepareTestLogger()
+
+	for i := 0; i < 3; i++ {
+		logger.InfoOnce("first call site")
+		logger.InfoOnce("second call site")
+	}
+	assert.Equal(t, "first call site\nsecond call site\n", output.String())
+}
+
+func TestInfoOnceConcurrent(t *testing.T) {
+	logger, output := prepareTestLogger()
+	mutex := sync.Mutex{}
+	logger.ClearOutputs()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{lockedWriter{output, &mutex}: log.NewRawFormatter()})
+
+	wait := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < 100; j++ {
+				logger.InfoOnce("once")
+			}
+		}()
+	}
+	wait.Wait()
+	assert.Equal(t, "once\n", output.String())
+}
+
+func TestInfoEveryN(t *testing.T) {
+	logger, output := prepareTestLogger()
+
+	for i := 1; i <= 7; i++ {
+		logger.InfoEveryN(3, "every third")
+	}
+	assert.Equal(t, strings.Repeat("every third\n", 3), output.String())
+}
+
+func TestInfoEvery(t *testing.T) {
+	logger, output := prepareTestLogger()
+	mock := clock.NewMock()
+	logger.SetClock(mock)
+
+	for i := 0; i < 10; i++ {
+		logger.InfoEvery(3*time.Second, "every three seconds")
+		mock.Add(time.Second)
+	}
+	assert.Equal(t, strings.Repeat("every three seconds\n", 4), output.String())
+}
+
+func TestDebugFirstN(t *testing.T) {
+	requireDebug(t)
+	logger, output := prepareTestLogger()
+
+	debug := func() { logger.DebugFirstN(2, "debug") }
+	debug()
+	assert.Equal(t, "", output.String(), "calls must not be counted while debug messages are disabled")
+
+	logger.SetDebugMode(true)
+	for i := 0; i < 5; i++ {
+		debug()
+	}
+	assert.Equal(t, "debug\ndebug\n", output.String())
+}
+
+func TestGlobalCallSiteHelpers(t *testing.T) {
+	output := &strings.Builder{}
+	log.ClearOutputs()
+	log.SetFormattedOutputs(map[io.Writer]log.Formatter{output: log.NewRawFormatter()})
+	t.Cleanup(func() {
+		log.ClearOutputs()
+		log.SetOutputs(os.Stdout)
+		log.ResetGlobalCallSites()
+	})
+
+	for i := 0; i < 4; i++ {
+		log.InfoOnce("once")
+		log.InfoEveryN(2, "every second")
+	}
+	assert.Equal(t, "once\nevery second\nevery second\n", output.String())
+}
+
+type lockedWriter struct {
+	writer io.Writer
+	mutex  *sync.Mutex
+}
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writer.Write(p)
+}
@@ -0,0 +1,104 @@
+//go:build !nolog_debug
+
+package log
+
+import "strings"
+
+// debugCompiled reports if debug messages are compiled in, which is disabled by the nolog_debug build tag
+const debugCompiled = true
+
+// Debug writes a debug message to the log
+func (logger *Logger) Debug(msg ...string) {
+	if enabled, caller := logger.isDebugEnabled(); enabled {
+		message := strings.Join(msg, " ")
+		if sampled, caller := logger.sample(DebugLevel, message, caller); sampled {
+			logger.write(DebugLevel, message, nil, caller)
+		}
+	}
+}
+
+// Debugf writes a formatted debug message to the log
+func (logger *Logger) Debugf(format string, arguments ...interface{}) {
+	if enabled, caller := logger.isDebugEnabled(); enabled {
+		if sampled, caller := logger.sample(DebugLevel, format, caller); sampled {
+			logger.write(DebugLevel, formatMessage(format, arguments), nil, caller)
+		}
+	}
+}
+
+// DebugFn writes the debug message returned by the function to the log, the function is only called if debug messages
+// of the caller are written
+func (logger *Logger) DebugFn(msg func() string) {
+	if enabled, caller := logger.isDebugEnabled(); enabled {
+		message := msg()
+		if sampled, caller := logger.sample(DebugLevel, message, caller); sampled {
+			logger.write(DebugLevel, message, nil, caller)
+		}
+	}
+}
+
+// DebugFnFields writes a debug message with the fields returned by the function to the log, the function is only
+// called if debug messages of the caller are written
+func (logger *Logger) DebugFnFields(msg string, fields func() []Field) {
+	if enabled, caller := logger.isDebugEnabled(); enabled {
+		if sampled, caller := logger.sample(DebugLevel, msg, caller); sampled {
+			logger.write(DebugLevel, msg, fields(), caller)
+		}
+	}
+}
+
+// DebugFirstN writes a debug message the first n times it is called from a call site while debug messages are enabled
+func (logger *Logger) DebugFirstN(n int, msg ...string) {
+	if enabled, _ := logger.isDebugEnabled(); !enabled {
+		return
+	}
+	if state, caller := logger.callSite(); state.count() <= int64(n) {
+		logger.writeCallSite(DebugLevel, strings.Join(msg, " "), caller)
+	}
+}
+
+// Debug writes a debug message with the fields of the entry to the log
+func (entry *Entry) Debug(msg ...string) {
+	if enabled, caller := entry.logger.isDebugEnabled(); enabled {
+		message := strings.Join(msg, " ")
+		if sampled, caller := entry.logger.sample(DebugLevel, message, caller); sampled {
+			entry.logger.write(DebugLevel, message, entry.fields, caller)
+		}
+	}
+}
+
+// Debugf writes a formatted debug message with the fields of the entry to the log
+func (entry *Entry) Debugf(format string, arguments ...interface{}) {
+	if enabled, caller := entry.logger.isDebugEnabled(); enabled {
+		if sampled, caller := entry.logger.sample(DebugLevel, format, caller); sampled {
+			entry.logger.write(DebugLevel, formatMessage(format, arguments), entry.fields, caller)
+		}
+	}
+}
+
+// Debug writes a debug message to the global log
+func Debug(msg ...string) {
+	globalLogger.Debug(msg...)
+}
+
+// Debugf writes a formatted error message to the global log
+func Debugf(format string, arguments ...interface{}) {
+	globalLogger.Debugf(format, arguments...)
+}
+
+// DebugFn writes the debug message returned by the function to the global log, the function is only called if debug
+// messages of the caller are written
+func DebugFn(msg func() string) {
+	globalLogger.DebugFn(msg)
+}
+
+// DebugFnFields writes a debug message with the fields returned by the function to the global log, the function is
+// only called if debug messages of the caller are written
+func DebugFnFields(msg string, fields func() []Field) {
+	globalLogger.DebugFnFields(msg, fields)
+}
+
+// DebugFirstN writes a debug message to the global log the first n times it is called from a call site
+func DebugFirstN(n int, msg ...string) {
+	globalLogger.DebugFirstN(n, msg...)
+}
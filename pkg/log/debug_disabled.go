@@ -0,0 +1,42 @@
+//go:build nolog_debug
+
+package log
+
+// debugCompiled reports if debug messages are compiled in, which is disabled by the nolog_debug build tag
+const debugCompiled = false
+
+// Debug is compiled out by the nolog_debug build tag
+func (logger *Logger) Debug(msg ...string) {}
+
+// Debugf is compiled out by the nolog_debug build tag
+func (logger *Logger) Debugf(format string, arguments ...interface{}) {}
+
+// DebugFn is compiled out by the nolog_debug build tag
+func (logger *Logger) DebugFn(msg func() string) {}
+
+// DebugFnFields is compiled out by the nolog_debug build tag
+func (logger *Logger) DebugFnFields(msg string, fields func() []Field) {}
+
+// DebugFirstN is compiled out by the nolog_debug build tag
+func (logger *Logger) DebugFirstN(n int, msg ...string) {}
+
+// Debug is compiled out by the nolog_debug build tag
+func (entry *Entry) Debug(msg ...string) {}
+
+// Debugf is compiled out by the nolog_debug build tag
+func (entry *Entry) Debugf(format string, arguments ...interface{}) {}
+
+// Debug is compiled out by the nolog_debug build tag
+func Debug(msg ...string) {}
+
+// Debugf is compiled out by the nolog_debug build tag
+func Debugf(format string, arguments ...interface{}) {}
+
+// DebugFn is compiled out by the nolog_debug build tag
+func DebugFn(msg func() string) {}
+
+// DebugFnFields is compiled out by the nolog_debug build tag
+func DebugFnFields(msg string, fields func() []Field) {}
+
+// DebugFirstN is compiled out by the nolog_debug build tag
+func DebugFirstN(n int, msg ...string) {}
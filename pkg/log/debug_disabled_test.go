@@ -0,0 +1,61 @@
+//go:build nolog_debug
+
+package log_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+// debugCompiled reports if the tests are built with debug messages compiled in
+const debugCompiled = false
+
+func TestDebugCompiledOut(t *testing.T) {
+	logger, output := prepareTestLogger()
+	logger.SetDebugMode(true)
+
+	called := false
+	logger.Debug("debug message")
+	logger.Debugf("debug %s", "message")
+	logger.DebugFn(func() string { called = true; return "debug message" })
+	logger.DebugFnFields("debug message", func() []log.Field { called = true; return nil })
+	logger.DebugFirstN(1, "debug message")
+	logger.WithFields(log.Int("attempt", 1)).Debug("debug message")
+	logger.WithFields(log.Int("attempt", 1)).Debugf("debug %s", "message")
+	logger.Info("info message")
+
+	assert.False(t, called)
+	assert.False(t, logger.Enabled(log.DebugLevel))
+	assert.True(t, logger.Enabled(log.InfoLevel))
+	assert.Equal(t, "info message\n", output.String())
+}
+
+func TestDebugCompiledOutAllocations(t *testing.T) {
+	logger, _ := prepareTestLogger()
+	logger.SetDebugMode(true)
+
+	// the arguments of the inlined no-op calls must not be boxed or captured on the heap
+	state := struct{ items []int }{items: []int{1, 2, 3}}
+	allocations := testing.AllocsPerRun(100, func() {
+		logger.Debugf("state %v", state)
+		logger.DebugFn(func() string { return fmt.Sprint(state) })
+		log.Debugf("state %v", state)
+	})
+	assert.Equal(t, float64(0), allocations)
+}
+
+func BenchmarkDebugCompiledOut(b *testing.B) {
+	logger := prepareBenchmarkLogger(log.NewDefaultFormatter())
+	logger.SetDebugMode(true)
+	state := struct{ items []int }{items: []int{1, 2, 3}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Debugf("state %v", state)
+		logger.DebugFn(func() string { return fmt.Sprint(state) })
+	}
+}
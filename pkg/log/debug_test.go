@@ -0,0 +1,6 @@
+//go:build !nolog_debug
+
+package log_test
+
+// debugCompiled reports if the tests are built with debug messages compiled in
+const debugCompiled = true
@@ -0,0 +1,192 @@
+package log
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// DeduplicationKey selects which parts of records are compared to detect duplicates
+type DeduplicationKey int
+
+const (
+	// DeduplicateByMessage treats records with the same level and message as duplicates
+	DeduplicateByMessage DeduplicationKey = iota
+	// DeduplicateByMessageAndCaller treats records with the same level and message written from the same call site as
+	// duplicates
+	DeduplicateByMessageAndCaller
+	// DeduplicateByMessageAndFields treats records with the same level, message and fields as duplicates
+	DeduplicateByMessageAndFields
+)
+
+// RepeatedField is the key of the field holding the number of collapsed records in the summaries of a Deduplicator
+const RepeatedField = "repeated"
+
+// A Deduplicator collapses duplicate records into the first record and a summary like "last message repeated 5 times
+// over 3s", which is written once the duplicates end and when the logger is closed. Without a Window only
+// consecutive records are collapsed, otherwise all duplicates of a record written within the Window are collapsed
+// into a summary like `"connection refused" repeated 5 times over 3s`, which is written at latest one Window after the
+// Window ended. Every output is deduplicated separately.
+type Deduplicator struct {
+	Key    DeduplicationKey
+	Window time.Duration
+	Clock  clock.Clock
+
+	mutex   sync.Mutex
+	outputs map[interface{}]*deduplicationState
+}
+
+// NewDeduplicator initializes a new Deduplicator collapsing consecutive records with the same message
+func NewDeduplicator() *Deduplicator {
+	return &Deduplicator{
+		Key:   DeduplicateByMessage,
+		Clock: clock.New(),
+	}
+}
+
+// deduplicationState holds the records written to an output whose duplicates are collapsed
+type deduplicationState struct {
+	entries   map[string]*duplicateEntry
+	nextSweep time.Time
+}
+
+// duplicateEntry counts the duplicates of a written record
+type duplicateEntry struct {
+	record   *Record
+	written  time.Time
+	last     time.Time
+	repeated int
+}
+
+// key returns the string identifying duplicates of the record
+func (d *Deduplicator) key(record *Record) string {
+	buf := append([]byte(record.Level.String()), 0)
+	buf = append(buf, record.Message...)
+	switch d.Key {
+	case DeduplicateByMessageAndCaller:
+		buf = append(buf, 0)
+		buf = append(buf, record.Package...)
+		buf = append(buf, 0)
+		buf = append(buf, record.Function...)
+		if record.Caller != nil {
+			buf = append(buf, 0)
+			buf = append(buf, record.Caller.File...)
+			buf = strconv.AppendInt(append(buf, ':'), int64(record.Caller.Line), 10)
+		}
+	case DeduplicateByMessageAndFields:
+		buf = append(buf, 0)
+		buf = appendFields(buf, record.Fields)
+	}
+	return string(buf)
+}
+
+// check reports if the record with the key is a duplicate of a record written to the output and returns the
+// summaries of collapsed records that have to be written to the output before the record
+func (d *Deduplicator) check(output interface{}, key string, record *Record) (duplicate bool, summaries []*Record) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.Clock.Now()
+	if d.outputs == nil {
+		d.outputs = map[interface{}]*deduplicationState{}
+	}
+	state, ok := d.outputs[output]
+	if !ok {
+		state = &deduplicationState{entries: map[string]*duplicateEntry{}}
+		d.outputs[output] = state
+	}
+
+	entry, ok := state.entries[key]
+	if ok && (d.Window <= 0 || now.Sub(entry.written) < d.Window) {
+		entry.repeated++
+		entry.last = now
+		return true, nil
+	}
+
+	if d.Window <= 0 {
+		// consecutive duplicates end with the first different record
+		summaries = d.sweep(state, now, true)
+	} else if ok || !now.Before(state.nextSweep) {
+		summaries = d.sweep(state, now, false)
+		state.nextSweep = now.Add(d.Window)
+	}
+	state.entries[key] = &duplicateEntry{record: record, written: now, last: now}
+	return false, summaries
+}
+
+// sweep removes the entries whose window ended, or all entries if all is set, and returns the summaries of their
+// collapsed records
+func (d *Deduplicator) sweep(state *deduplicationState, now time.Time, all bool) (summaries []*Record) {
+	for key, entry := range state.entries {
+		if !all && now.Sub(entry.written) < d.Window {
+			continue
+		}
+		if entry.repeated > 0 {
+			summaries = append(summaries, d.summary(entry))
+		}
+		delete(state.entries, key)
+	}
+	sortRecords(summaries)
+	return summaries
+}
+
+// expire returns the summaries of the collapsed records of all outputs whose window ended
+func (d *Deduplicator) expire() map[interface{}][]*Record {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	summaries := map[interface{}][]*Record{}
+	now := d.Clock.Now()
+	for output, state := range d.outputs {
+		if outputSummaries := d.sweep(state, now, false); len(outputSummaries) > 0 {
+			summaries[output] = outputSummaries
+		}
+		state.nextSweep = now.Add(d.Window)
+	}
+	return summaries
+}
+
+// flush returns the summaries of the collapsed records of all outputs and resets the deduplicator
+func (d *Deduplicator) flush() map[interface{}][]*Record {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	summaries := map[interface{}][]*Record{}
+	for output, state := range d.outputs {
+		if outputSummaries := d.sweep(state, d.Clock.Now(), true); len(outputSummaries) > 0 {
+			summaries[output] = outputSummaries
+		}
+	}
+	d.outputs = nil
+	return summaries
+}
+
+// summary returns the record summarizing the collapsed duplicates of the entry
+func (d *Deduplicator) summary(entry *duplicateEntry) *Record {
+	message := "last message"
+	if d.Window > 0 {
+		message = strconv.Quote(entry.record.Message)
+	}
+	times := " times"
+	if entry.repeated == 1 {
+		times = " time"
+	}
+	message += " repeated " + strconv.Itoa(entry.repeated) + times + " over " + entry.last.Sub(entry.written).String()
+
+	summary := &Record{Time: entry.last, Level: entry.record.Level, Message: message, Fields: []Field{Int(RepeatedField, entry.repeated)}}
+	summary.Package, summary.Function, summary.Caller = entry.record.Package, entry.record.Function, entry.record.Caller
+	return summary
+}
+
+// sortRecords orders the records by the time they were written and their message
+func sortRecords(records []*Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Time.Equal(records[j].Time) {
+			return records[i].Time.Before(records[j].Time)
+		}
+		return records[i].Message < records[j].Message
+	})
+}
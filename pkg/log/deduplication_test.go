@@ -0,0 +1,128 @@
+package log_test
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+func prepareTestDeduplicator(key log.DeduplicationKey, window time.Duration) (*log.Logger, func() string, *clock.Mock) {
+	formatter := log.NewLogfmtFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	formatter.ColorsDisabled = true
+
+	// summaries of expired records are written by the summary loop, so the output is read while holding the lock
+	output := &strings.Builder{}
+	mutex := &sync.Mutex{}
+	written := func() string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return output.String()
+	}
+	logger := log.NewLogger()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{lockedWriter{output, mutex}: formatter})
+
+	mock := clock.NewMock()
+	deduplicator := log.NewDeduplicator()
+	deduplicator.Key = key
+	deduplicator.Window = window
+	deduplicator.Clock = mock
+	logger.SetDeduplicator(deduplicator)
+	return logger, written, mock
+}
+
+func TestDeduplicatorConsecutive(t *testing.T) {
+	logger, written, mock := prepareTestDeduplicator(log.DeduplicateByMessage, 0)
+
+	for i := 0; i < 4; i++ {
+		logger.Info("retrying")
+		mock.Add(time.Second)
+	}
+	logger.Error("retrying")
+	logger.Info("connected")
+	logger.Info("retrying")
+
+	assert.Equal(t, strings.Join([]string{
+		"level=INFO msg=retrying",
+		`level=INFO msg="last message repeated 3 times over 3s" repeated=3`,
+		"level=ERROR msg=retrying",
+		"level=INFO msg=connected",
+		"level=INFO msg=retrying",
+	}, "\n")+"\n", written())
+}
+
+func TestDeduplicatorWindow(t *testing.T) {
+	logger, written, mock := prepareTestDeduplicator(log.DeduplicateByMessage, 10*time.Second)
+
+	for i := 0; i < 3; i++ {
+		logger.Info("connection refused")
+		logger.Info("timeout")
+		mock.Add(2 * time.Second)
+	}
+
+	// the summaries of expired records are written once the window ended, even if no further records are written
+	mock.Add(5 * time.Second)
+	waitUntil(func() bool { return strings.Count(written(), "repeated=") == 2 })
+	assert.Equal(t, 2, strings.Count(written(), "repeated="))
+	logger.Info("timeout")
+
+	assert.Equal(t, strings.Join([]string{
+		"level=INFO msg=\"connection refused\"",
+		"level=INFO msg=timeout",
+		`level=INFO msg="\"connection refused\" repeated 2 times over 4s" repeated=2`,
+		`level=INFO msg="\"timeout\" repeated 2 times over 4s" repeated=2`,
+		"level=INFO msg=timeout",
+	}, "\n")+"\n", written())
+}
+
+func TestDeduplicatorKeys(t *testing.T) {
+	logger, written, _ := prepareTestDeduplicator(log.DeduplicateByMessageAndFields, 0)
+	logger.WithFields(log.Int("attempt", 1)).Info("retrying")
+	logger.WithFields(log.Int("attempt", 1)).Info("retrying")
+	logger.WithFields(log.Int("attempt", 2)).Info("retrying")
+	assert.Equal(t, strings.Join([]string{
+		"level=INFO msg=retrying attempt=1",
+		`level=INFO msg="last message repeated 1 time over 0s" repeated=1`,
+		"level=INFO msg=retrying attempt=2",
+	}, "\n")+"\n", written())
+
+	logger, written, _ = prepareTestDeduplicator(log.DeduplicateByMessageAndCaller, 0)
+	retry := func() { logger.Info("retrying") }
+	retry()
+	retry()
+	logger.Info("retrying")
+	assert.Equal(t, strings.Join([]string{
+		"level=INFO msg=retrying",
+		`level=INFO msg="last message repeated 1 time over 0s" repeated=1`,
+		"level=INFO msg=retrying",
+	}, "\n")+"\n", written())
+}
+
+func TestDeduplicatorClose(t *testing.T) {
+	logger, written, mock := prepareTestDeduplicator(log.DeduplicateByMessage, time.Minute)
+	records := &recordingOutput{}
+	logger.SetRecordOutputs(records)
+
+	for i := 0; i < 3; i++ {
+		logger.Info("retrying")
+		mock.Add(time.Second)
+	}
+	assert.Equal(t, "level=INFO msg=retrying\n", written())
+
+	// the summaries of all outputs are written when the logger is closed
+	assert.NoError(t, logger.Close())
+	assert.Equal(t, "level=INFO msg=retrying\n"+`level=INFO msg="\"retrying\" repeated 2 times over 2s" repeated=2`+"\n", written())
+
+	records.Flush()
+	assert.Len(t, records.records, 2)
+	assert.Equal(t, records.records[0].Caller, records.records[1].Caller)
+	assert.Equal(t, "TestDeduplicatorClose", records.records[1].Function)
+	assert.Equal(t, int64(2), records.records[1].Fields[0].Interface())
+}
@@ -0,0 +1,52 @@
+package log
+
+import "strings"
+
+// An Entry writes messages with a set of fields attached to the logger it was created from
+type Entry struct {
+	logger *Logger
+	fields []Field
+}
+
+// WithFields returns a new entry with the provided fields added to the fields of the entry
+func (entry *Entry) WithFields(fields ...Field) *Entry {
+	combined := make([]Field, 0, len(entry.fields)+len(fields))
+	combined = append(combined, entry.fields...)
+	combined = append(combined, fields...)
+	return &Entry{logger: entry.logger, fields: combined}
+}
+
+// Err returns a new entry with the error added to the fields of the entry
+func (entry *Entry) Err(err error) *Entry {
+	return entry.WithFields(Err(err))
+}
+
+// Error writes an error message with the fields of the entry to the log
+func (entry *Entry) Error(msg ...string) {
+	message := strings.Join(msg, " ")
+	if sampled, caller := entry.logger.sample(ErrorLevel, message, nil); sampled {
+		entry.logger.write(ErrorLevel, message, entry.fields, caller)
+	}
+}
+
+// Errorf writes a formatted error message with the fields of the entry to the log
+func (entry *Entry) Errorf(format string, arguments ...interface{}) {
+	if sampled, caller := entry.logger.sample(ErrorLevel, format, nil); sampled {
+		entry.logger.write(ErrorLevel, formatMessage(format, arguments), entry.fields, caller)
+	}
+}
+
+// Info writes an info message with the fields of the entry to the log
+func (entry *Entry) Info(msg ...string) {
+	message := strings.Join(msg, " ")
+	if sampled, caller := entry.logger.sample(InfoLevel, message, nil); sampled {
+		entry.logger.write(InfoLevel, message, entry.fields, caller)
+	}
+}
+
+// Infof writes a formatted info message with the fields of the entry to the log
+func (entry *Entry) Infof(format string, arguments ...interface{}) {
+	if sampled, caller := entry.logger.sample(InfoLevel, format, nil); sampled {
+		entry.logger.write(InfoLevel, formatMessage(format, arguments), entry.fields, caller)
+	}
+}
@@ -0,0 +1,242 @@
+package log
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// ErrorField is the key of the field holding the error attached by Err
+const ErrorField = "error"
+
+const (
+	maxErrorDepth = 32
+	maxStackDepth = 64
+)
+
+// logPackage is the package path of this package, whose frames are omitted from captured stack traces
+var logPackage = reflect.TypeOf(Record{}).PkgPath()
+
+// A StackFrame is a single function call of a stack trace
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// String returns the frame as "function (file:line)"
+func (frame StackFrame) String() string {
+	return fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line)
+}
+
+// ErrorDetails describes an error together with its stack trace and the tree of errors it wraps. Wrapping errors
+// that only add a stack trace are merged into the error they wrap.
+type ErrorDetails struct {
+	Message string          `json:"msg"`
+	Stack   []StackFrame    `json:"stack,omitempty"`
+	Causes  []*ErrorDetails `json:"causes,omitempty"`
+
+	err error
+}
+
+// NewErrorDetails collects the details of the error by following errors.Unwrap and errors.Join trees and extracting
+// stack traces from errors that implement StackTrace() or Callers()
+func NewErrorDetails(err error) *ErrorDetails {
+	if details, ok := err.(*ErrorDetails); ok {
+		return details
+	}
+	return newErrorDetails(err, 0)
+}
+
+func newErrorDetails(err error, depth int) *ErrorDetails {
+	details := &ErrorDetails{Message: err.Error(), Stack: errorStack(err), err: err}
+	if depth >= maxErrorDepth {
+		return details
+	}
+
+	var causes []error
+	switch wrapper := err.(type) {
+	case interface{ Unwrap() error }:
+		if cause := wrapper.Unwrap(); cause != nil {
+			causes = []error{cause}
+		}
+	case interface{ Unwrap() []error }:
+		for _, cause := range wrapper.Unwrap() {
+			if cause != nil {
+				causes = append(causes, cause)
+			}
+		}
+	}
+
+	for _, cause := range causes {
+		details.Causes = append(details.Causes, newErrorDetails(cause, depth+1))
+	}
+
+	// errors that only attach a stack trace to the error they wrap are merged with it
+	if len(details.Causes) == 1 && details.Causes[0].Message == details.Message {
+		cause := details.Causes[0]
+		if len(cause.Stack) == 0 {
+			cause.Stack = details.Stack
+		}
+		details.Stack, details.Causes = cause.Stack, cause.Causes
+	}
+	return details
+}
+
+// Error returns the message of the error
+func (details *ErrorDetails) Error() string {
+	return details.Message
+}
+
+// Unwrap returns the error the details were collected from
+func (details *ErrorDetails) Unwrap() error {
+	return details.err
+}
+
+// hasDetails reports if the error carries more information than its message
+func (details *ErrorDetails) hasDetails() bool {
+	return len(details.Stack) > 0 || len(details.Causes) > 0
+}
+
+// hasStack reports if the error or one of its causes carries a stack trace
+func (details *ErrorDetails) hasStack() bool {
+	if len(details.Stack) > 0 {
+		return true
+	}
+	for _, cause := range details.Causes {
+		if cause.hasStack() {
+			return true
+		}
+	}
+	return false
+}
+
+// mapMessages returns a copy of the details with the function applied to all messages, the copy does not unwrap to
+// the original error, whose message is not mapped
+func (details *ErrorDetails) mapMessages(mapping func(string) string) *ErrorDetails {
+	mapped := &ErrorDetails{Message: mapping(details.Message), Stack: details.Stack}
+	for _, cause := range details.Causes {
+		mapped.Causes = append(mapped.Causes, cause.mapMessages(mapping))
+	}
+	return mapped
+}
+
+// appendBlock appends the details as indented lines, starting with the label followed by the stack and the causes
+func (details *ErrorDetails) appendBlock(buf []byte, label string, indent string, sanitizeMode SanitizeMode) []byte {
+	message := strings.ReplaceAll(details.Message, "\n", "; ")
+	if sanitizeMode == SanitizeMultiline {
+		sanitizeMode = SanitizeStrip
+	}
+
+	buf = append(buf, indent...)
+	buf = append(buf, label...)
+	buf = append(buf, ": "...)
+	buf = append(buf, sanitize(message, sanitizeMode, "")...)
+	buf = append(buf, '\n')
+	for _, frame := range details.Stack {
+		buf = append(buf, indent...)
+		buf = append(buf, "    at "...)
+		buf = append(buf, frame.String()...)
+		buf = append(buf, '\n')
+	}
+	for _, cause := range details.Causes {
+		buf = cause.appendBlock(buf, "caused by", indent+"    ", sanitizeMode)
+	}
+	return buf
+}
+
+// errorDetailsValue returns the details of field values holding errors that carry more information than their message
+func errorDetailsValue(value interface{}) (*ErrorDetails, bool) {
+	err, ok := resolveLogValue(value).(error)
+	if !ok {
+		return nil, false
+	}
+	details := NewErrorDetails(err)
+	return details, details.hasDetails()
+}
+
+// errorStack extracts the stack trace of errors implementing a StackTrace() method returning program counters (like
+// github.com/pkg/errors) or runtime frames, or a Callers() method returning program counters
+func errorStack(err error) []StackFrame {
+	value := reflect.ValueOf(err)
+	for _, name := range []string{"StackTrace", "Callers"} {
+		method := value.MethodByName(name)
+		if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+			continue
+		}
+		result := method.Type().Out(0)
+		if result.Kind() != reflect.Slice {
+			continue
+		}
+
+		trace := method.Call(nil)[0]
+		switch {
+		case result.Elem().Kind() == reflect.Uintptr:
+			pcs := make([]uintptr, trace.Len())
+			for i := range pcs {
+				pcs[i] = uintptr(trace.Index(i).Uint())
+			}
+			return stackFrames(pcs)
+		case result.Elem() == reflect.TypeOf(runtime.Frame{}):
+			frames := make([]StackFrame, trace.Len())
+			for i := range frames {
+				frame := trace.Index(i).Interface().(runtime.Frame)
+				frames[i] = StackFrame{Function: frame.Function, File: frame.File, Line: frame.Line}
+			}
+			return frames
+		}
+	}
+	return nil
+}
+
+// captureStack returns the stack of the caller of the logger, omitting the frames of this package
+func captureStack() []StackFrame {
+	pcs := make([]uintptr, maxStackDepth)
+	frames := stackFrames(pcs[:runtime.Callers(2, pcs)])
+	for len(frames) > 0 && strings.HasPrefix(frames[0].Function, logPackage+".") {
+		frames = frames[1:]
+	}
+	return frames
+}
+
+func stackFrames(pcs []uintptr) []StackFrame {
+	frames := []StackFrame{}
+	callers := runtime.CallersFrames(pcs)
+	for {
+		frame, more := callers.Next()
+		if frame.Function != "" {
+			frames = append(frames, StackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		}
+		if !more {
+			return frames
+		}
+	}
+}
+
+// captureErrorStacks returns a copy of the fields with error values replaced by their details, attaching the stack of
+// the caller to errors that do not carry a stack trace themselves
+func captureErrorStacks(fields []Field) []Field {
+	var stack []StackFrame
+	captured, copied := fields, false
+	for i, field := range fields {
+		err, ok := resolveLogValue(field.Value).(error)
+		if !ok {
+			continue
+		}
+		details := NewErrorDetails(err)
+		if !details.hasStack() {
+			if stack == nil {
+				stack = captureStack()
+			}
+			withStack := *details
+			withStack.Stack = stack
+			details = &withStack
+		}
+		if !copied {
+			captured, copied = append([]Field{}, fields...), true
+		}
+		captured[i] = Field{Key: field.Key, Value: details}
+	}
+	return captured
+}
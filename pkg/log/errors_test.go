@@ -0,0 +1,161 @@
+package log_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+// stackFrame and stackError mimic the stack traces of github.com/pkg/errors
+type stackFrame uintptr
+
+type stackError struct {
+	msg   string
+	cause error
+	stack []uintptr
+}
+
+func newStackError(msg string, cause error) error {
+	pcs := make([]uintptr, 32)
+	return &stackError{msg: msg, cause: cause, stack: pcs[:runtime.Callers(2, pcs)]}
+}
+
+func (err *stackError) Error() string {
+	if err.cause != nil {
+		return err.msg + ": " + err.cause.Error()
+	}
+	return err.msg
+}
+
+func (err *stackError) Unwrap() error {
+	return err.cause
+}
+
+func (err *stackError) StackTrace() []stackFrame {
+	frames := make([]stackFrame, len(err.stack))
+	for i, pc := range err.stack {
+		frames[i] = stackFrame(pc)
+	}
+	return frames
+}
+
+func prepareTestErrorLogger(formatter log.Formatter) (*log.Logger, *strings.Builder) {
+	output := &strings.Builder{}
+	logger := log.NewLogger()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{output: formatter})
+	return logger, output
+}
+
+func prepareTestErrorJSONFormatter() *log.JSONFormatter {
+	formatter := prepareTestJSONFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	return formatter
+}
+
+func TestErrorDetails(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("load config: %w", errors.Join(fmt.Errorf("primary: %w", cause), errors.New("fallback: timeout")))
+
+	details := log.NewErrorDetails(err)
+	assert.Equal(t, "load config: primary: connection refused\nfallback: timeout", details.Message)
+	assert.Len(t, details.Causes, 1)
+	assert.Len(t, details.Causes[0].Causes, 2)
+	assert.Equal(t, "primary: connection refused", details.Causes[0].Causes[0].Message)
+	assert.Equal(t, "connection refused", details.Causes[0].Causes[0].Causes[0].Message)
+	assert.Equal(t, "fallback: timeout", details.Causes[0].Causes[1].Message)
+	assert.True(t, errors.Is(details, cause))
+}
+
+func TestErrorDetailsStackTrace(t *testing.T) {
+	err := newStackError("query failed", errors.New("database is locked"))
+
+	details := log.NewErrorDetails(err)
+	assert.NotEmpty(t, details.Stack)
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test.TestErrorDetailsStackTrace", details.Stack[0].Function)
+	assert.True(t, strings.HasSuffix(details.Stack[0].File, "errors_test.go"))
+	assert.Len(t, details.Causes, 1)
+	assert.Empty(t, details.Causes[0].Stack)
+}
+
+func TestErrDefaultFormatter(t *testing.T) {
+	formatter := prepareTestDefaultFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	logger, output := prepareTestErrorLogger(formatter)
+
+	logger.Err(fmt.Errorf("load config: %w", errors.Join(errors.New("file not found"), errors.New("no defaults")))).Error("startup failed")
+	assert.Equal(t, "ERROR: startup failed error=\"load config: file not found\\nno defaults\"\n"+
+		"    error: load config: file not found; no defaults\n"+
+		"        caused by: file not found; no defaults\n"+
+		"            caused by: file not found\n"+
+		"            caused by: no defaults\n", output.String())
+
+	// errors without causes or stack traces are only written as field
+	output.Reset()
+	logger.WithFields(log.Field{Key: "attempt", Value: 2}).Err(errors.New("timeout")).Info("retrying")
+	assert.Equal(t, "INFO: retrying attempt=2 error=timeout\n", output.String())
+}
+
+func TestErrJSONFormatter(t *testing.T) {
+	logger, output := prepareTestErrorLogger(prepareTestErrorJSONFormatter())
+
+	logger.Err(fmt.Errorf("sync: %w", errors.Join(errors.New("first"), errors.New("second")))).Error("sync failed")
+	assert.Equal(t, `{"error":{"msg":"sync: first\nsecond","causes":[{"msg":"first\nsecond","causes":[{"msg":"first"},{"msg":"second"}]}]},"level":"ERROR","msg":"sync failed"}`+"\n", output.String())
+
+	output.Reset()
+	logger.Err(errors.New("timeout")).Error("request failed")
+	assert.Equal(t, `{"error":"timeout","level":"ERROR","msg":"request failed"}`+"\n", output.String())
+}
+
+func TestErrStackTrace(t *testing.T) {
+	formatter := prepareTestDefaultFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	logger, output := prepareTestErrorLogger(formatter)
+
+	logger.Err(newStackError("query failed", nil)).Error("request failed")
+	lines := strings.Split(output.String(), "\n")
+	assert.Equal(t, "ERROR: request failed error=\"query failed\"", lines[0])
+	assert.Equal(t, "    error: query failed", lines[1])
+	assert.Regexp(t, `^        at github.com/timbasel/go-log/pkg/log_test.TestErrStackTrace \(.*errors_test.go:\d+\)$`, lines[2])
+}
+
+func TestErrStackCapture(t *testing.T) {
+	logger, output := prepareTestErrorLogger(prepareTestErrorJSONFormatter())
+	logger.SetStackCapture(true)
+
+	err := errors.New("timeout")
+	logger.Err(err).Error("request failed")
+
+	entry := struct {
+		Error log.ErrorDetails `json:"error"`
+	}{}
+	assert.NoError(t, json.Unmarshal([]byte(output.String()), &entry))
+	assert.Equal(t, "timeout", entry.Error.Message)
+	assert.NotEmpty(t, entry.Error.Stack)
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test.TestErrStackCapture", entry.Error.Stack[0].Function)
+
+	// errors carrying their own stack trace are kept unchanged
+	output.Reset()
+	logger.Err(fmt.Errorf("request: %w", newStackError("query failed", nil))).Error("request failed")
+	entry.Error = log.ErrorDetails{}
+	assert.NoError(t, json.Unmarshal([]byte(output.String()), &entry))
+	assert.Empty(t, entry.Error.Stack)
+	assert.NotEmpty(t, entry.Error.Causes[0].Stack)
+}
+
+func TestErrRedaction(t *testing.T) {
+	logger, output := prepareTestErrorLogger(prepareTestErrorJSONFormatter())
+	logger.SetRedactor(log.NewRedactor())
+
+	logger.Err(fmt.Errorf("notify: %w", errors.Join(errors.New("invalid address jane@example.com")))).Error("notification failed")
+	assert.Equal(t, `{"error":{"msg":"notify: invalid address [REDACTED]","causes":[{"msg":"invalid address [REDACTED]"}]},"level":"ERROR","msg":"notification failed"}`+"\n", output.String())
+}
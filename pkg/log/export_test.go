@@ -0,0 +1,10 @@
+package log
+
+// ResetGlobalCallSites forgets the call site state of the global logger, so tests of the global call site helpers can
+// be repeated
+func ResetGlobalCallSites() {
+	globalLogger.callSites.Range(func(key, _ interface{}) bool {
+		globalLogger.callSites.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,393 @@
+package log
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fieldKind tells which member of a Field holds its value, fields created without a constructor use Value
+type fieldKind uint8
+
+const (
+	anyKind fieldKind = iota
+	stringKind
+	intKind
+	floatKind
+	boolKind
+	durationKind
+	timeKind
+	objectKind
+	arrayKind
+	lazyKind
+)
+
+// The ObjectMarshaler interface is implemented by types that encode themselves as objects of key value pairs
+type ObjectMarshaler interface {
+	MarshalLogObject(encoder ObjectEncoder) error
+}
+
+// The ArrayMarshaler interface is implemented by types that encode themselves as arrays
+type ArrayMarshaler interface {
+	MarshalLogArray(encoder ArrayEncoder) error
+}
+
+// An ObjectEncoder is passed to ObjectMarshalers to add the key value pairs of the object
+type ObjectEncoder interface {
+	AddString(key string, value string)
+	AddInt(key string, value int)
+	AddInt64(key string, value int64)
+	AddFloat64(key string, value float64)
+	AddBool(key string, value bool)
+	AddDuration(key string, value time.Duration)
+	AddTime(key string, value time.Time)
+	AddObject(key string, value ObjectMarshaler) error
+	AddArray(key string, value ArrayMarshaler) error
+	AddAny(key string, value interface{})
+}
+
+// An ArrayEncoder is passed to ArrayMarshalers to append the elements of the array
+type ArrayEncoder interface {
+	AppendString(value string)
+	AppendInt(value int)
+	AppendInt64(value int64)
+	AppendFloat64(value float64)
+	AppendBool(value bool)
+	AppendDuration(value time.Duration)
+	AppendTime(value time.Time)
+	AppendObject(value ObjectMarshaler) error
+	AppendArray(value ArrayMarshaler) error
+	AppendAny(value interface{})
+}
+
+// String returns a field holding a string
+func String(key string, value string) Field {
+	return Field{Key: key, kind: stringKind, text: value}
+}
+
+// Int returns a field holding an int
+func Int(key string, value int) Field {
+	return Field{Key: key, kind: intKind, integer: int64(value)}
+}
+
+// Int64 returns a field holding an int64
+func Int64(key string, value int64) Field {
+	return Field{Key: key, kind: intKind, integer: value}
+}
+
+// Float64 returns a field holding a float64
+func Float64(key string, value float64) Field {
+	return Field{Key: key, kind: floatKind, integer: int64(math.Float64bits(value))}
+}
+
+// Bool returns a field holding a bool
+func Bool(key string, value bool) Field {
+	field := Field{Key: key, kind: boolKind}
+	if value {
+		field.integer = 1
+	}
+	return field
+}
+
+// Duration returns a field holding a duration, which is logged like time.Duration.String
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, kind: durationKind, integer: int64(value)}
+}
+
+// Time returns a field holding a time
+func Time(key string, value time.Time) Field {
+	if value.Year() < 1678 || value.Year() > 2261 {
+		// times outside of the range of UnixNano are kept as they are
+		return Any(key, value)
+	}
+	return Field{Key: key, kind: timeKind, integer: value.UnixNano(), reference: value.Location()}
+}
+
+// Err returns a field holding the error with the key "error", its causes and stack trace are logged as well
+func Err(err error) Field {
+	return Field{Key: ErrorField, Value: err}
+}
+
+// Any returns a field holding an arbitrary value
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Object returns a field holding a value that encodes itself as object
+func Object(key string, value ObjectMarshaler) Field {
+	return Field{Key: key, kind: objectKind, reference: value}
+}
+
+// Array returns a field holding a value that encodes itself as array
+func Array(key string, value ArrayMarshaler) Field {
+	return Field{Key: key, kind: arrayKind, reference: value}
+}
+
+// Lazy returns a field whose value is computed by the function once the record is formatted by an output, the
+// function is called at most once per field and not at all if no output formats the record
+func Lazy(key string, value func() interface{}) Field {
+	return Field{Key: key, kind: lazyKind, reference: &lazyValue{compute: func() Field { return Any(key, value()) }}}
+}
+
+// lazyValue computes the field of a lazy field once
+type lazyValue struct {
+	once    sync.Once
+	compute func() Field
+	field   Field
+}
+
+func (value *lazyValue) get() Field {
+	value.once.Do(func() {
+		value.field, value.compute = value.compute(), nil
+	})
+	return value.field
+}
+
+// resolve returns the computed field of lazy fields and the field itself otherwise
+func (field Field) resolve() Field {
+	if field.kind == lazyKind {
+		return field.reference.(*lazyValue).get()
+	}
+	return field
+}
+
+// Interface returns the value of the field, typed values are converted to their Go type and objects, arrays and
+// rendered structs to maps and slices
+func (field Field) Interface() interface{} {
+	switch field.kind {
+	case stringKind:
+		return field.text
+	case intKind:
+		return field.integer
+	case floatKind:
+		return math.Float64frombits(uint64(field.integer))
+	case boolKind:
+		return field.integer == 1
+	case durationKind:
+		return time.Duration(field.integer)
+	case timeKind:
+		return field.time()
+	case objectKind:
+		encoder := &fieldEncoder{format: boxedFormat, object: map[string]interface{}{}}
+		if err := field.reference.(ObjectMarshaler).MarshalLogObject(encoder); err != nil {
+			return err.Error()
+		}
+		return encoder.object
+	case lazyKind:
+		return field.resolve().Interface()
+	case arrayKind:
+		encoder := &fieldEncoder{format: boxedFormat, isArray: true, array: []interface{}{}}
+		if err := field.reference.(ArrayMarshaler).MarshalLogArray(encoder); err != nil {
+			return err.Error()
+		}
+		return encoder.array
+	default:
+		if rendered, ok := defaultRenderer.renderField(field); ok {
+			return rendered.Interface()
+		}
+		return field.Value
+	}
+}
+
+func (field Field) time() time.Time {
+	return time.Unix(0, field.integer).In(field.reference.(*time.Location))
+}
+
+// encoderFormat is the output produced by a fieldEncoder
+type encoderFormat uint8
+
+const (
+	// jsonFormat appends json objects and arrays
+	jsonFormat encoderFormat = iota
+	// textFormat appends key=value pairs, flattening nested keys and array indices with dots like "user.tags.0=admin"
+	textFormat
+	// boxedFormat collects the values into maps and slices
+	boxedFormat
+)
+
+// fieldEncoder implements ObjectEncoder and ArrayEncoder for all formats
+type fieldEncoder struct {
+	format  encoderFormat
+	isArray bool
+	buf     []byte
+	count   int
+	failed  bool
+
+	// prefix is prepended to the keys of the text format
+	prefix string
+
+	object map[string]interface{}
+	array  []interface{}
+}
+
+func (e *fieldEncoder) AddString(key string, value string)          { e.add(String(key, value)) }
+func (e *fieldEncoder) AddInt(key string, value int)                { e.add(Int(key, value)) }
+func (e *fieldEncoder) AddInt64(key string, value int64)            { e.add(Int64(key, value)) }
+func (e *fieldEncoder) AddFloat64(key string, value float64)        { e.add(Float64(key, value)) }
+func (e *fieldEncoder) AddBool(key string, value bool)              { e.add(Bool(key, value)) }
+func (e *fieldEncoder) AddDuration(key string, value time.Duration) { e.add(Duration(key, value)) }
+func (e *fieldEncoder) AddTime(key string, value time.Time)         { e.add(Time(key, value)) }
+func (e *fieldEncoder) AddAny(key string, value interface{})        { e.add(Any(key, value)) }
+
+func (e *fieldEncoder) AddObject(key string, value ObjectMarshaler) error {
+	return e.add(Object(key, value))
+}
+
+func (e *fieldEncoder) AddArray(key string, value ArrayMarshaler) error {
+	return e.add(Array(key, value))
+}
+
+func (e *fieldEncoder) AppendString(value string)          { e.add(String("", value)) }
+func (e *fieldEncoder) AppendInt(value int)                { e.add(Int("", value)) }
+func (e *fieldEncoder) AppendInt64(value int64)            { e.add(Int64("", value)) }
+func (e *fieldEncoder) AppendFloat64(value float64)        { e.add(Float64("", value)) }
+func (e *fieldEncoder) AppendBool(value bool)              { e.add(Bool("", value)) }
+func (e *fieldEncoder) AppendDuration(value time.Duration) { e.add(Duration("", value)) }
+func (e *fieldEncoder) AppendTime(value time.Time)         { e.add(Time("", value)) }
+func (e *fieldEncoder) AppendAny(value interface{})        { e.add(Any("", value)) }
+
+func (e *fieldEncoder) AppendObject(value ObjectMarshaler) error {
+	return e.add(Object("", value))
+}
+
+func (e *fieldEncoder) AppendArray(value ArrayMarshaler) error {
+	return e.add(Array("", value))
+}
+
+// add encodes the field as key value pair of an object or as element of an array, the error of nested marshalers is
+// returned after their value has been replaced by the error message
+func (e *fieldEncoder) add(field Field) (err error) {
+	switch e.format {
+	case jsonFormat:
+		if e.count > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		if !e.isArray {
+			e.buf = appendJSONString(e.buf, field.Key)
+			e.buf = append(e.buf, ':')
+		}
+		var ok bool
+		if e.buf, ok, err = appendJSONField(e.buf, field); !ok {
+			e.failed = true
+		}
+	case textFormat:
+		key := field.Key
+		if e.isArray {
+			key = strconv.Itoa(e.count)
+		}
+		field.Key = e.prefix + key
+		if e.count > 0 {
+			e.buf = append(e.buf, ' ')
+		}
+		e.buf, err = appendTextField(e.buf, field)
+	case boxedFormat:
+		value := field.Interface()
+		if e.isArray {
+			e.array = append(e.array, value)
+		} else {
+			e.object[field.Key] = value
+		}
+	}
+	e.count++
+	return err
+}
+
+// appendTextField appends the field as key=value pair, objects and arrays are flattened into one pair per value
+func appendTextField(buf []byte, field Field) ([]byte, error) {
+	field = renderField(field.resolve())
+	if field.kind != objectKind && field.kind != arrayKind {
+		buf = append(buf, field.Key...)
+		buf = append(buf, '=')
+		return appendTextFieldValue(buf, field), nil
+	}
+
+	start := len(buf)
+	encoder := &fieldEncoder{format: textFormat, isArray: field.kind == arrayKind, buf: buf, prefix: field.Key + "."}
+	err := field.marshal(encoder)
+	if err != nil {
+		buf = append(encoder.buf[:start], field.Key...)
+		buf = append(buf, '=')
+		return appendQuotedFieldValue(buf, err.Error()), err
+	}
+	if encoder.count == 0 {
+		// empty objects and arrays are kept as pair without value
+		buf = append(encoder.buf, field.Key...)
+		return append(buf, '=', '"', '"'), nil
+	}
+	return encoder.buf, nil
+}
+
+// appendTextFieldValue appends the value of a field that is neither an object nor an array, quoting it where necessary
+func appendTextFieldValue(buf []byte, field Field) []byte {
+	switch field.kind {
+	case stringKind:
+		return appendQuotedFieldValue(buf, field.text)
+	case intKind:
+		return strconv.AppendInt(buf, field.integer, 10)
+	case floatKind:
+		return strconv.AppendFloat(buf, math.Float64frombits(uint64(field.integer)), 'g', -1, 64)
+	case boolKind:
+		return strconv.AppendBool(buf, field.integer == 1)
+	case durationKind:
+		return append(buf, time.Duration(field.integer).String()...)
+	case timeKind:
+		return appendQuotedFieldValue(buf, field.time().String())
+	default:
+		return appendFieldValue(buf, field.Value)
+	}
+}
+
+// appendJSONField appends the value of the field encoded like encoding/json would encode the value returned by
+// fieldValue. Nothing is appended if the value can not be encoded, errors of marshalers replace their value.
+func appendJSONField(buf []byte, field Field) ([]byte, bool, error) {
+	switch field.kind {
+	case stringKind:
+		return appendJSONString(buf, field.text), true, nil
+	case intKind:
+		return strconv.AppendInt(buf, field.integer, 10), true, nil
+	case floatKind:
+		buf, ok := appendJSONFloat(buf, math.Float64frombits(uint64(field.integer)))
+		return buf, ok, nil
+	case boolKind:
+		return strconv.AppendBool(buf, field.integer == 1), true, nil
+	case durationKind:
+		return appendJSONString(buf, time.Duration(field.integer).String()), true, nil
+	case timeKind:
+		buf = append(buf, '"')
+		buf = field.time().AppendFormat(buf, time.RFC3339Nano)
+		return append(buf, '"'), true, nil
+	case objectKind, arrayKind:
+		start := len(buf)
+		open, close := byte('{'), byte('}')
+		if field.kind == arrayKind {
+			open, close = '[', ']'
+		}
+		encoder := &fieldEncoder{format: jsonFormat, isArray: field.kind == arrayKind, buf: append(buf, open)}
+		err := field.marshal(encoder)
+		if err != nil {
+			return appendJSONString(encoder.buf[:start], err.Error()), true, err
+		}
+		return append(encoder.buf, close), !encoder.failed, nil
+	case lazyKind:
+		return appendJSONField(buf, field.resolve())
+	default:
+		if rendered, ok := defaultRenderer.renderField(field); ok {
+			return appendJSONField(buf, rendered)
+		}
+		if details, ok := errorDetailsValue(field.Value); ok {
+			buf, ok := appendJSONValue(buf, details)
+			return buf, ok, nil
+		}
+		buf, ok := appendJSONValue(buf, fieldValue(field.Value))
+		return buf, ok, nil
+	}
+}
+
+// marshal calls the marshaler of object and array fields with the encoder
+func (field Field) marshal(encoder *fieldEncoder) error {
+	if field.kind == arrayKind {
+		return field.reference.(ArrayMarshaler).MarshalLogArray(encoder)
+	}
+	return field.reference.(ObjectMarshaler).MarshalLogObject(encoder)
+}
@@ -0,0 +1,169 @@
+package log_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+type testAddress struct {
+	City string
+	Zip  int
+}
+
+func (address testAddress) MarshalLogObject(encoder log.ObjectEncoder) error {
+	encoder.AddString("city", address.City)
+	encoder.AddInt("zip", address.Zip)
+	return nil
+}
+
+type testAccount struct {
+	Name    string
+	Admin   bool
+	Address testAddress
+	Roles   testRoles
+}
+
+func (account testAccount) MarshalLogObject(encoder log.ObjectEncoder) error {
+	encoder.AddString("name", account.Name)
+	encoder.AddBool("admin", account.Admin)
+	if err := encoder.AddObject("address", account.Address); err != nil {
+		return err
+	}
+	return encoder.AddArray("roles", account.Roles)
+}
+
+type testRoles []string
+
+func (roles testRoles) MarshalLogArray(encoder log.ArrayEncoder) error {
+	for _, role := range roles {
+		encoder.AppendString(role)
+	}
+	return nil
+}
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalLogObject(encoder log.ObjectEncoder) error {
+	encoder.AddString("partial", "value")
+	return errors.New("marshaling failed")
+}
+
+var testAccountValue = testAccount{Name: "alice", Admin: true, Address: testAddress{City: "Berlin", Zip: 10115}, Roles: testRoles{"admin", "dev ops"}}
+
+func typedTestFields() []log.Field {
+	return []log.Field{
+		log.String("user", "alice smith"),
+		log.Int("attempt", 3),
+		log.Float64("ratio", 0.25),
+		log.Bool("cached", false),
+		log.Duration("elapsed", 1500*time.Millisecond),
+		log.Time("since", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)),
+		log.Err(errors.New("timeout")),
+		log.Any("tags", []string{"a", "b"}),
+	}
+}
+
+func prepareTestFieldLogger(formatter log.Formatter) (*log.Logger, *strings.Builder) {
+	output := &strings.Builder{}
+	logger := log.NewLogger()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{output: formatter})
+	return logger, output
+}
+
+func TestTypedFieldsJSON(t *testing.T) {
+	logger, output := prepareTestFieldLogger(prepareTestErrorJSONFormatter())
+
+	logger.WithFields(typedTestFields()...).Info("typed")
+	assert.Equal(t, `{"attempt":3,"cached":false,"elapsed":"1.5s","error":"timeout","level":"INFO","msg":"typed",`+
+		`"ratio":0.25,"since":"2006-01-02T15:04:05Z","tags":["a","b"],"user":"alice smith"}`+"\n", output.String())
+}
+
+func TestTypedFieldsLogfmt(t *testing.T) {
+	logger, output := prepareTestRedactionLogger()
+	logger.SetRedactor(nil)
+
+	logger.WithFields(typedTestFields()...).Info("typed")
+	assert.Equal(t, `level=INFO msg=typed user="alice smith" attempt=3 ratio=0.25 cached=false elapsed=1.5s `+
+		`since="2006-01-02 15:04:05 +0000 UTC" error=timeout tags.0=a tags.1=b`+"\n", output.String())
+}
+
+func TestTypedFieldsMatchAny(t *testing.T) {
+	logger, output := prepareTestRedactionLogger()
+	logger.SetRedactor(nil)
+	since := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	logger.WithFields(log.String("user", "alice smith"), log.Int("attempt", 3), log.Duration("elapsed", time.Second), log.Time("since", since)).Info("typed")
+	logger.WithFields(log.Any("user", "alice smith"), log.Any("attempt", 3), log.Any("elapsed", time.Second), log.Any("since", since)).Info("typed")
+
+	lines := strings.Split(output.String(), "\n")
+	assert.Equal(t, lines[0], lines[1])
+}
+
+func TestObjectFieldJSON(t *testing.T) {
+	logger, output := prepareTestFieldLogger(prepareTestErrorJSONFormatter())
+
+	logger.WithFields(log.Object("account", testAccountValue), log.Array("roles", testAccountValue.Roles)).Info("login")
+	assert.Equal(t, `{"account":{"name":"alice","admin":true,"address":{"city":"Berlin","zip":10115},"roles":["admin","dev ops"]},`+
+		`"level":"INFO","msg":"login","roles":["admin","dev ops"]}`+"\n", output.String())
+}
+
+func TestObjectFieldText(t *testing.T) {
+	logger, output := prepareTestRedactionLogger()
+	logger.SetRedactor(nil)
+
+	logger.WithFields(log.Object("account", testAccountValue), log.Int("attempt", 1)).Info("login")
+	assert.Equal(t, `level=INFO msg=login account.name=alice account.admin=true account.address.city=Berlin `+
+		`account.address.zip=10115 account.roles.0=admin account.roles.1="dev ops" attempt=1`+"\n", output.String())
+
+	formatter := prepareTestDefaultFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	logger, output = prepareTestFieldLogger(formatter)
+	logger.WithFields(log.Object("address", testAccountValue.Address)).Info("moved")
+	assert.Equal(t, "INFO: moved address.city=Berlin address.zip=10115\n", output.String())
+}
+
+func TestObjectFieldError(t *testing.T) {
+	logger, output := prepareTestFieldLogger(prepareTestErrorJSONFormatter())
+	logger.WithFields(log.Object("broken", failingMarshaler{})).Info("broken")
+	assert.Equal(t, `{"broken":"marshaling failed","level":"INFO","msg":"broken"}`+"\n", output.String())
+
+	logger, output = prepareTestRedactionLogger()
+	logger.SetRedactor(nil)
+	logger.WithFields(log.Object("broken", failingMarshaler{}), log.Int("attempt", 1)).Info("broken")
+	assert.Equal(t, `level=INFO msg=broken broken="marshaling failed" attempt=1`+"\n", output.String())
+}
+
+func TestFieldInterface(t *testing.T) {
+	since := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	assert.Equal(t, "alice", log.String("user", "alice").Interface())
+	assert.Equal(t, int64(3), log.Int("attempt", 3).Interface())
+	assert.Equal(t, true, log.Bool("cached", true).Interface())
+	assert.Equal(t, time.Second, log.Duration("elapsed", time.Second).Interface())
+	assert.True(t, since.Equal(log.Time("since", since).Interface().(time.Time)))
+	assert.Equal(t, map[string]interface{}{"city": "Berlin", "zip": int64(10115)}, log.Object("address", testAccountValue.Address).Interface())
+	assert.Equal(t, []interface{}{"admin", "dev ops"}, log.Array("roles", testAccountValue.Roles).Interface())
+	assert.Equal(t, 3, log.Field{Key: "attempt", Value: 3}.Interface())
+}
+
+func TestTypedFieldsRecordOutputs(t *testing.T) {
+	logger := log.NewLogger()
+	output := &recordingOutput{}
+	logger.SetRecordOutputs(output)
+	logger.SetRedactor(log.NewRedactor())
+
+	logger.WithFields(log.String("contact", "jane@example.com"), log.String("password", "hunter2"), log.Object("address", testAccountValue.Address)).Info("signup")
+	output.Flush()
+
+	fields := output.records[0].Fields
+	assert.Equal(t, "[REDACTED]", fields[0].Interface())
+	assert.Equal(t, "[REDACTED]", fields[1].Interface())
+	assert.Equal(t, map[string]interface{}{"city": "Berlin", "zip": int64(10115)}, fields[2].Interface())
+}
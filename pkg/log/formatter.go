@@ -1,8 +1,11 @@
 package log
 
 import (
-	"runtime"
+	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/benbjohnson/clock"
 )
@@ -12,68 +15,106 @@ type Formatter interface {
 	Format(level Level, msg string) (formattedMsg string)
 }
 
-// Helper functions used in the implementation of custom formatters
+// The RecordFormatter interface is implemented by formatters that also render the fields of a record
+type RecordFormatter interface {
+	Formatter
+	FormatRecord(record *Record) (formattedMsg string)
+}
 
-func getTimestamp(clock clock.Clock, layout string) (timestamp string) {
-	return clock.Now().Format(layout)
+// The AppendFormatter interface is implemented by formatters that append the formatted record to a buffer, which
+// allows the logger to reuse its buffers instead of allocating a new string per record
+type AppendFormatter interface {
+	RecordFormatter
+	AppendFormat(buf []byte, record *Record) []byte
 }
 
-func getCallersFullFunctionName() (name string) {
-	functionName, packageName := findInitialCaller()
-	if functionName == "" || packageName == "" {
-		return ""
-	}
+// maxPooledBufferSize limits the size of buffers returned to the pool, so single huge records do not pin their memory
+const maxPooledBufferSize = 64 << 10
 
-	index := strings.LastIndex(packageName, "/")
-	return packageName[index+1:] + "." + functionName
+var bufferPool = sync.Pool{New: func() interface{} {
+	buffer := make([]byte, 0, 1024)
+	return &buffer
+}}
+
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
 }
 
-func getCallersFunctionName() (name string) {
-	functionName, _ := findInitialCaller()
-	if functionName == "" {
-		return ""
+func putBuffer(buffer *[]byte) {
+	if cap(*buffer) <= maxPooledBufferSize {
+		*buffer = (*buffer)[:0]
+		bufferPool.Put(buffer)
 	}
+}
+
+// Helper functions used in the implementation of custom formatters
 
-	return functionName
+func appendTimestamp(buf []byte, clock clock.Clock, layout string) []byte {
+	return clock.Now().AppendFormat(buf, layout)
 }
 
-func getCallersPackageName() (name string) {
-	_, packageName := findInitialCaller()
-	if packageName == "" {
-		return ""
+func appendFullFunctionName(buf []byte, packageName string, functionName string) []byte {
+	if functionName == "" || packageName == "" {
+		return buf
 	}
 
-	return packageName
+	buf = append(buf, packageName[strings.LastIndex(packageName, "/")+1:]...)
+	buf = append(buf, '.')
+	return append(buf, functionName...)
 }
 
-func findInitialCaller() (functionName string, packageName string) {
-	_, currentPackageName := getCallerInformation(0)
-	i := 1
-	for {
-		functionName, packageName = getCallerInformation(i)
-		if packageName != currentPackageName || functionName == "" || packageName == "" {
-			return functionName, packageName
-		}
-		i++
+// fieldValue converts a field value into a value that can be encoded by encoding/json
+func fieldValue(value interface{}) interface{} {
+	switch v := resolveLogValue(value).(type) {
+	case json.Marshaler:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
 	}
 }
 
-func getCallerInformation(index int) (functionName string, packageName string) {
-	pc, _, _, ok := runtime.Caller(index)
-	details := runtime.FuncForPC(pc)
-	if !ok && details == nil {
-		return "", ""
+// appendFields renders fields as space separated key=value pairs, quoting values where necessary
+func appendFields(buf []byte, fields []Field) []byte {
+	for i, field := range fields {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf, _ = appendTextField(buf, field)
 	}
-	parts := strings.Split(details.Name(), ".")
-	packageName = ""
-	functionName = parts[len(parts)-1]
-
-	if parts[len(parts)-2][0] == '(' {
-		functionName = parts[len(parts)-2] + "." + functionName
-		packageName = strings.Join(parts[0:len(parts)-2], ".")
-	} else {
-		packageName = strings.Join(parts[0:len(parts)-1], ".")
+	return buf
+}
+
+// appendFieldValue renders a field value like fmt.Sprint, quoting it where necessary
+func appendFieldValue(buf []byte, value interface{}) []byte {
+	switch v := fieldValue(value).(type) {
+	case string:
+		return appendQuotedFieldValue(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	default:
+		return appendQuotedFieldValue(buf, fmt.Sprint(v))
 	}
+}
 
-	return functionName, packageName
+func appendQuotedFieldValue(buf []byte, value string) []byte {
+	if value == "" || strings.ContainsAny(value, " =\"\\\t\r\n") {
+		return strconv.AppendQuote(buf, value)
+	}
+	return append(buf, value...)
 }
@@ -1,9 +1,10 @@
 package log
 
 import (
-	"encoding/csv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/acarl005/stripansi"
 	"github.com/benbjohnson/clock"
@@ -18,6 +19,7 @@ type CSVFormatter struct {
 	CallerDisabled    bool
 }
 
+// NewCSVFormatter initializes a new CSVFormatter
 func NewCSVFormatter() *CSVFormatter {
 	return &CSVFormatter{
 		ColorsDisabled:  true,
@@ -26,31 +28,80 @@ func NewCSVFormatter() *CSVFormatter {
 	}
 }
 
+// Format formats a single log message
 func (f *CSVFormatter) Format(level Level, msg string) string {
-	entries := []string{}
+	return f.FormatRecord(&Record{Level: level, Message: msg})
+}
+
+// FormatRecord formats a single log record with its fields as an additional trailing column
+func (f *CSVFormatter) FormatRecord(record *Record) string {
+	return string(f.AppendFormat(nil, record))
+}
+
+// AppendFormat appends the formatted record to the buffer, quoting columns like encoding/csv
+func (f *CSVFormatter) AppendFormat(buf []byte, record *Record) []byte {
+	level, msg := record.Level, record.Message
 
 	if !f.TimestampDisabled {
-		entries = append(entries, getTimestamp(f.Clock, f.TimestampLayout))
+		start := len(buf)
+		buf = appendTimestamp(buf, f.Clock, f.TimestampLayout)
+		if csvFieldNeedsQuotes(string(buf[start:])) {
+			buf = appendCSVField(buf[:start], string(buf[start:]))
+		}
+		buf = append(buf, ',')
 	}
 
-	entries = append(entries, level.String())
+	buf = appendCSVField(buf, level.String())
 
 	if !f.CallerDisabled {
-		entries = append(entries, getCallersPackageName())
-		entries = append(entries, getCallersFunctionName())
+		record.resolveCaller()
+		buf = append(buf, ',')
+		buf = appendCSVField(buf, record.Package)
+		buf = append(buf, ',')
+		buf = appendCSVField(buf, record.Function)
 	}
 
 	if f.ColorsDisabled {
-		entries = append(entries, stripansi.Strip(msg))
-	} else {
-		entries = append(entries, msg)
+		msg = stripansi.Strip(msg)
+	}
+	buf = append(buf, ',')
+	buf = appendCSVField(buf, msg)
+
+	if len(record.Fields) > 0 {
+		buf = append(buf, ',')
+		start := len(buf)
+		buf = appendFields(buf, record.Fields)
+		if fields := string(buf[start:]); csvFieldNeedsQuotes(fields) {
+			buf = appendCSVField(buf[:start], fields)
+		}
+	}
+
+	return append(buf, '\n')
+}
+
+// appendCSVField appends the field, quoting it if necessary like csv.Writer with the default settings
+func appendCSVField(buf []byte, field string) []byte {
+	if !csvFieldNeedsQuotes(field) {
+		return append(buf, field...)
 	}
 
-	buffer := &strings.Builder{}
-	writer := csv.NewWriter(buffer)
-	if err := writer.Write(entries); err != nil {
-		return err.Error()
+	buf = append(buf, '"')
+	for i := 0; i < len(field); i++ {
+		if field[i] == '"' {
+			buf = append(buf, '"')
+		}
+		buf = append(buf, field[i])
+	}
+	return append(buf, '"')
+}
+
+func csvFieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsAny(field, ",\"\r\n") {
+		return true
 	}
-	writer.Flush()
-	return buffer.String()
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
 }
@@ -1,7 +1,9 @@
 package log_test
 
 import (
+	"encoding/csv"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -93,3 +95,21 @@ func TestCSVFormatterDisabledCaller(t *testing.T) {
 		assert.Equal(t, testCase.expected, formattedMsg)
 	}
 }
+
+func TestCSVFormatterEncoding(t *testing.T) {
+	formatter := prepareTestCSVFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+
+	messages := []string{"plain", "comma, separated", "\"quoted\"", "line\nbreak", "carriage\rreturn", " leading space", `\.`, ""}
+
+	for _, msg := range messages {
+		record := &log.Record{Level: log.InfoLevel, Message: msg, Fields: []log.Field{{Key: "attempt", Value: 1}, {Key: "note", Value: "a, b"}}}
+
+		expected := &strings.Builder{}
+		writer := csv.NewWriter(expected)
+		writer.Write([]string{"INFO", msg, "attempt=1 note=\"a, b\""})
+		writer.Flush()
+		assert.Equal(t, expected.String(), formatter.FormatRecord(record))
+	}
+}
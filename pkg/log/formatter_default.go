@@ -3,6 +3,7 @@ package log
 import (
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/acarl005/stripansi"
 	"github.com/benbjohnson/clock"
@@ -17,6 +18,8 @@ type DefaultFormatter struct {
 	TimestampLayout   string
 	Clock             clock.Clock
 	CallerDisabled    bool
+	CallerLocation    bool
+	Sanitize          SanitizeMode
 }
 
 // NewDefaultFormatter initializes a new DefaultFormatter
@@ -34,31 +37,67 @@ func NewDefaultFormatter() (f *DefaultFormatter) {
 
 // Format formats a single log message
 func (f *DefaultFormatter) Format(level Level, msg string) (formattedMsg string) {
-	entry := &strings.Builder{}
+	return f.FormatRecord(&Record{Level: level, Message: msg})
+}
+
+// FormatRecord formats a single log record with its fields appended to the message
+func (f *DefaultFormatter) FormatRecord(record *Record) (formattedMsg string) {
+	return string(f.AppendFormat(nil, record))
+}
+
+// AppendFormat appends the formatted record to the buffer
+func (f *DefaultFormatter) AppendFormat(buf []byte, record *Record) []byte {
+	level, msg := record.Level, record.Message
+	start := len(buf)
 
 	if !f.TimestampDisabled {
-		entry.WriteString(getTimestamp(f.Clock, f.TimestampLayout))
-		entry.WriteString(" ")
+		buf = appendTimestamp(buf, f.Clock, f.TimestampLayout)
+		buf = append(buf, ' ')
 	}
 
 	if f.ColorsDisabled {
-		entry.WriteString(level.String())
+		buf = append(buf, level.String()...)
 	} else {
-		entry.WriteString(f.Colors[level].Render(center(level.String(), 9)))
+		buf = append(buf, f.Colors[level].Render(center(level.String(), 9))...)
 	}
 
 	if !f.CallerDisabled {
-		entry.WriteString(" <")
-		entry.WriteString(getCallersFullFunctionName())
-		entry.WriteString(">")
+		buf = append(buf, " <"...)
+		record.resolveCaller()
+		buf = appendFullFunctionName(buf, record.Package, record.Function)
+		if f.CallerLocation && record.Caller != nil && record.Caller.File != "" {
+			buf = append(buf, ' ')
+			buf = append(buf, record.Caller.Location()...)
+		}
+		buf = append(buf, '>')
 	}
-	entry.WriteString(": ")
+	buf = append(buf, ": "...)
+	header := len(buf)
 
 	if f.ColorsDisabled {
 		msg = stripansi.Strip(msg)
 	}
+	buf = append(buf, msg...)
 
-	return entry.String() + msg + "\n"
+	if len(record.Fields) > 0 {
+		buf = append(buf, ' ')
+		buf = appendFields(buf, record.Fields)
+	}
+
+	if f.Sanitize != SanitizeOff {
+		// only the message and fields are sanitized, so the colors of the level are kept
+		indent := strings.Repeat(" ", utf8.RuneCountInString(stripansi.Strip(string(buf[start:header]))))
+		buf = append(buf[:header], sanitize(string(buf[header:]), f.Sanitize, indent)...)
+	}
+	buf = append(buf, '\n')
+
+	// errors with causes or stack traces are written as an indented block below the entry
+	for _, field := range record.Fields {
+		if details, ok := errorDetailsValue(field.resolve().Value); ok {
+			buf = details.appendBlock(buf, field.Key, "    ", f.Sanitize)
+		}
+	}
+	return buf
 }
 
 func center(s string, w int) string {
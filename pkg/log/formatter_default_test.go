@@ -117,3 +117,39 @@ func TestDefaultFormatterCustomTimestamp(t *testing.T) {
 		assert.Equal(t, testCase.expected, formattedMsg)
 	}
 }
+
+func TestDefaultFormatterSanitize(t *testing.T) {
+	formatter := prepareTestDefaultFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+
+	msg := "login failed\n2006-01-02 15:04:05 INFO: login succeeded\r\x1b[31mred\x1b[0m \x00\u202e"
+	fields := []log.Field{{Key: "user", Value: "bob\x1b[2J"}}
+
+	testCases := []struct {
+		mode     log.SanitizeMode
+		expected string
+	}{
+		{log.SanitizeEscape, `INFO: login failed\n2006-01-02 15:04:05 INFO: login succeeded\rred \x00\u202e user=bob\x1b[2J` + "\n"},
+		{log.SanitizeStrip, `INFO: login failed\n2006-01-02 15:04:05 INFO: login succeeded\rred \x00\u202e user=bob` + "\n"},
+		{log.SanitizeMultiline, "INFO: login failed\n      2006-01-02 15:04:05 INFO: login succeeded\\rred \\x00\\u202e user=bob\n"},
+	}
+
+	for _, testCase := range testCases {
+		formatter.Sanitize = testCase.mode
+		formattedMsg := formatter.FormatRecord(&log.Record{Level: log.InfoLevel, Message: msg, Fields: fields})
+
+		assert.Equal(t, testCase.expected, formattedMsg)
+	}
+}
+
+func TestDefaultFormatterSanitizeKeepsColors(t *testing.T) {
+	formatter := prepareTestDefaultFormatter()
+	formatter.ColorsDisabled = false
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	formatter.Sanitize = log.SanitizeStrip
+
+	formattedMsg := formatter.Format(log.ErrorLevel, "\x1b[32mfake\x1b[0m")
+	assert.Equal(t, formatter.Colors[log.ErrorLevel].Render("  ERROR  ")+": fake\n", formattedMsg)
+}
@@ -1,9 +1,12 @@
 package log
 
 import (
+	"bytes"
 	"encoding/json"
-	"strings"
+	"math"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/acarl005/stripansi"
 	"github.com/benbjohnson/clock"
@@ -16,6 +19,7 @@ type JSONFormatter struct {
 	TimestampLayout   string
 	Clock             clock.Clock
 	CallerDisabled    bool
+	CallerLocation    bool
 	PrettyPrint       bool
 }
 
@@ -30,31 +34,231 @@ func NewJSONFormatter() *JSONFormatter {
 
 // Format formats a single log message
 func (f *JSONFormatter) Format(level Level, msg string) string {
-	entries := map[string]string{}
+	return f.FormatRecord(&Record{Level: level, Message: msg})
+}
+
+// FormatRecord formats a single log record with its fields as additional object keys
+func (f *JSONFormatter) FormatRecord(record *Record) string {
+	return string(f.AppendFormat(nil, record))
+}
+
+// jsonEntry is a key of the formatted object with either a text or a field value
+type jsonEntry struct {
+	key     string
+	text    string
+	field   Field
+	isField bool
+	time    time.Time
+	isTime  bool
+}
+
+// AppendFormat appends the formatted record to the buffer, the keys of the object are sorted like encoding/json does
+// for maps. Nothing is appended if a field value can not be encoded.
+func (f *JSONFormatter) AppendFormat(buf []byte, record *Record) []byte {
+	level, msg := record.Level, record.Message
+	var storage [16]jsonEntry
+	entries := storage[:0]
 
 	if !f.TimestampDisabled {
-		entries["time"] = getTimestamp(f.Clock, f.TimestampLayout)
+		entries = append(entries, jsonEntry{key: "time", time: f.Clock.Now(), isTime: true})
 	}
 
 	if !f.CallerDisabled {
-		entries["package"] = getCallersPackageName()
-		entries["function"] = getCallersFunctionName()
+		record.resolveCaller()
+		entries = append(entries, jsonEntry{key: "package", text: record.Package}, jsonEntry{key: "function", text: record.Function})
+		if f.CallerLocation && record.Caller != nil && record.Caller.File != "" {
+			entries = append(entries, jsonEntry{key: "file", text: record.Caller.File}, jsonEntry{key: "line", field: Int("line", record.Caller.Line), isField: true})
+		}
 	}
 
-	entries["level"] = level.String()
+	entries = append(entries, jsonEntry{key: "level", text: level.String()})
 	if f.CallerDisabled {
-		entries["msg"] = stripansi.Strip(msg)
+		entries = append(entries, jsonEntry{key: "msg", text: stripansi.Strip(msg)})
 	} else {
-		entries["msg"] = msg
+		entries = append(entries, jsonEntry{key: "msg", text: msg})
+	}
+
+	for _, field := range record.Fields {
+		key := field.Key
+		if jsonEntryIndex(entries, key) >= 0 {
+			key = "fields." + key
+		}
+		entry := jsonEntry{key: key, field: field, isField: true}
+		if index := jsonEntryIndex(entries, key); index >= 0 {
+			entries[index] = entry
+		} else {
+			entries = append(entries, entry)
+		}
 	}
 
-	buffer := &strings.Builder{}
-	encoder := json.NewEncoder(buffer)
+	// insertion sort, as records only have a few keys
+	for i := 1; i < len(entries); i++ {
+		for j := i; j > 0 && entries[j].key < entries[j-1].key; j-- {
+			entries[j], entries[j-1] = entries[j-1], entries[j]
+		}
+	}
+
+	start := len(buf)
+	buf = append(buf, '{')
+	for i, entry := range entries {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = appendJSONString(buf, entry.key)
+		buf = append(buf, ':')
+		if entry.isTime {
+			buf = appendJSONTime(buf, entry.time, f.TimestampLayout)
+			continue
+		}
+		if !entry.isField {
+			buf = appendJSONString(buf, entry.text)
+			continue
+		}
+		var ok bool
+		if buf, ok, _ = appendJSONField(buf, entry.field); !ok {
+			return buf[:start]
+		}
+	}
+	buf = append(buf, '}')
+
 	if f.PrettyPrint {
-		encoder.SetIndent("", "\t")
+		indented := &bytes.Buffer{}
+		if err := json.Indent(indented, buf[start:], "", "\t"); err != nil {
+			return buf[:start]
+		}
+		buf = append(buf[:start], indented.Bytes()...)
 	}
-	if err := encoder.Encode(entries); err != nil {
-		return ""
+	return append(buf, '\n')
+}
+
+// appendJSONTime appends the time formatted with the layout as string, it is formatted directly into the buffer unless
+// the layout produces characters that have to be escaped
+func appendJSONTime(buf []byte, t time.Time, layout string) []byte {
+	start := len(buf)
+	buf = t.AppendFormat(append(buf, '"'), layout)
+	for _, c := range buf[start+1:] {
+		if c < 0x20 || c >= utf8.RuneSelf || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			return appendJSONString(buf[:start], string(buf[start+1:]))
+		}
+	}
+	return append(buf, '"')
+}
+
+func jsonEntryIndex(entries []jsonEntry, key string) int {
+	for i, entry := range entries {
+		if entry.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendJSONValue appends the value encoded like encoding/json, strings and integers are encoded directly
+func appendJSONValue(buf []byte, value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "null"...), true
+	case string:
+		return appendJSONString(buf, v), true
+	case bool:
+		return strconv.AppendBool(buf, v), true
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10), true
+	case int64:
+		return strconv.AppendInt(buf, v, 10), true
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10), true
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10), true
+	case uint64:
+		return strconv.AppendUint(buf, v, 10), true
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10), true
+	case float64:
+		return appendJSONFloat(buf, v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return buf, false
+		}
+		return append(buf, encoded...), true
+	}
+}
+
+// appendJSONFloat appends the float like encoding/json, which uses the exponent format only for very small and large
+// numbers and fails for NaN and infinite values
+func appendJSONFloat(buf []byte, value float64) ([]byte, bool) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return buf, false
+	}
+
+	format := byte('f')
+	if abs := math.Abs(value); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	buf = strconv.AppendFloat(buf, value, format, -1, 64)
+	if format == 'e' {
+		// shorten e-09 to e-9
+		if n := len(buf); n >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+	}
+	return buf, true
+}
+
+const jsonHex = "0123456789abcdef"
+
+// appendJSONString appends the string as quoted json string, escaping it like encoding/json including the escaping
+// of html characters
+func appendJSONString(buf []byte, value string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(value); {
+		if c := value[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			buf = append(buf, value[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\b':
+				buf = append(buf, '\\', 'b')
+			case '\f':
+				buf = append(buf, '\\', 'f')
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', jsonHex[c>>4], jsonHex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(value[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, value[start:i]...)
+			buf = append(buf, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, value[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', jsonHex[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
 	}
-	return buffer.String()
+	buf = append(buf, value[start:]...)
+	return append(buf, '"')
 }
@@ -1,7 +1,9 @@
 package log_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -118,3 +120,70 @@ func TestJSONFormatterPrettyPrint(t *testing.T) {
 		assert.Equal(t, testCase.expected, formattedMsg)
 	}
 }
+
+func TestJSONFormatterFields(t *testing.T) {
+	formatter := prepareTestJSONFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+
+	record := &log.Record{
+		Level:   log.InfoLevel,
+		Message: "this is a test message",
+		Fields: []log.Field{
+			{Key: "attempt", Value: 3},
+			{Key: "err", Value: fmt.Errorf("connection refused")},
+			{Key: "level", Value: "custom"},
+		},
+	}
+	expected := "{\"attempt\":3,\"err\":\"connection refused\",\"fields.level\":\"custom\",\"level\":\"INFO\",\"msg\":\"this is a test message\"}\n"
+
+	assert.Equal(t, expected, formatter.FormatRecord(record))
+}
+
+func TestJSONFormatterEncoding(t *testing.T) {
+	formatter := prepareTestJSONFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+
+	values := []interface{}{
+		"quotes \" and \\ backslashes", "<html> & entities", "control \x00\x01\b\f\n\r\t\x1f characters",
+		"invalid \xff utf-8", "separators    ", "unicode äöü 日本", "",
+		-42, int64(1) << 62, uint(7), 3.25, 1e21, true, nil, []int{1, 2}, map[string]int{"b": 2, "a": 1},
+		time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+	}
+
+	for _, value := range values {
+		record := &log.Record{Level: log.InfoLevel, Message: "message", Fields: []log.Field{{Key: "value", Value: value}}}
+
+		expected := &strings.Builder{}
+		json.NewEncoder(expected).Encode(map[string]interface{}{"level": "INFO", "msg": "message", "value": value})
+		assert.Equal(t, expected.String(), formatter.FormatRecord(record))
+	}
+}
+
+func TestJSONFormatterTimestampEncoding(t *testing.T) {
+	formatter := prepareTestJSONFormatter()
+	formatter.CallerDisabled = true
+
+	// timestamps are formatted directly into the buffer, unless the layout requires escaping
+	for _, layout := range []string{time.RFC3339Nano, `"2006" <01> \02`, "Mon 2 Jan\t15:04"} {
+		formatter.TimestampLayout = layout
+
+		expected := &strings.Builder{}
+		json.NewEncoder(expected).Encode(map[string]interface{}{"level": "INFO", "msg": "message", "time": formatter.Clock.Now().Format(layout)})
+		assert.Equal(t, expected.String(), formatter.FormatRecord(&log.Record{Level: log.InfoLevel, Message: "message"}))
+	}
+}
+
+func TestJSONFormatterAppendFormat(t *testing.T) {
+	formatter := prepareTestJSONFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+
+	buf := formatter.AppendFormat([]byte("prefix "), &log.Record{Level: log.InfoLevel, Message: "message"})
+	assert.Equal(t, "prefix {\"level\":\"INFO\",\"msg\":\"message\"}\n", string(buf))
+
+	// nothing is appended if a field can not be encoded
+	buf = formatter.AppendFormat([]byte("prefix "), &log.Record{Level: log.InfoLevel, Fields: []log.Field{{Key: "channel", Value: make(chan int)}}})
+	assert.Equal(t, "prefix ", string(buf))
+}
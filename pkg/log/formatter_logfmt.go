@@ -0,0 +1,75 @@
+package log
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/acarl005/stripansi"
+	"github.com/benbjohnson/clock"
+)
+
+// LogfmtFormatter formats log to logfmt lines with timestamp, log level, package, function, message and fields
+type LogfmtFormatter struct {
+	ColorsDisabled    bool
+	TimestampDisabled bool
+	TimestampLayout   string
+	Clock             clock.Clock
+	CallerDisabled    bool
+}
+
+// NewLogfmtFormatter initializes a new LogfmtFormatter
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{
+		ColorsDisabled:  true,
+		TimestampLayout: time.RFC3339,
+		Clock:           clock.New(),
+	}
+}
+
+// Format formats a single log message
+func (f *LogfmtFormatter) Format(level Level, msg string) string {
+	return f.FormatRecord(&Record{Level: level, Message: msg})
+}
+
+// FormatRecord formats a single log record with its fields appended as additional pairs
+func (f *LogfmtFormatter) FormatRecord(record *Record) string {
+	return string(f.AppendFormat(nil, record))
+}
+
+// AppendFormat appends the formatted record to the buffer
+func (f *LogfmtFormatter) AppendFormat(buf []byte, record *Record) []byte {
+	if !f.TimestampDisabled {
+		buf = append(buf, "time="...)
+		start := len(buf)
+		buf = appendTimestamp(buf, f.Clock, f.TimestampLayout)
+		if timestamp := buf[start:]; len(timestamp) == 0 || bytes.ContainsAny(timestamp, " =\"\\\t\r\n") {
+			buf = appendQuotedFieldValue(buf[:start], string(timestamp))
+		}
+		buf = append(buf, ' ')
+	}
+
+	buf = append(buf, "level="...)
+	buf = append(buf, record.Level.String()...)
+
+	if !f.CallerDisabled {
+		record.resolveCaller()
+		buf = append(buf, " package="...)
+		buf = appendQuotedFieldValue(buf, record.Package)
+		buf = append(buf, " function="...)
+		buf = appendQuotedFieldValue(buf, record.Function)
+	}
+
+	msg := record.Message
+	if f.ColorsDisabled {
+		msg = stripansi.Strip(msg)
+	}
+	buf = append(buf, " msg="...)
+	buf = appendQuotedFieldValue(buf, msg)
+
+	if len(record.Fields) > 0 {
+		buf = append(buf, ' ')
+		buf = appendFields(buf, record.Fields)
+	}
+
+	return append(buf, '\n')
+}
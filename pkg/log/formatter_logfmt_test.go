@@ -0,0 +1,65 @@
+package log_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+func prepareTestLogfmtFormatter() *log.LogfmtFormatter {
+	clock := clock.NewMock()
+	timestamp, _ := time.Parse(time.RFC3339, "2006-01-02T15:04:05+00:00")
+	clock.Set(timestamp)
+
+	formatter := log.NewLogfmtFormatter()
+	formatter.Clock = clock
+	return formatter
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	formatter := prepareTestLogfmtFormatter()
+
+	msg := "this is a test message"
+	timestamp := "2006-01-02T15:04:05Z"
+	packageName := "github.com/timbasel/go-log/pkg/log_test"
+	functionName := "TestLogfmtFormatter"
+	expectedFormat := "time=%s level=%s package=%s function=%s msg=\"%s\"\n"
+
+	testCases := []struct {
+		level    log.Level
+		expected string
+	}{
+		{log.ErrorLevel, fmt.Sprintf(expectedFormat, timestamp, "ERROR", packageName, functionName, msg)},
+		{log.InfoLevel, fmt.Sprintf(expectedFormat, timestamp, "INFO", packageName, functionName, msg)},
+		{log.DebugLevel, fmt.Sprintf(expectedFormat, timestamp, "DEBUG", packageName, functionName, msg)},
+	}
+
+	for _, testCase := range testCases {
+		formattedMsg := formatter.Format(testCase.level, msg)
+
+		assert.Equal(t, testCase.expected, formattedMsg)
+	}
+}
+
+func TestLogfmtFormatterFields(t *testing.T) {
+	formatter := prepareTestLogfmtFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+
+	record := &log.Record{
+		Level:   log.InfoLevel,
+		Message: "done",
+		Fields: []log.Field{
+			{Key: "user", Value: "alice"},
+			{Key: "query", Value: "a=b"},
+			{Key: "empty", Value: ""},
+		},
+	}
+	expected := "level=INFO msg=done user=alice query=\"a=b\" empty=\"\"\n"
+
+	assert.Equal(t, expected, formatter.FormatRecord(record))
+}
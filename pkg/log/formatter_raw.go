@@ -5,6 +5,7 @@ import "github.com/acarl005/stripansi"
 // RawFormatter formats log to just the message
 type RawFormatter struct {
 	ColorsDisabled bool
+	Sanitize       SanitizeMode
 }
 
 // NewRawFormatter initializes a new RawFormatter
@@ -14,9 +15,23 @@ func NewRawFormatter() (f *RawFormatter) {
 
 // Format formats a single log message
 func (f *RawFormatter) Format(level Level, msg string) string {
+	return f.FormatRecord(&Record{Level: level, Message: msg})
+}
+
+// FormatRecord formats the message of a single log record
+func (f *RawFormatter) FormatRecord(record *Record) string {
+	return string(f.AppendFormat(nil, record))
+}
+
+// AppendFormat appends the formatted message of the record to the buffer
+func (f *RawFormatter) AppendFormat(buf []byte, record *Record) []byte {
+	msg := record.Message
 	if f.ColorsDisabled {
-		return stripansi.Strip(msg) + "\n"
-	} else {
-		return msg + "\n"
+		msg = stripansi.Strip(msg)
 	}
+	buf = append(buf, sanitize(msg, f.Sanitize, rawContinuationIndent)...)
+	return append(buf, '\n')
 }
+
+// rawContinuationIndent indents the continuation lines of sanitized multiline messages
+const rawContinuationIndent = "    "
@@ -27,3 +27,26 @@ func TestRawFormatter(t *testing.T) {
 		assert.Equal(t, testCase.expected, formattedMsg)
 	}
 }
+
+func TestRawFormatterSanitize(t *testing.T) {
+	formatter := log.NewRawFormatter()
+
+	msg := "first line\nsecond line\x1b[1m\n"
+
+	testCases := []struct {
+		mode     log.SanitizeMode
+		expected string
+	}{
+		{log.SanitizeOff, msg + "\n"},
+		{log.SanitizeEscape, `first line\nsecond line\x1b[1m\n` + "\n"},
+		{log.SanitizeStrip, `first line\nsecond line\n` + "\n"},
+		{log.SanitizeMultiline, "first line\n    second line\n"},
+	}
+
+	for _, testCase := range testCases {
+		formatter.Sanitize = testCase.mode
+		formattedMsg := formatter.Format(log.InfoLevel, msg)
+
+		assert.Equal(t, testCase.expected, formattedMsg)
+	}
+}
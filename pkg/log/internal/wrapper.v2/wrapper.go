@@ -0,0 +1,20 @@
+// Package wrapper wraps a logger from a package whose import path contains dots, which is used to test the caller lookup
+package wrapper
+
+import "github.com/timbasel/go-log/pkg/log"
+
+// Logger wraps a logger with a value receiver
+type Logger struct {
+	Logger *log.Logger
+}
+
+// Info writes an info message through the wrapped logger
+func (w Logger) Info(msg string) {
+	w.Logger.Info(msg)
+}
+
+// HelperInfo writes an info message through the wrapped logger from a function marked as helper
+func HelperInfo(logger *log.Logger, msg string) {
+	log.Helper()
+	logger.Info(msg)
+}
@@ -0,0 +1,119 @@
+package log_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+func TestDebugFn(t *testing.T) {
+	requireDebug(t)
+	logger, output := prepareTestLogger()
+
+	calls := 0
+	message := func() string {
+		calls++
+		return "expensive message"
+	}
+	fields := func() []log.Field {
+		calls++
+		return []log.Field{log.Int("items", 3)}
+	}
+
+	logger.DebugFn(message)
+	logger.DebugFnFields("expensive fields", fields)
+	assert.Equal(t, 0, calls, "functions must not be called if debug mode is disabled")
+	assert.Equal(t, "", output.String())
+
+	logger.SetDebugMode(true)
+	logger.BlacklistFunctions("TestDebugFn")
+	logger.DebugFn(message)
+	assert.Equal(t, 0, calls, "functions must not be called for blacklisted callers")
+
+	logger.ClearBlacklist()
+	logger.DebugFn(message)
+	logger.DebugFnFields("expensive fields", fields)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "expensive message\nexpensive fields\n", output.String())
+}
+
+func TestEnabled(t *testing.T) {
+	logger, _ := prepareTestLogger()
+
+	assert.True(t, logger.Enabled(log.InfoLevel))
+	assert.True(t, logger.Enabled(log.ErrorLevel))
+	assert.False(t, logger.Enabled(log.DebugLevel))
+
+	requireDebug(t)
+	logger.SetDebugMode(true)
+	assert.True(t, logger.Enabled(log.DebugLevel))
+
+	logger.BlacklistPackages("github.com/timbasel/go-log/pkg/log_test")
+	assert.False(t, logger.Enabled(log.DebugLevel))
+	logger.ClearBlacklist()
+
+	logger.WhitelistFunctions("TestEnabled")
+	assert.True(t, logger.Enabled(log.DebugLevel))
+	func() {
+		assert.False(t, logger.Enabled(log.DebugLevel))
+	}()
+
+	// nothing is written without outputs
+	logger.ClearOutputs()
+	assert.False(t, logger.Enabled(log.ErrorLevel))
+}
+
+func TestEnabledConcurrent(t *testing.T) {
+	logger, output := prepareTestLogger()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			logger.ClearOutputs()
+			logger.SetFormattedOutputs(map[io.Writer]log.Formatter{output: log.NewRawFormatter()})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		logger.Enabled(log.InfoLevel)
+	}
+	<-done
+}
+
+func TestLazyField(t *testing.T) {
+	first, second := &strings.Builder{}, &strings.Builder{}
+	formatter := log.NewLogfmtFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	formatter.ColorsDisabled = true
+
+	logger := log.NewLogger()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{first: formatter, second: log.NewJSONFormatter()})
+	logger.SetRedactor(log.NewRedactor())
+
+	calls := 0
+	lazy := log.Lazy("state", func() interface{} {
+		calls++
+		return map[string]interface{}{"items": 3, "password": "hunter2"}
+	})
+
+	logger.WithFields(lazy).Debug("not written")
+	assert.Equal(t, 0, calls, "the value must not be computed if the record is not written")
+
+	logger.WithFields(lazy).Info("written")
+	assert.Equal(t, 1, calls, "the value must only be computed once for all outputs")
+	assert.Equal(t, "level=INFO msg=written state.items=3 state.password=[REDACTED]\n", first.String())
+	assert.Contains(t, second.String(), `"state":{"items":3,"password":"[REDACTED]"}`)
+
+	// outputs that do not format fields do not compute the value
+	raw, _ := prepareTestLogger()
+	raw.WithFields(log.Lazy("state", func() interface{} {
+		calls++
+		return nil
+	})).Info("written")
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 3, log.Lazy("items", func() interface{} { return 3 }).Interface())
+}
@@ -1,6 +1,11 @@
 package log
 
-import "io"
+import (
+	"io"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
 
 var globalLogger = NewDefaultLogger()
 
@@ -14,6 +19,46 @@ func SetFormattedOutputs(outputs map[io.Writer]Formatter) {
 	globalLogger.SetFormattedOutputs(outputs)
 }
 
+// SetRecordOutputs adds the provided RecordWriters to the outputs of the global logger
+func SetRecordOutputs(outputs ...RecordWriter) {
+	globalLogger.SetRecordOutputs(outputs...)
+}
+
+// SetRedactor sets the redactor applied to all records of the global logger before they are formatted
+func SetRedactor(redactor *Redactor) {
+	globalLogger.SetRedactor(redactor)
+}
+
+// SetRenderer sets the renderer used for structs, maps and slices of fields of the global logger
+func SetRenderer(renderer *Renderer) {
+	globalLogger.SetRenderer(renderer)
+}
+
+// SetSampler sets the sampler that limits the number of similar records of the global logger
+func SetSampler(sampler *Sampler) {
+	globalLogger.SetSampler(sampler)
+}
+
+// SetDeduplicator sets the deduplicator that collapses duplicate records of the global logger
+func SetDeduplicator(deduplicator *Deduplicator) {
+	globalLogger.SetDeduplicator(deduplicator)
+}
+
+// SetClock sets the clock used for the time of records and the intervals of call site helpers of the global logger
+func SetClock(clock clock.Clock) {
+	globalLogger.SetClock(clock)
+}
+
+// SetStackCapture toggles if the stack of the caller is attached to errors logged to the global log that do not carry a stack trace
+func SetStackCapture(state bool) {
+	globalLogger.SetStackCapture(state)
+}
+
+// SetCallerSkip sets the number of additional callers skipped when looking up the caller of records of the global logger
+func SetCallerSkip(skip int) {
+	globalLogger.SetCallerSkip(skip)
+}
+
 // SetDebugMode toggles if debug messages are written to the global loggers outputs
 func SetDebugMode(state bool) {
 	globalLogger.SetDebugMode(state)
@@ -24,6 +69,11 @@ func ClearOutputs() {
 	globalLogger.ClearOutputs()
 }
 
+// Close flushes and closes all record outputs of the global logger
+func Close() error {
+	return globalLogger.Close()
+}
+
 // BlacklistFunctions adds the provided function names to the global loggers debug output blacklist
 func BlacklistFunctions(names ...string) {
 	globalLogger.BlacklistFunctions(names...)
@@ -54,6 +104,11 @@ func ClearWhitelist() {
 	globalLogger.ClearWhitelist()
 }
 
+// WithFields returns an entry that attaches the provided fields to all messages written through it to the global log
+func WithFields(fields ...Field) *Entry {
+	return globalLogger.WithFields(fields...)
+}
+
 // Error writes an error message to the global log
 func Error(msg ...string) {
 	globalLogger.Error(msg...)
@@ -74,14 +129,24 @@ func Infof(format string, arguments ...interface{}) {
 	globalLogger.Infof(format, arguments...)
 }
 
-// Debug writes a debug message to the global log
-func Debug(msg ...string) {
-	globalLogger.Debug(msg...)
+// Enabled reports if messages of the level written by the caller would be written to the global loggers outputs
+func Enabled(level Level) bool {
+	return globalLogger.Enabled(level)
+}
+
+// InfoOnce writes an info message to the global log the first time it is called from a call site
+func InfoOnce(msg ...string) {
+	globalLogger.InfoOnce(msg...)
+}
+
+// InfoEveryN writes an info message to the global log the first and then every n-th time it is called from a call site
+func InfoEveryN(n int, msg ...string) {
+	globalLogger.InfoEveryN(n, msg...)
 }
 
-// Debugf writes a formatted error message to the global log
-func Debugf(format string, arguments ...interface{}) {
-	globalLogger.Debugf(format, arguments...)
+// InfoEvery writes an info message to the global log at most once per interval from a call site
+func InfoEvery(interval time.Duration, msg ...string) {
+	globalLogger.InfoEvery(interval, msg...)
 }
 
 // XDebug disables the Debug function
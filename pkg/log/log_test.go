@@ -8,7 +8,7 @@ import (
 	"github.com/timbasel/go-log/pkg/log"
 )
 
-func ExampleBasic() {
+func Example_basic() {
 	log.SetDebugMode(true)
 
 	// message for the developer debugging the application
@@ -24,7 +24,7 @@ func ExampleBasic() {
 	// Output:
 }
 
-func ExampleConfiguration() {
+func Example_configuration() {
 	// adds locations where the log is written to (by default os.Stdout is set)
 	log.SetOutputs(os.Stdout)
 
@@ -42,7 +42,7 @@ func ExampleConfiguration() {
 	log.ClearBlacklist()
 }
 
-func ExampleCustomLogger() {
+func Example_customLogger() {
 	logger := log.NewDefaultLogger()
 
 	logger.ClearOutputs()
@@ -57,7 +57,7 @@ func (f *CustomFormatter) Format(level log.Level, msg string) (formattedMsg stri
 	return "> " + msg + " [" + level.String() + "]\n"
 }
 
-func ExampleFormatters() {
+func Example_formatters() {
 	logger := log.NewLogger()
 	logger.SetDebugMode(true)
 
@@ -1,18 +1,31 @@
 package log
 
 import (
-	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
+
+	"github.com/benbjohnson/clock"
 )
 
 // A Logger writes formatted messages to the set of outputs.
 type Logger struct {
-	mutex sync.Mutex
-
-	outputs map[io.Writer]Formatter
+	mutex sync.RWMutex
+
+	outputs       map[io.Writer]Formatter
+	writeMutexes  map[io.Writer]*sync.Mutex
+	recordOutputs []RecordWriter
+	redactor      *Redactor
+	renderer      *Renderer
+	sampler       *Sampler
+	stopReports   func()
+	deduplicator  *Deduplicator
+	stopSummaries func()
+	clock         clock.Clock
+	callSites     sync.Map
+	stackCapture  bool
+	callerSkip    int
 
 	debugMode          bool
 	blacklistFunctions []string
@@ -25,6 +38,9 @@ type Logger struct {
 func NewLogger() (logger *Logger) {
 	return &Logger{
 		outputs:            map[io.Writer]Formatter{},
+		writeMutexes:       map[io.Writer]*sync.Mutex{},
+		renderer:           NewRenderer(),
+		clock:              clock.New(),
 		blacklistFunctions: []string{},
 		blacklistPackages:  []string{},
 		whitelistFunctions: []string{},
@@ -45,7 +61,7 @@ func (logger *Logger) SetOutputs(outputs ...io.Writer) {
 	defer logger.mutex.Unlock()
 
 	for _, output := range outputs {
-		logger.outputs[output] = NewDefaultFormatter()
+		logger.addOutput(output, NewDefaultFormatter())
 	}
 }
 
@@ -55,16 +71,143 @@ func (logger *Logger) SetFormattedOutputs(outputs map[io.Writer]Formatter) {
 	defer logger.mutex.Unlock()
 
 	for writer, formatter := range outputs {
-		logger.outputs[writer] = formatter
+		logger.addOutput(writer, formatter)
 	}
 }
 
+// addOutput sets the formatter of the writer, writes to the same writer are serialized as io.Writers are not required
+// to be safe for concurrent use
+func (logger *Logger) addOutput(writer io.Writer, formatter Formatter) {
+	logger.outputs[writer] = formatter
+	if _, ok := logger.writeMutexes[writer]; !ok {
+		logger.writeMutexes[writer] = &sync.Mutex{}
+	}
+}
+
+// SetRecordOutputs adds the provided RecordWriters to the loggers outputs
+func (logger *Logger) SetRecordOutputs(outputs ...RecordWriter) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.recordOutputs = append(logger.recordOutputs, outputs...)
+}
+
 // ClearOutputs removes all set outputs from the logger
 func (logger *Logger) ClearOutputs() {
 	logger.mutex.Lock()
 	defer logger.mutex.Unlock()
 
 	logger.outputs = map[io.Writer]Formatter{}
+	logger.writeMutexes = map[io.Writer]*sync.Mutex{}
+	logger.recordOutputs = nil
+}
+
+// Close writes the pending reports of the sampler and summaries of the deduplicator and flushes and closes all record
+// outputs of the logger that implement io.Closer
+func (logger *Logger) Close() (err error) {
+	// the reports are written without holding the lock, since writing records acquires it
+	logger.mutex.RLock()
+	sampler, stopReports, deduplicator, stopSummaries := logger.sampler, logger.stopReports, logger.deduplicator, logger.stopSummaries
+	logger.mutex.RUnlock()
+
+	if sampler != nil {
+		stopReports()
+		logger.writeSamplingReports(sampler.flush())
+	}
+	if deduplicator != nil {
+		stopSummaries()
+		logger.writeSummaries(deduplicator.flush())
+	}
+
+	logger.mutex.RLock()
+	defer logger.mutex.RUnlock()
+	for _, output := range logger.recordOutputs {
+		if closer, ok := output.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+// SetRedactor sets the redactor applied to all records before they are formatted, nil disables redaction
+func (logger *Logger) SetRedactor(redactor *Redactor) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.redactor = redactor
+}
+
+// SetRenderer sets the renderer used for structs, maps and slices of fields, nil renders them with the default limits
+func (logger *Logger) SetRenderer(renderer *Renderer) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.renderer = renderer
+}
+
+// SetSampler sets the sampler that limits the number of similar records and starts writing its reports, nil
+// disables sampling
+func (logger *Logger) SetSampler(sampler *Sampler) {
+	logger.mutex.Lock()
+	stopReports := logger.stopReports
+	logger.sampler, logger.stopReports = sampler, nil
+	if sampler != nil {
+		logger.stopReports = startFlushLoop(sampler.Clock, sampler.ReportInterval, func() {
+			logger.writeSamplingReports(sampler.flush())
+		})
+	}
+	logger.mutex.Unlock()
+
+	// the previous reports are stopped without holding the lock, since writing a report acquires it
+	if stopReports != nil {
+		stopReports()
+	}
+}
+
+// SetDeduplicator sets the deduplicator that collapses duplicate records and starts writing the summaries of expired
+// records if it has a window, nil disables deduplication
+func (logger *Logger) SetDeduplicator(deduplicator *Deduplicator) {
+	logger.mutex.Lock()
+	stopSummaries := logger.stopSummaries
+	logger.deduplicator, logger.stopSummaries = deduplicator, nil
+	if deduplicator != nil {
+		logger.stopSummaries = startFlushLoop(deduplicator.Clock, deduplicator.Window, func() {
+			logger.writeSummaries(deduplicator.expire())
+		})
+	}
+	logger.mutex.Unlock()
+
+	// the previous summaries are stopped without holding the lock, since writing a summary acquires it
+	if stopSummaries != nil {
+		stopSummaries()
+	}
+}
+
+// SetClock sets the clock used for the time of records and the intervals of call site helpers like InfoEvery
+func (logger *Logger) SetClock(clock clock.Clock) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.clock = clock
+}
+
+// SetStackCapture toggles if the stack of the caller is attached to logged errors that do not carry a stack trace
+func (logger *Logger) SetStackCapture(state bool) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.stackCapture = state
+}
+
+// SetCallerSkip sets the number of additional callers skipped when looking up the caller of a record, which allows
+// wrapping the logger in functions without attributing all records to the wrapper
+func (logger *Logger) SetCallerSkip(skip int) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.callerSkip = skip
 }
 
 // SetDebugMode toggles if debug messages are written to the loggers outputs
@@ -133,42 +276,62 @@ func (logger *Logger) ClearWhitelist() {
 	logger.whitelistPackages = []string{}
 }
 
+// WithFields returns an entry that attaches the provided fields to all messages written through it
+func (logger *Logger) WithFields(fields ...Field) *Entry {
+	return &Entry{logger: logger, fields: fields}
+}
+
+// Err returns an entry that attaches the error with its causes and stack trace to all messages written through it
+func (logger *Logger) Err(err error) *Entry {
+	return logger.WithFields(Err(err))
+}
+
 // Error writes an error message to the log
 func (logger *Logger) Error(msg ...string) {
-	logger.write(ErrorLevel, strings.Join(msg, " "))
+	message := strings.Join(msg, " ")
+	if sampled, caller := logger.sample(ErrorLevel, message, nil); sampled {
+		logger.write(ErrorLevel, message, nil, caller)
+	}
 }
 
 // Errorf writes a formatted error message to the log
 func (logger *Logger) Errorf(format string, arguments ...interface{}) {
-	logger.write(ErrorLevel, fmt.Sprintf(format, arguments...))
+	if sampled, caller := logger.sample(ErrorLevel, format, nil); sampled {
+		logger.write(ErrorLevel, formatMessage(format, arguments), nil, caller)
+	}
 }
 
 // Info writes an info message to the log
 func (logger *Logger) Info(msg ...string) {
-	logger.write(InfoLevel, strings.Join(msg, " "))
+	message := strings.Join(msg, " ")
+	if sampled, caller := logger.sample(InfoLevel, message, nil); sampled {
+		logger.write(InfoLevel, message, nil, caller)
+	}
 }
 
 // Infof writes a formatted info message to the log
 func (logger *Logger) Infof(format string, arguments ...interface{}) {
-	logger.write(InfoLevel, fmt.Sprintf(format, arguments...))
-}
-
-// Debug writes a debug message to the log
-func (logger *Logger) Debug(msg ...string) {
-	if logger.debugMode {
-		if logger.isWhitelisted() && !logger.isBlacklisted() {
-			logger.write(DebugLevel, strings.Join(msg, " "))
-		}
+	if sampled, caller := logger.sample(InfoLevel, format, nil); sampled {
+		logger.write(InfoLevel, formatMessage(format, arguments), nil, caller)
 	}
 }
 
-// Debugf writes a formatted debug message to the log
-func (logger *Logger) Debugf(format string, arguments ...interface{}) {
-	if logger.debugMode {
-		if logger.isWhitelisted() && !logger.isBlacklisted() {
-			logger.write(DebugLevel, fmt.Sprintf(format, arguments...))
-		}
+// Enabled reports if messages of the level written by the caller would be written to any output, which allows to
+// skip expensive preparations of messages that are discarded. Debug messages are only enabled in debug mode, for
+// callers that pass the blacklist and whitelist and if they are not compiled out by the nolog_debug build tag. There
+// are no per-package levels, packages are only restricted by the blacklist and whitelist.
+func (logger *Logger) Enabled(level Level) bool {
+	logger.mutex.RLock()
+	hasOutputs := len(logger.outputs) > 0 || len(logger.recordOutputs) > 0
+	logger.mutex.RUnlock()
+	if !hasOutputs {
+		return false
 	}
+	if level == DebugLevel {
+		enabled, _ := logger.isDebugEnabled()
+		return enabled
+	}
+	return true
 }
 
 // XDebug disables the Debug method
@@ -177,25 +340,168 @@ func (logger *Logger) XDebug(msg ...string) {}
 // XDebugf disables the Debugf method
 func (logger *Logger) XDebugf(format string, arguments ...interface{}) {}
 
-func (logger *Logger) write(level Level, msg string) {
+// write writes the record to all outputs, the caller is looked up when it is first needed unless it is already known.
+// Records may be written concurrently by the application and the sampling reports, so the outputs are read while
+// holding the lock and writes to the same writer are serialized.
+func (logger *Logger) write(level Level, msg string, fields []Field, caller *Caller) {
+	logger.mutex.RLock()
+	defer logger.mutex.RUnlock()
+
+	if logger.stackCapture {
+		fields = captureErrorStacks(fields)
+	}
+	if logger.renderer != nil {
+		fields = logger.renderer.renderFields(fields)
+	}
+
+	record := &Record{Time: logger.clock.Now(), Level: level, Message: msg, Fields: fields, callerSkip: logger.callerSkip}
+	if caller != nil {
+		record.setCaller(caller)
+	}
+	if logger.redactor != nil {
+		record = logger.redactor.RedactRecord(record)
+	}
+
+	var key string
+	if logger.deduplicator != nil {
+		// duplicates may be compared by their caller and the summaries are attributed to it, so it has to be known
+		record.resolveCaller()
+		key = logger.deduplicator.key(record)
+	}
+
 	for writer, formatter := range logger.outputs {
-		writer.Write([]byte(formatter.Format(level, msg)))
+		mutex := logger.writeMutexes[writer]
+		mutex.Lock()
+		if logger.deduplicator == nil {
+			writeFormatted(writer, formatter, record)
+			mutex.Unlock()
+			continue
+		}
+		duplicate, summaries := logger.deduplicator.check(writer, key, record)
+		for _, summary := range summaries {
+			writeFormatted(writer, formatter, summary)
+		}
+		if !duplicate {
+			writeFormatted(writer, formatter, record)
+		}
+		mutex.Unlock()
+	}
+
+	if len(logger.recordOutputs) > 0 {
+		// record outputs may process the record asynchronously, so the caller has to be known beforehand
+		record.resolveCaller()
+		for _, output := range logger.recordOutputs {
+			if logger.deduplicator == nil {
+				output.WriteRecord(record)
+				continue
+			}
+			duplicate, summaries := logger.deduplicator.check(output, key, record)
+			for _, summary := range summaries {
+				output.WriteRecord(summary)
+			}
+			if !duplicate {
+				output.WriteRecord(record)
+			}
+		}
 	}
 }
 
-func (logger *Logger) isBlacklisted() bool {
-	functionListed := searchFunctionList(logger.blacklistFunctions, getCallersFunctionName())
-	packageListed := searchPackageList(logger.blacklistPackages, getCallersPackageName())
+// writeSummaries writes the summaries of the deduplicator to the outputs they were collapsed for
+func (logger *Logger) writeSummaries(summaries map[interface{}][]*Record) {
+	for output, outputSummaries := range summaries {
+		for _, summary := range outputSummaries {
+			logger.writeTo(output, summary)
+		}
+	}
+}
+
+// writeTo writes the record to the output, which is either a writer or a record output of the logger
+func (logger *Logger) writeTo(output interface{}, record *Record) {
+	logger.mutex.RLock()
+	defer logger.mutex.RUnlock()
+
+	if writer, ok := output.(io.Writer); ok {
+		if formatter, ok := logger.outputs[writer]; ok {
+			mutex := logger.writeMutexes[writer]
+			mutex.Lock()
+			writeFormatted(writer, formatter, record)
+			mutex.Unlock()
+			return
+		}
+	}
+	if output, ok := output.(RecordWriter); ok {
+		output.WriteRecord(record)
+	}
+}
+
+// writeFormatted formats the record with the formatter and writes it to the writer
+func writeFormatted(writer io.Writer, formatter Formatter, record *Record) {
+	switch formatter := formatter.(type) {
+	case AppendFormatter:
+		buffer := getBuffer()
+		*buffer = formatter.AppendFormat(*buffer, record)
+		writer.Write(*buffer)
+		putBuffer(buffer)
+	case RecordFormatter:
+		writer.Write([]byte(formatter.FormatRecord(record)))
+	default:
+		writer.Write([]byte(formatter.Format(record.Level, record.Message)))
+	}
+}
+
+// sample reports if a record of the level with the message template passes the sampler, the caller is looked up if
+// the level is sampled and returned to be reused by the record. Reports of suppressed records that are due are written
+// before the record.
+func (logger *Logger) sample(level Level, template string, caller *Caller) (sampled bool, sampledCaller *Caller) {
+	if logger.sampler == nil {
+		return true, caller
+	}
+	policy, ok := logger.sampler.Policies[level]
+	if !ok {
+		return true, caller
+	}
+
+	if caller == nil {
+		caller = findCaller(logger.callerSkip)
+	}
+	return logger.sampler.sample(level, policy, caller, template), caller
+}
+
+// writeSamplingReports writes the reports of suppressed records attributed to the caller of the suppressed records
+func (logger *Logger) writeSamplingReports(reports []samplingReport) {
+	for _, report := range reports {
+		logger.write(report.level, report.message, []Field{Int(SuppressedField, report.suppressed)}, report.caller)
+	}
+}
+
+// isDebugEnabled reports if debug messages of the caller are written, the caller is only looked up if a blacklist or
+// whitelist is set and returned to be reused by the record
+func (logger *Logger) isDebugEnabled() (enabled bool, caller *Caller) {
+	if !debugCompiled || !logger.debugMode {
+		return false, nil
+	}
+	if len(logger.blacklistFunctions) < 1 && len(logger.blacklistPackages) < 1 &&
+		len(logger.whitelistFunctions) < 1 && len(logger.whitelistPackages) < 1 {
+		return true, nil
+	}
+
+	caller = findCaller(logger.callerSkip)
+	return logger.isWhitelisted(caller) && !logger.isBlacklisted(caller), caller
+}
+
+func (logger *Logger) isBlacklisted(caller *Caller) bool {
+	functionListed := searchFunctionList(logger.blacklistFunctions, caller.QualifiedFunction())
+	packageListed := searchPackageList(logger.blacklistPackages, caller.Package)
 	return functionListed || packageListed
 }
 
-func (logger *Logger) isWhitelisted() bool {
+func (logger *Logger) isWhitelisted(caller *Caller) bool {
 	if len(logger.whitelistFunctions) < 1 && len(logger.whitelistPackages) < 1 {
 		return true
 	}
 
-	functionListed := searchFunctionList(logger.whitelistFunctions, getCallersFunctionName())
-	packageListed := searchPackageList(logger.whitelistPackages, getCallersPackageName())
+	functionListed := searchFunctionList(logger.whitelistFunctions, caller.QualifiedFunction())
+	packageListed := searchPackageList(logger.whitelistPackages, caller.Package)
 	return functionListed || packageListed
 }
 
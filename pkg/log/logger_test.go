@@ -17,6 +17,14 @@ func prepareTestLogger() (logger *log.Logger, output *strings.Builder) {
 	return logger, output
 }
 
+// requireDebug skips tests of debug messages if they are compiled out by the nolog_debug build tag
+func requireDebug(t *testing.T) {
+	t.Helper()
+	if !debugCompiled {
+		t.Skip("debug messages are compiled out by the nolog_debug build tag")
+	}
+}
+
 func TestLogger(t *testing.T) {
 	logger, output := prepareTestLogger()
 
@@ -41,6 +49,7 @@ func TestLogger(t *testing.T) {
 }
 
 func TestLoggerEnabledDebugMode(t *testing.T) {
+	requireDebug(t)
 	logger, output := prepareTestLogger()
 	logger.SetDebugMode(true)
 
@@ -79,6 +88,7 @@ func TestLoggerMultipleOutputs(t *testing.T) {
 }
 
 func TestLoggerBlacklist(t *testing.T) {
+	requireDebug(t)
 	logger, output := prepareTestLogger()
 	logger.SetDebugMode(true)
 
@@ -109,6 +119,7 @@ func TestLoggerBlacklist(t *testing.T) {
 }
 
 func TestLoggerWhitelist(t *testing.T) {
+	requireDebug(t)
 	logger, output := prepareTestLogger()
 	logger.SetDebugMode(true)
 
@@ -144,6 +155,7 @@ func TestLoggerWhitelist(t *testing.T) {
 }
 
 func TestLoggerBlacklistAndWhitelist(t *testing.T) {
+	requireDebug(t)
 	logger, output := prepareTestLogger()
 	logger.SetDebugMode(true)
 
@@ -178,3 +190,27 @@ func TestLoggerBlacklistAndWhitelist(t *testing.T) {
 	assert.Equal(t, expected, output.String())
 	output.Reset()
 }
+
+func TestLoggerWithFields(t *testing.T) {
+	output := &strings.Builder{}
+	logger := log.NewLogger()
+	formatter := log.NewDefaultFormatter()
+	formatter.ColorsDisabled = true
+	formatter.TimestampDisabled = true
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{output: formatter})
+	logger.SetDebugMode(true)
+
+	entry := logger.WithFields(log.Field{Key: "user", Value: "alice"})
+	entry.WithFields(log.Field{Key: "path", Value: "/home/alice files"}).Info("this is a test message")
+	assert.Equal(t, "INFO <log_test.TestLoggerWithFields>: this is a test message user=alice path=\"/home/alice files\"\n", output.String())
+	output.Reset()
+
+	requireDebug(t)
+	entry.Debugf("attempt %d", 2)
+	assert.Equal(t, "DEBUG <log_test.TestLoggerWithFields>: attempt 2 user=alice\n", output.String())
+	output.Reset()
+
+	logger.BlacklistFunctions("TestLoggerWithFields")
+	entry.Debug("this is a test message")
+	assert.Equal(t, "", output.String())
+}
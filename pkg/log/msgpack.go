@@ -0,0 +1,236 @@
+package log
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Minimal MessagePack encoding used by the fluent forward output
+
+func appendMsgpackNil(buffer []byte) []byte {
+	return append(buffer, 0xc0)
+}
+
+func appendMsgpackBool(buffer []byte, value bool) []byte {
+	if value {
+		return append(buffer, 0xc3)
+	}
+	return append(buffer, 0xc2)
+}
+
+func appendMsgpackInt(buffer []byte, value int64) []byte {
+	switch {
+	case value >= 0 && value <= 0x7f:
+		return append(buffer, byte(value))
+	case value < 0 && value >= -32:
+		return append(buffer, byte(value))
+	case value >= math.MinInt32 && value <= math.MaxInt32:
+		buffer = append(buffer, 0xd2)
+		return appendUint32(buffer, uint32(value))
+	default:
+		buffer = append(buffer, 0xd3)
+		return appendUint64(buffer, uint64(value))
+	}
+}
+
+func appendMsgpackUint(buffer []byte, value uint64) []byte {
+	if value <= math.MaxInt64 {
+		return appendMsgpackInt(buffer, int64(value))
+	}
+	buffer = append(buffer, 0xcf)
+	return appendUint64(buffer, value)
+}
+
+func appendMsgpackFloat(buffer []byte, value float64) []byte {
+	buffer = append(buffer, 0xcb)
+	return appendUint64(buffer, math.Float64bits(value))
+}
+
+func appendMsgpackString(buffer []byte, value string) []byte {
+	length := len(value)
+	switch {
+	case length <= 31:
+		buffer = append(buffer, 0xa0|byte(length))
+	case length <= math.MaxUint8:
+		buffer = append(buffer, 0xd9, byte(length))
+	case length <= math.MaxUint16:
+		buffer = append(buffer, 0xda)
+		buffer = appendUint16(buffer, uint16(length))
+	default:
+		buffer = append(buffer, 0xdb)
+		buffer = appendUint32(buffer, uint32(length))
+	}
+	return append(buffer, value...)
+}
+
+func appendMsgpackBinary(buffer []byte, value []byte) []byte {
+	length := len(value)
+	switch {
+	case length <= math.MaxUint8:
+		buffer = append(buffer, 0xc4, byte(length))
+	case length <= math.MaxUint16:
+		buffer = append(buffer, 0xc5)
+		buffer = appendUint16(buffer, uint16(length))
+	default:
+		buffer = append(buffer, 0xc6)
+		buffer = appendUint32(buffer, uint32(length))
+	}
+	return append(buffer, value...)
+}
+
+func appendMsgpackArrayHeader(buffer []byte, length int) []byte {
+	switch {
+	case length <= 15:
+		return append(buffer, 0x90|byte(length))
+	case length <= math.MaxUint16:
+		buffer = append(buffer, 0xdc)
+		return appendUint16(buffer, uint16(length))
+	default:
+		buffer = append(buffer, 0xdd)
+		return appendUint32(buffer, uint32(length))
+	}
+}
+
+func appendMsgpackMapHeader(buffer []byte, length int) []byte {
+	switch {
+	case length <= 15:
+		return append(buffer, 0x80|byte(length))
+	case length <= math.MaxUint16:
+		buffer = append(buffer, 0xde)
+		return appendUint16(buffer, uint16(length))
+	default:
+		buffer = append(buffer, 0xdf)
+		return appendUint32(buffer, uint32(length))
+	}
+}
+
+// appendMsgpackEventTime encodes the timestamp as the EventTime extension type of the fluent forward protocol
+func appendMsgpackEventTime(buffer []byte, timestamp time.Time) []byte {
+	buffer = append(buffer, 0xd7, 0x00)
+	buffer = appendUint32(buffer, uint32(timestamp.Unix()))
+	return appendUint32(buffer, uint32(timestamp.Nanosecond()))
+}
+
+// appendMsgpackValue encodes the value of a field, falling back to its string representation for unsupported types
+func appendMsgpackValue(buffer []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return appendMsgpackNil(buffer)
+	case string:
+		return appendMsgpackString(buffer, v)
+	case bool:
+		return appendMsgpackBool(buffer, v)
+	case int:
+		return appendMsgpackInt(buffer, int64(v))
+	case int8:
+		return appendMsgpackInt(buffer, int64(v))
+	case int16:
+		return appendMsgpackInt(buffer, int64(v))
+	case int32:
+		return appendMsgpackInt(buffer, int64(v))
+	case int64:
+		return appendMsgpackInt(buffer, v)
+	case uint:
+		return appendMsgpackUint(buffer, uint64(v))
+	case uint8:
+		return appendMsgpackUint(buffer, uint64(v))
+	case uint16:
+		return appendMsgpackUint(buffer, uint64(v))
+	case uint32:
+		return appendMsgpackUint(buffer, uint64(v))
+	case uint64:
+		return appendMsgpackUint(buffer, v)
+	case float32:
+		return appendMsgpackFloat(buffer, float64(v))
+	case float64:
+		return appendMsgpackFloat(buffer, v)
+	case []byte:
+		return appendMsgpackBinary(buffer, v)
+	}
+	return appendMsgpackString(buffer, fmt.Sprint(fieldValue(value)))
+}
+
+// readMsgpackStringMap decodes a map with string keys and values, which is the format of fluent forward ack responses
+func readMsgpackStringMap(reader *bufio.Reader) (map[string]string, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var length int
+	switch {
+	case header&0xf0 == 0x80:
+		length = int(header & 0x0f)
+	case header == 0xde:
+		var size uint16
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		length = int(size)
+	default:
+		return nil, fmt.Errorf("unexpected msgpack type 0x%x, expected map", header)
+	}
+
+	values := make(map[string]string, length)
+	for i := 0; i < length; i++ {
+		key, err := readMsgpackString(reader)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readMsgpackString(reader)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func readMsgpackString(reader *bufio.Reader) (string, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	var length int
+	switch {
+	case header&0xe0 == 0xa0:
+		length = int(header & 0x1f)
+	case header == 0xd9 || header == 0xc4:
+		size, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		length = int(size)
+	case header == 0xda || header == 0xc5:
+		var size uint16
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return "", err
+		}
+		length = int(size)
+	default:
+		return "", fmt.Errorf("unexpected msgpack type 0x%x, expected string", header)
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(reader, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func appendUint16(buffer []byte, value uint16) []byte {
+	return append(buffer, byte(value>>8), byte(value))
+}
+
+func appendUint32(buffer []byte, value uint32) []byte {
+	return append(buffer, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+func appendUint64(buffer []byte, value uint64) []byte {
+	return appendUint32(appendUint32(buffer, uint32(value>>32)), uint32(value))
+}
@@ -0,0 +1,62 @@
+package log
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// The RecordWriter interface is used to implement outputs that receive the structured record instead of a formatted message
+type RecordWriter interface {
+	WriteRecord(record *Record) error
+}
+
+// startFlushLoop calls flush every interval in the background until the returned stop function is called
+func startFlushLoop(clk clock.Clock, interval time.Duration, flush func()) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	ticker := clk.Ticker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// formatTraceID converts the value of a trace or span id field to its hex encoded form
+func formatTraceID(value interface{}) string {
+	switch id := value.(type) {
+	case []byte:
+		return hex.EncodeToString(id)
+	case [16]byte:
+		return hex.EncodeToString(id[:])
+	case [8]byte:
+		return hex.EncodeToString(id[:])
+	case fmt.Stringer:
+		return id.String()
+	default:
+		return fmt.Sprint(id)
+	}
+}
@@ -0,0 +1,405 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+const (
+	// AuditSequenceField is the key of the sequence number added to every audit record
+	AuditSequenceField = "audit_seq"
+	// AuditChainField is the key of the chain value linking an audit record to its predecessor
+	AuditChainField = "audit_chain"
+	// AuditCheckpointField is the key of the sequence number a checkpoint attests
+	AuditCheckpointField = "audit_checkpoint"
+	// AuditSignatureField is the key of the signature of a checkpoint
+	AuditSignatureField = "audit_signature"
+)
+
+// AuditOutput writes records formatted by a JSONFormatter as tamper-evident audit log. Every line gets a sequence
+// number and a chain value, which is the HMAC-SHA256 of the chain value of the previous record and the line itself.
+// Signed checkpoints attesting the current chain value are written every CheckpointInterval and when the output is
+// closed. Checkpoints are signed with the ed25519 SigningKey if set, and with the HMAC key otherwise.
+type AuditOutput struct {
+	Writer             io.Writer
+	Key                []byte
+	SigningKey         ed25519.PrivateKey
+	Formatter          *JSONFormatter
+	CheckpointInterval time.Duration
+	Clock              clock.Clock
+
+	mutex      sync.Mutex
+	sequence   uint64
+	chain      []byte
+	unanchored bool
+	startOnce  sync.Once
+	stop       func()
+}
+
+// NewAuditOutput initializes a new AuditOutput writing to the writer and chaining records with the HMAC key
+func NewAuditOutput(writer io.Writer, key []byte) *AuditOutput {
+	return &AuditOutput{
+		Writer:             writer,
+		Key:                key,
+		Formatter:          NewJSONFormatter(),
+		CheckpointInterval: time.Minute,
+		Clock:              clock.New(),
+		chain:              make([]byte, sha256.Size),
+	}
+}
+
+// Resume continues the sequence and chain of an existing audit log, which must be called before the first record is written
+func (o *AuditOutput) Resume(reader io.Reader) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		line, err := parseAuditLine(scanner.Bytes())
+		if err != nil || line.checkpoint {
+			continue
+		}
+		o.sequence, o.chain = line.sequence, line.chain
+	}
+	return scanner.Err()
+}
+
+// WriteRecord appends the record with its sequence number and chain value to the audit log
+func (o *AuditOutput) WriteRecord(record *Record) error {
+	o.startOnce.Do(func() {
+		o.stop = startFlushLoop(o.Clock, o.CheckpointInterval, func() { o.Checkpoint() })
+	})
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	sequence := o.sequence + 1
+	audited := *record
+	audited.Fields = make([]Field, 0, len(record.Fields)+1)
+	for _, field := range record.Fields {
+		switch field.Key {
+		case AuditSequenceField, AuditChainField, AuditCheckpointField, AuditSignatureField:
+			field.Key = "fields." + field.Key
+		}
+		audited.Fields = append(audited.Fields, field)
+	}
+	audited.Fields = append(audited.Fields, Field{Key: AuditSequenceField, Value: sequence})
+
+	formatter := *o.Formatter
+	formatter.PrettyPrint = false
+	content := []byte(strings.TrimSuffix(formatter.FormatRecord(&audited), "\n"))
+	if len(content) == 0 {
+		return fmt.Errorf("failed to format audit record")
+	}
+
+	chain := auditChain(o.Key, o.chain, content)
+	line := appendAuditKey(content, AuditChainField, hex.EncodeToString(chain))
+	if _, err := o.Writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	o.sequence, o.chain, o.unanchored = sequence, chain, true
+	return nil
+}
+
+// Checkpoint writes a signed checkpoint for the current chain value if records were written since the last one
+func (o *AuditOutput) Checkpoint() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if !o.unanchored {
+		return nil
+	}
+
+	content, err := json.Marshal(map[string]interface{}{
+		AuditCheckpointField: o.sequence,
+		AuditChainField:      hex.EncodeToString(o.chain),
+		"time":               o.Clock.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return err
+	}
+
+	var signature []byte
+	if o.SigningKey != nil {
+		signature = ed25519.Sign(o.SigningKey, content)
+	} else {
+		signature = auditChain(o.Key, nil, content)
+	}
+	line := appendAuditKey(content, AuditSignatureField, base64.StdEncoding.EncodeToString(signature))
+	if _, err := o.Writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	o.unanchored = false
+	return nil
+}
+
+// Close stops the periodic checkpoints, writes a final checkpoint and closes the writer if it implements io.Closer
+func (o *AuditOutput) Close() error {
+	o.startOnce.Do(func() {})
+	if o.stop != nil {
+		o.stop()
+	}
+	err := o.Checkpoint()
+	if closer, ok := o.Writer.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// The AuditViolationKind describes how an audit log was tampered with
+type AuditViolationKind string
+
+const (
+	// AuditGap is reported for sequence numbers that are missing from the audit log
+	AuditGap AuditViolationKind = "gap"
+	// AuditReordered is reported for records that appear after records with a higher sequence number
+	AuditReordered AuditViolationKind = "reordered"
+	// AuditDuplicate is reported for records whose sequence number appeared before
+	AuditDuplicate AuditViolationKind = "duplicate"
+	// AuditModified is reported for records or checkpoints whose chain value does not match their content
+	AuditModified AuditViolationKind = "modified"
+	// AuditInvalid is reported for lines that are no audit records or checkpoints with valid signature
+	AuditInvalid AuditViolationKind = "invalid"
+)
+
+// An AuditViolation is a single finding of an AuditVerifier
+type AuditViolation struct {
+	Kind     AuditViolationKind
+	Line     int
+	Sequence uint64
+	Message  string
+}
+
+func (violation AuditViolation) String() string {
+	if violation.Line == 0 {
+		return fmt.Sprintf("%s: %s", violation.Kind, violation.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", violation.Line, violation.Kind, violation.Message)
+}
+
+// An AuditReport summarises the verification of an audit log
+type AuditReport struct {
+	Records        int
+	Checkpoints    int
+	LastSequence   uint64
+	LastCheckpoint uint64
+	Violations     []AuditViolation
+}
+
+// AuditVerifier checks audit logs written by an AuditOutput
+type AuditVerifier struct {
+	Key       []byte
+	PublicKey ed25519.PublicKey
+}
+
+// NewAuditVerifier initializes a new AuditVerifier checking chain values with the HMAC key
+func NewAuditVerifier(key []byte) *AuditVerifier {
+	return &AuditVerifier{Key: key}
+}
+
+type auditLine struct {
+	number     int
+	checkpoint bool
+	sequence   uint64
+	chain      []byte
+	content    []byte
+	signature  []byte
+}
+
+type auditLink struct {
+	line  int
+	chain []byte
+}
+
+// Verify reads an audit log and reports gaps, reordered, duplicated and modified records. Only read errors are
+// returned as error, the state of the audit log is described by the violations of the report.
+func (v *AuditVerifier) Verify(reader io.Reader) (AuditReport, error) {
+	report := AuditReport{}
+	links := map[uint64]auditLink{0: {chain: make([]byte, sha256.Size)}}
+	waiting := map[uint64][]auditLine{}
+	checkpoints := []auditLine{}
+
+	report.Violations = []AuditViolation{}
+	violation := func(kind AuditViolationKind, line int, sequence uint64, format string, args ...interface{}) {
+		report.Violations = append(report.Violations, AuditViolation{Kind: kind, Line: line, Sequence: sequence, Message: fmt.Sprintf(format, args...)})
+	}
+	verifyLink := func(previous []byte, line auditLine) {
+		if !hmac.Equal(auditChain(v.Key, previous, line.content), line.chain) {
+			violation(AuditModified, line.number, line.sequence, "record %d does not match its chain value", line.sequence)
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1<<24)
+	for number := 1; scanner.Scan(); number++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		line, err := parseAuditLine(scanner.Bytes())
+		if err != nil {
+			violation(AuditInvalid, number, 0, "%v", err)
+			continue
+		}
+		line.number = number
+
+		if line.checkpoint {
+			report.Checkpoints++
+			if !v.verifySignature(line) {
+				violation(AuditInvalid, number, line.sequence, "checkpoint %d has an invalid signature", line.sequence)
+				continue
+			}
+			if line.sequence > report.LastSequence {
+				report.LastSequence = line.sequence
+			}
+			report.LastCheckpoint = line.sequence
+			checkpoints = append(checkpoints, line)
+			continue
+		}
+
+		report.Records++
+		if line.sequence == 0 {
+			violation(AuditInvalid, number, 0, "record has sequence number 0")
+			continue
+		}
+		if _, duplicate := links[line.sequence]; duplicate {
+			violation(AuditDuplicate, number, line.sequence, "record %d appeared before", line.sequence)
+			continue
+		}
+		if line.sequence < report.LastSequence {
+			violation(AuditReordered, number, line.sequence, "record %d appears after record %d", line.sequence, report.LastSequence)
+		} else {
+			report.LastSequence = line.sequence
+		}
+
+		links[line.sequence] = auditLink{line: number, chain: line.chain}
+		if previous, ok := links[line.sequence-1]; ok {
+			verifyLink(previous.chain, line)
+		} else {
+			waiting[line.sequence-1] = append(waiting[line.sequence-1], line)
+		}
+		for _, successor := range waiting[line.sequence] {
+			verifyLink(line.chain, successor)
+		}
+		delete(waiting, line.sequence)
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	for _, checkpoint := range checkpoints {
+		if link, ok := links[checkpoint.sequence]; ok && !hmac.Equal(link.chain, checkpoint.chain) {
+			violation(AuditModified, checkpoint.number, checkpoint.sequence, "checkpoint %d does not match the chain value of record %d", checkpoint.sequence, checkpoint.sequence)
+		}
+	}
+
+	for sequence := uint64(1); sequence <= report.LastSequence; sequence++ {
+		if _, ok := links[sequence]; ok {
+			continue
+		}
+		first := sequence
+		for sequence < report.LastSequence {
+			if _, ok := links[sequence+1]; ok {
+				break
+			}
+			sequence++
+		}
+		if first == sequence {
+			violation(AuditGap, links[sequence+1].line, first, "record %d is missing", first)
+		} else {
+			violation(AuditGap, links[sequence+1].line, first, "records %d to %d are missing", first, sequence)
+		}
+	}
+
+	sort.SliceStable(report.Violations, func(i, j int) bool { return report.Violations[i].Line < report.Violations[j].Line })
+	return report, nil
+}
+
+func (v *AuditVerifier) verifySignature(line auditLine) bool {
+	if v.PublicKey != nil {
+		return ed25519.Verify(v.PublicKey, line.content, line.signature)
+	}
+	return hmac.Equal(auditChain(v.Key, nil, line.content), line.signature)
+}
+
+// parseAuditLine splits a line of an audit log into the signed content and the chain value or signature appended to it
+func parseAuditLine(data []byte) (auditLine, error) {
+	line := auditLine{}
+	var err error
+
+	if line.content, line.signature, err = splitAuditKey(data, AuditSignatureField, base64.StdEncoding.DecodeString); err == nil {
+		line.checkpoint = true
+		fields := struct {
+			Sequence *uint64 `json:"audit_checkpoint"`
+			Chain    string  `json:"audit_chain"`
+		}{}
+		if err := json.Unmarshal(line.content, &fields); err != nil || fields.Sequence == nil {
+			return line, fmt.Errorf("malformed checkpoint")
+		}
+		line.sequence = *fields.Sequence
+		if line.chain, err = hex.DecodeString(fields.Chain); err != nil {
+			return line, fmt.Errorf("malformed checkpoint chain value")
+		}
+		return line, nil
+	}
+
+	if line.content, line.chain, err = splitAuditKey(data, AuditChainField, hex.DecodeString); err != nil {
+		return line, err
+	}
+	fields := struct {
+		Sequence *uint64 `json:"audit_seq"`
+	}{}
+	if err := json.Unmarshal(line.content, &fields); err != nil || fields.Sequence == nil {
+		return line, fmt.Errorf("record has no sequence number")
+	}
+	line.sequence = *fields.Sequence
+	return line, nil
+}
+
+// appendAuditKey adds a string value as last key to an encoded json object
+func appendAuditKey(content []byte, key string, value string) []byte {
+	line := append([]byte{}, content[:len(content)-1]...)
+	return append(line, fmt.Sprintf(`,"%s":"%s"}`, key, value)...)
+}
+
+// splitAuditKey removes the last key added by appendAuditKey from the line and decodes its value
+func splitAuditKey(data []byte, key string, decode func(string) ([]byte, error)) (content []byte, value []byte, err error) {
+	data = bytes.TrimRight(data, "\r\n")
+	marker := []byte(`,"` + key + `":"`)
+	index := bytes.LastIndex(data, marker)
+	if index < 0 || !bytes.HasSuffix(data, []byte(`"}`)) {
+		return nil, nil, fmt.Errorf("line has no %s", key)
+	}
+
+	encoded := string(data[index+len(marker) : len(data)-2])
+	if value, err = decode(encoded); err != nil || strings.Contains(encoded, `"`) {
+		return nil, nil, fmt.Errorf("malformed %s", key)
+	}
+	content = append(append([]byte{}, data[:index]...), '}')
+	return content, value, nil
+}
+
+func auditChain(key []byte, previous []byte, content []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(previous)
+	mac.Write(content)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,167 @@
+package log_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+var auditKey = []byte("0123456789abcdef0123456789abcdef")
+
+func prepareTestAuditOutput(buffer *bytes.Buffer) *log.AuditOutput {
+	output := log.NewAuditOutput(buffer, auditKey)
+	output.Formatter = prepareTestJSONFormatter()
+	output.CheckpointInterval = 0
+	output.Clock = clock.NewMock()
+	return output
+}
+
+// writeTestAuditLog writes five records and returns the lines of the audit log without the final checkpoint
+func writeTestAuditLog(t *testing.T) []string {
+	buffer := &bytes.Buffer{}
+	output := prepareTestAuditOutput(buffer)
+	for _, msg := range []string{"first message", "second message", "third message", "fourth message", "fifth message"} {
+		assert.NoError(t, output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: msg, Package: "main", Function: "main"}))
+	}
+	return strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+}
+
+func verifyTestAuditLog(t *testing.T, lines []string) log.AuditReport {
+	report, err := log.NewAuditVerifier(auditKey).Verify(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+	assert.NoError(t, err)
+	return report
+}
+
+func violationKinds(report log.AuditReport) []log.AuditViolationKind {
+	kinds := []log.AuditViolationKind{}
+	for _, violation := range report.Violations {
+		kinds = append(kinds, violation.Kind)
+	}
+	return kinds
+}
+
+func TestAuditOutput(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	output := prepareTestAuditOutput(buffer)
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	logger.WithFields(log.Field{Key: "user", Value: "admin"}, log.Field{Key: "audit_seq", Value: "shadowed"}).Info("user logged in")
+	logger.Info("user logged out")
+	assert.NoError(t, logger.Close())
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], `{"audit_seq":1,"fields.audit_seq":"shadowed","function":"TestAuditOutput","level":"INFO",`+
+		`"msg":"user logged in","package":"github.com/timbasel/go-log/pkg/log_test","time":"2006-01-02T15:04:05Z","user":"admin","audit_chain":"`))
+	assert.True(t, strings.HasPrefix(lines[1], `{"audit_seq":2,`))
+	assert.True(t, strings.HasPrefix(lines[2], `{"audit_chain":"`))
+	assert.Contains(t, lines[2], `"audit_checkpoint":2`)
+
+	report := verifyTestAuditLog(t, lines)
+	assert.Empty(t, report.Violations)
+	assert.Equal(t, 2, report.Records)
+	assert.Equal(t, 1, report.Checkpoints)
+	assert.Equal(t, uint64(2), report.LastCheckpoint)
+}
+
+func TestAuditOutputVerifyGap(t *testing.T) {
+	lines := writeTestAuditLog(t)
+	report := verifyTestAuditLog(t, append(lines[:1:1], lines[3:]...))
+
+	assert.Equal(t, []log.AuditViolation{{Kind: log.AuditGap, Line: 2, Sequence: 2, Message: "records 2 to 3 are missing"}}, report.Violations)
+}
+
+func TestAuditOutputVerifyReordered(t *testing.T) {
+	lines := writeTestAuditLog(t)
+	lines[1], lines[2] = lines[2], lines[1]
+	report := verifyTestAuditLog(t, lines)
+
+	// the chain values still match because every record is checked against its actual predecessor
+	assert.Equal(t, []log.AuditViolation{{Kind: log.AuditReordered, Line: 3, Sequence: 2, Message: "record 2 appears after record 3"}}, report.Violations)
+}
+
+func TestAuditOutputVerifyModified(t *testing.T) {
+	lines := writeTestAuditLog(t)
+	lines[2] = strings.Replace(lines[2], "third message", "3rd message", 1)
+	lines = append(lines, lines[4])
+	report := verifyTestAuditLog(t, lines)
+
+	assert.Equal(t, []log.AuditViolationKind{log.AuditModified, log.AuditDuplicate}, violationKinds(report))
+	assert.Equal(t, 3, report.Violations[0].Line)
+	assert.Equal(t, uint64(3), report.Violations[0].Sequence)
+}
+
+func TestAuditOutputVerifyWrongKey(t *testing.T) {
+	lines := writeTestAuditLog(t)
+	report, err := log.NewAuditVerifier([]byte("wrong key")).Verify(strings.NewReader(strings.Join(lines, "\n")))
+
+	assert.NoError(t, err)
+	assert.Len(t, report.Violations, 5)
+}
+
+func TestAuditOutputVerifyInvalidLine(t *testing.T) {
+	lines := writeTestAuditLog(t)
+	lines = append(lines[:2:2], append([]string{`{"level":"INFO","msg":"injected"}`}, lines[2:]...)...)
+	report := verifyTestAuditLog(t, lines)
+
+	assert.Equal(t, []log.AuditViolationKind{log.AuditInvalid}, violationKinds(report))
+	assert.Equal(t, 3, report.Violations[0].Line)
+}
+
+func TestAuditOutputSignedCheckpoints(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	buffer := &bytes.Buffer{}
+	output := prepareTestAuditOutput(buffer)
+	output.SigningKey = private
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	assert.NoError(t, output.Checkpoint())
+	assert.NoError(t, output.Checkpoint())
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "third message"})
+	assert.NoError(t, output.Close())
+
+	verifier := log.NewAuditVerifier(auditKey)
+	verifier.PublicKey = public
+	report, err := verifier.Verify(bytes.NewReader(buffer.Bytes()))
+	assert.NoError(t, err)
+	assert.Empty(t, report.Violations)
+	assert.Equal(t, 2, report.Checkpoints)
+	assert.Equal(t, uint64(3), report.LastCheckpoint)
+
+	// records removed from the end before the last checkpoint are detected as gap
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	truncated := strings.Join(append(lines[:3:3], lines[4]), "\n")
+	report, _ = verifier.Verify(strings.NewReader(truncated))
+	assert.Equal(t, []log.AuditViolationKind{log.AuditGap}, violationKinds(report))
+
+	// forged checkpoints are rejected
+	forged := strings.Replace(lines[4], `"audit_checkpoint":3`, `"audit_checkpoint":2`, 1)
+	report, _ = verifier.Verify(strings.NewReader(strings.Join(append(lines[:4:4], forged), "\n")))
+	assert.Equal(t, []log.AuditViolationKind{log.AuditInvalid}, violationKinds(report))
+}
+
+func TestAuditOutputResume(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	output := prepareTestAuditOutput(buffer)
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	assert.NoError(t, output.Close())
+
+	output = prepareTestAuditOutput(buffer)
+	assert.NoError(t, output.Resume(bytes.NewReader(buffer.Bytes())))
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	assert.NoError(t, output.Close())
+
+	report, err := log.NewAuditVerifier(auditKey).Verify(bytes.NewReader(buffer.Bytes()))
+	assert.NoError(t, err)
+	assert.Empty(t, report.Violations)
+	assert.Equal(t, 2, report.Records)
+	assert.Equal(t, uint64(2), report.LastSequence)
+}
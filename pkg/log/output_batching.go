@@ -0,0 +1,484 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// The Sink interface is used to implement destinations that receive the batches of a BatchingOutput
+type Sink interface {
+	Send(ctx context.Context, batch []*Record) error
+}
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(ctx context.Context, batch []*Record) error
+
+// Send calls the function with the batch
+func (f SinkFunc) Send(ctx context.Context, batch []*Record) error {
+	return f(ctx, batch)
+}
+
+// BatchingStats contains the counters of a BatchingOutput
+type BatchingStats struct {
+	Batches         int64
+	Records         int64
+	Failures        int64
+	Retries         int64
+	FallbackRecords int64
+	Dropped         int64
+	BreakerOpen     bool
+}
+
+// BatchingOutput groups records until MaxRecords, MaxBytes or MaxDelay is reached and hands the batches to a sink
+// from a background goroutine, so writing a record never waits for the sink. Failed batches are retried with
+// exponential backoff and jitter. Batches that still fail with a retryable error are kept for the next attempt as long
+// as at most MaxPendingRecords records are waiting to be sent, beyond that the oldest batches are dropped.
+// After BreakerThreshold consecutive failed batches the circuit breaker opens for BreakerTimeout, during which batches
+// are written to the fallback output instead. With a fallback output failed batches are written to it right away.
+type BatchingOutput struct {
+	RetryConfig
+	Sink              Sink
+	MaxRecords        int
+	MaxBytes          int
+	MaxDelay          time.Duration
+	MaxPendingRecords int
+	Jitter            float64
+	Timeout           time.Duration
+	Retryable         func(err error) bool
+	BreakerThreshold  int
+	BreakerTimeout    time.Duration
+	Fallback          RecordWriter
+	Clock             clock.Clock
+
+	mutex          sync.Mutex
+	sendMutex      sync.Mutex
+	batch          []*Record
+	batchBytes     int
+	timer          *clock.Timer
+	pending        [][]*Record
+	pendingRecords int
+	retryTimer     *clock.Timer
+	failures       int
+	openedUntil    time.Time
+	stats          BatchingStats
+	closed         bool
+	startOnce      sync.Once
+	wake           chan struct{}
+	done           chan struct{}
+	stopped        chan struct{}
+}
+
+// ErrOutputClosed is returned when records are written to an output that was already closed
+var ErrOutputClosed = errors.New("output is closed")
+
+// errBreakerOpen is returned for batches that skipped the sink because the circuit breaker is open
+var errBreakerOpen = errors.New("circuit breaker is open")
+
+// NewBatchingOutput initializes a new BatchingOutput sending to the provided sink
+func NewBatchingOutput(sink Sink) *BatchingOutput {
+	return &BatchingOutput{
+		RetryConfig:       NewRetryConfig(),
+		Sink:              sink,
+		MaxRecords:        100,
+		MaxBytes:          1 << 20,
+		MaxDelay:          5 * time.Second,
+		MaxPendingRecords: 10000,
+		Jitter:            0.2,
+		Timeout:           30 * time.Second,
+		Retryable:         isRetryableError,
+		BreakerThreshold:  5,
+		BreakerTimeout:    30 * time.Second,
+		Clock:             clock.New(),
+	}
+}
+
+// newOutputBatcher initializes the BatchingOutput used by a network output to batch, send and retry its records
+func newOutputBatcher(sink Sink, config RetryConfig, batchSize int, flushInterval time.Duration, clk clock.Clock) *BatchingOutput {
+	batcher := NewBatchingOutput(sink)
+	batcher.RetryConfig = config
+	batcher.MaxRecords = batchSize
+	batcher.MaxBytes = 0
+	batcher.MaxDelay = flushInterval
+	batcher.BreakerThreshold = 0
+	batcher.Clock = clk
+	return batcher
+}
+
+// WriteRecord adds the record to the current batch and hands the batch to the background sender once it is full.
+// ErrOutputClosed is returned once the output was closed.
+func (o *BatchingOutput) WriteRecord(record *Record) error {
+	o.mutex.Lock()
+	if o.closed {
+		o.mutex.Unlock()
+		return ErrOutputClosed
+	}
+	if len(o.batch) == 0 && o.MaxDelay > 0 {
+		o.timer = o.Clock.AfterFunc(o.MaxDelay, o.flushInBackground)
+	}
+	o.batch = append(o.batch, record)
+	if o.MaxBytes > 0 {
+		// the size is only estimated when needed as it renders all fields, including lazy ones
+		o.batchBytes += recordSize(record)
+	}
+	full := (o.MaxRecords > 0 && len(o.batch) >= o.MaxRecords) || (o.MaxBytes > 0 && o.batchBytes >= o.MaxBytes)
+	if full {
+		o.enqueueBatch()
+	}
+	o.mutex.Unlock()
+
+	if full {
+		o.signal()
+	}
+	return nil
+}
+
+// Flush sends the pending batches and the current batch and returns the first error. Batches that failed with a
+// retryable error are kept for the next attempt.
+func (o *BatchingOutput) Flush() error {
+	o.mutex.Lock()
+	o.enqueueBatch()
+	o.mutex.Unlock()
+
+	return o.sendPending()
+}
+
+// Close stops the background sender, sends the remaining records and closes the sink and the fallback output if they
+// implement io.Closer. Batches that still cannot be sent are written to the fallback output or dropped. Closing the
+// output again has no effect.
+func (o *BatchingOutput) Close() error {
+	o.mutex.Lock()
+	closed := o.closed
+	o.closed = true
+	o.mutex.Unlock()
+	if closed {
+		return nil
+	}
+
+	o.startOnce.Do(func() {})
+	if o.done != nil {
+		close(o.done)
+		<-o.stopped
+	}
+
+	err := o.Flush()
+
+	o.mutex.Lock()
+	pending := o.pending
+	o.pending, o.pendingRecords = nil, 0
+	if o.retryTimer != nil {
+		o.retryTimer.Stop()
+		o.retryTimer = nil
+	}
+	o.mutex.Unlock()
+	for _, batch := range pending {
+		o.fallback(batch)
+	}
+
+	for _, closer := range []interface{}{o.Sink, o.Fallback} {
+		if closer, ok := closer.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
+
+// Stats returns a snapshot of the counters of the output
+func (o *BatchingOutput) Stats() BatchingStats {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	stats := o.stats
+	stats.BreakerOpen = o.Clock.Now().Before(o.openedUntil)
+	return stats
+}
+
+// isClosed reports if the output was closed
+func (o *BatchingOutput) isClosed() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.closed
+}
+
+// flushInBackground hands the current batch to the background sender once MaxDelay has passed
+func (o *BatchingOutput) flushInBackground() {
+	o.mutex.Lock()
+	o.enqueueBatch()
+	o.mutex.Unlock()
+
+	o.signal()
+}
+
+// signal wakes the background sender, which is started with the first batch
+func (o *BatchingOutput) signal() {
+	o.startOnce.Do(func() {
+		o.wake = make(chan struct{}, 1)
+		o.done = make(chan struct{})
+		o.stopped = make(chan struct{})
+		go o.run()
+	})
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *BatchingOutput) run() {
+	defer close(o.stopped)
+	for {
+		select {
+		case <-o.wake:
+			o.sendPending()
+		case <-o.done:
+			return
+		}
+	}
+}
+
+// enqueueBatch moves the current batch to the pending batches, the caller must hold the mutex
+func (o *BatchingOutput) enqueueBatch() {
+	if o.timer != nil {
+		o.timer.Stop()
+		o.timer = nil
+	}
+	if len(o.batch) == 0 {
+		return
+	}
+
+	o.pending = append(o.pending, o.batch)
+	o.pendingRecords += len(o.batch)
+	o.batch, o.batchBytes = nil, 0
+	o.limitPending()
+}
+
+// limitPending drops the oldest pending batches while more than MaxPendingRecords records are waiting, the caller must
+// hold the mutex
+func (o *BatchingOutput) limitPending() {
+	for o.MaxPendingRecords > 0 && o.pendingRecords > o.MaxPendingRecords && len(o.pending) > 0 {
+		o.stats.Dropped += int64(len(o.pending[0]))
+		o.pendingRecords -= len(o.pending[0])
+		o.pending = o.pending[1:]
+	}
+}
+
+// sendPending sends the pending batches in order and stops at the first batch that is kept for a later attempt
+func (o *BatchingOutput) sendPending() error {
+	o.sendMutex.Lock()
+	defer o.sendMutex.Unlock()
+
+	var first error
+	for {
+		o.mutex.Lock()
+		if len(o.pending) == 0 {
+			o.mutex.Unlock()
+			return first
+		}
+		batch := o.pending[0]
+		o.pending = o.pending[1:]
+		o.pendingRecords -= len(batch)
+		o.mutex.Unlock()
+
+		err := o.send(batch)
+		if err == nil {
+			continue
+		}
+		if first == nil {
+			first = err
+		}
+
+		if o.Fallback != nil || !o.isRetryable(err) {
+			o.fallback(batch)
+			continue
+		}
+
+		o.mutex.Lock()
+		o.pending = append([][]*Record{batch}, o.pending...)
+		o.pendingRecords += len(batch)
+		o.limitPending()
+		if o.retryTimer == nil && o.MaxDelay > 0 {
+			o.retryTimer = o.Clock.AfterFunc(o.MaxDelay, o.retryInBackground)
+		}
+		o.mutex.Unlock()
+		return first
+	}
+}
+
+// sendRecords encodes the records and sends them in batches of MaxRecords on the calling goroutine, bypassing the
+// background sender. Batches rejected with an error that is not retryable are dropped and the remaining batches are
+// still sent, a retryable failure stops sending. The number of leading records that were handled is returned together
+// with the error, which is only reported as retryable in the latter case.
+func (o *BatchingOutput) sendRecords(records []*Record, encode func(record *Record) (*Record, error)) (handled int, retryable bool, err error) {
+	o.sendMutex.Lock()
+	defer o.sendMutex.Unlock()
+
+	batch := []*Record{}
+	for i, record := range records {
+		encoded, encodeErr := encode(record)
+		if encodeErr != nil {
+			o.count(func(stats *BatchingStats) { stats.Dropped++ })
+			if err == nil {
+				err = encodeErr
+			}
+		} else {
+			batch = append(batch, encoded)
+		}
+
+		if i < len(records)-1 && (o.MaxRecords <= 0 || len(batch) < o.MaxRecords) {
+			continue
+		}
+		if len(batch) > 0 {
+			if sendErr := o.send(batch); sendErr != nil {
+				if o.isRetryable(sendErr) {
+					return handled, true, sendErr
+				}
+				o.fallback(batch)
+				if err == nil {
+					err = sendErr
+				}
+			}
+		}
+		handled, batch = i+1, nil
+	}
+	return handled, false, err
+}
+
+// retryInBackground wakes the background sender to try the kept batches again
+func (o *BatchingOutput) retryInBackground() {
+	o.mutex.Lock()
+	o.retryTimer = nil
+	o.mutex.Unlock()
+
+	o.signal()
+}
+
+func (o *BatchingOutput) send(batch []*Record) error {
+	if o.isBreakerOpen() {
+		return errBreakerOpen
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			o.count(func(stats *BatchingStats) { stats.Retries++ })
+			o.Clock.Sleep(o.delay(attempt, err))
+		}
+
+		err = o.sendBatch(batch)
+		if err == nil {
+			o.mutex.Lock()
+			o.failures = 0
+			o.stats.Batches++
+			o.stats.Records += int64(len(batch))
+			o.mutex.Unlock()
+			return nil
+		}
+
+		o.count(func(stats *BatchingStats) { stats.Failures++ })
+		if attempt >= o.MaxRetries || (o.Retryable != nil && !o.Retryable(err)) {
+			break
+		}
+	}
+
+	o.mutex.Lock()
+	o.failures++
+	if o.BreakerThreshold > 0 && o.failures >= o.BreakerThreshold {
+		o.openedUntil = o.Clock.Now().Add(o.BreakerTimeout)
+	}
+	o.mutex.Unlock()
+	return err
+}
+
+func (o *BatchingOutput) sendBatch(batch []*Record) error {
+	ctx := context.Background()
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	return o.Sink.Send(ctx, batch)
+}
+
+// fallback writes the batch to the fallback output or drops it if there is none
+func (o *BatchingOutput) fallback(batch []*Record) {
+	if o.Fallback == nil {
+		o.count(func(stats *BatchingStats) { stats.Dropped += int64(len(batch)) })
+		return
+	}
+
+	for _, record := range batch {
+		if err := o.Fallback.WriteRecord(record); err != nil {
+			o.count(func(stats *BatchingStats) { stats.Dropped++ })
+			continue
+		}
+		o.count(func(stats *BatchingStats) { stats.FallbackRecords++ })
+	}
+}
+
+// isRetryable reports if a batch that failed with the error is kept for another attempt
+func (o *BatchingOutput) isRetryable(err error) bool {
+	return err == errBreakerOpen || o.Retryable == nil || o.Retryable(err)
+}
+
+// isBreakerOpen reports if batches should skip the sink, a half-open breaker lets the next batch through as probe
+func (o *BatchingOutput) isBreakerOpen() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.Clock.Now().Before(o.openedUntil)
+}
+
+func (o *BatchingOutput) count(update func(stats *BatchingStats)) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	update(&o.stats)
+}
+
+// delay returns the jittered backoff before the retry attempt, but never less than the delay requested by the server
+func (o *BatchingOutput) delay(attempt int, err error) time.Duration {
+	delay := o.backoff(attempt, 0)
+	if o.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * o.Jitter * float64(delay))
+	}
+	if httpErr, ok := err.(*HTTPError); ok && httpErr.RetryAfter > delay {
+		delay = httpErr.RetryAfter
+	}
+	return delay
+}
+
+// withEncoded returns a copy of the record holding the representation prepared by an output when it was written, so
+// the batch is sent as the record was at that time
+func withEncoded(record *Record, encoded interface{}) *Record {
+	prepared := *record
+	prepared.encoded = encoded
+	return &prepared
+}
+
+// isRetryableError reports if sending may succeed when tried again, which is the case for all but rejected http requests
+// and documents and requests that were accepted with an invalid response
+func isRetryableError(err error) bool {
+	if httpErr, ok := err.(*HTTPError); ok {
+		return isRetryableStatus(httpErr.StatusCode)
+	}
+	switch err.(type) {
+	case *ElasticsearchBulkError, *elasticsearchResponseError:
+		return false
+	}
+	return true
+}
+
+// recordSize estimates the encoded size of a record
+func recordSize(record *Record) int {
+	size := len(record.Message) + len(record.Package) + len(record.Function) + 32
+	for _, field := range record.Fields {
+		size += len(field.Key) + len(fmt.Sprint(field.Interface())) + 4
+	}
+	return size
+}
@@ -0,0 +1,249 @@
+package log_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+// testSink records the sizes of all received batches and fails while failing is set
+type testSink struct {
+	mutex   sync.Mutex
+	batches [][]*log.Record
+	calls   int
+	failing error
+}
+
+func (s *testSink) Send(ctx context.Context, batch []*log.Record) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls++
+	if s.failing != nil {
+		return s.failing
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *testSink) batchSizes() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sizes := []int{}
+	for _, batch := range s.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func (s *testSink) callCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.calls
+}
+
+// waitUntil polls the condition until it holds or a second passed
+func waitUntil(condition func() bool) {
+	for i := 0; i < 1000 && !condition(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func prepareTestBatchingOutput(sink log.Sink) (*log.BatchingOutput, *clock.Mock) {
+	mock := clock.NewMock()
+	output := log.NewBatchingOutput(sink)
+	output.Clock = mock
+	output.Jitter = 0
+	output.MaxRetries = 0
+	return output, mock
+}
+
+func writeTestRecords(output log.RecordWriter, count int) {
+	for i := 0; i < count; i++ {
+		output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"})
+	}
+}
+
+func TestBatchingOutputMaxRecords(t *testing.T) {
+	sink := &testSink{}
+	output, _ := prepareTestBatchingOutput(sink)
+	output.MaxRecords = 3
+
+	writeTestRecords(output, 7)
+	waitUntil(func() bool { return len(sink.batchSizes()) == 2 })
+	assert.Equal(t, []int{3, 3}, sink.batchSizes())
+
+	assert.NoError(t, output.Close())
+	assert.Equal(t, []int{3, 3, 1}, sink.batchSizes())
+	assert.Equal(t, log.BatchingStats{Batches: 3, Records: 7}, output.Stats())
+}
+
+func TestBatchingOutputMaxBytes(t *testing.T) {
+	sink := &testSink{}
+	output, _ := prepareTestBatchingOutput(sink)
+	output.MaxBytes = 100
+
+	writeTestRecords(output, 4)
+	waitUntil(func() bool { return len(sink.batchSizes()) == 2 })
+	assert.Equal(t, []int{2, 2}, sink.batchSizes())
+}
+
+func TestBatchingOutputMaxDelay(t *testing.T) {
+	sink := &testSink{}
+	output, mock := prepareTestBatchingOutput(sink)
+	output.MaxDelay = time.Second
+
+	writeTestRecords(output, 2)
+	mock.Add(500 * time.Millisecond)
+	assert.Empty(t, sink.batchSizes())
+
+	mock.Add(500 * time.Millisecond)
+	waitUntil(func() bool { return len(sink.batchSizes()) == 1 })
+	assert.Equal(t, []int{2}, sink.batchSizes())
+
+	writeTestRecords(output, 1)
+	mock.Add(time.Second)
+	waitUntil(func() bool { return len(sink.batchSizes()) == 2 })
+	assert.Equal(t, []int{2, 1}, sink.batchSizes())
+}
+
+func TestBatchingOutputRetry(t *testing.T) {
+	sink := &testSink{failing: errors.New("connection refused")}
+	output := log.NewBatchingOutput(log.SinkFunc(func(ctx context.Context, batch []*log.Record) error {
+		err := sink.Send(ctx, batch)
+		if sink.calls == 3 {
+			sink.failing = nil
+		}
+		return err
+	}))
+	output.MinBackoff = time.Millisecond
+	output.MaxRetries = 3
+
+	writeTestRecords(output, 2)
+	assert.NoError(t, output.Flush())
+
+	assert.Equal(t, 4, sink.calls)
+	assert.Equal(t, []int{2}, sink.batchSizes())
+	assert.Equal(t, log.BatchingStats{Batches: 1, Records: 2, Failures: 3, Retries: 3}, output.Stats())
+}
+
+func TestBatchingOutputNonRetryableError(t *testing.T) {
+	sink := &testSink{failing: &log.HTTPError{StatusCode: http.StatusBadRequest}}
+	output, _ := prepareTestBatchingOutput(sink)
+	output.MaxRetries = 3
+
+	writeTestRecords(output, 2)
+	assert.Error(t, output.Flush())
+
+	assert.Equal(t, 1, sink.calls)
+	assert.Equal(t, log.BatchingStats{Failures: 1, Dropped: 2}, output.Stats())
+}
+
+func TestBatchingOutputCircuitBreaker(t *testing.T) {
+	sink := &testSink{failing: errors.New("connection refused")}
+	fallback := &recordingOutput{}
+	output, mock := prepareTestBatchingOutput(sink)
+	output.MaxRecords = 1
+	output.BreakerThreshold = 2
+	output.BreakerTimeout = time.Minute
+	output.Fallback = fallback
+
+	writeTestRecords(output, 2)
+	waitUntil(func() bool { return output.Stats().FallbackRecords == 2 })
+	assert.Equal(t, 2, sink.callCount())
+	assert.True(t, output.Stats().BreakerOpen)
+
+	// while the breaker is open the sink is skipped
+	writeTestRecords(output, 3)
+	waitUntil(func() bool { return output.Stats().FallbackRecords == 5 })
+	assert.Equal(t, 2, sink.callCount())
+	fallback.Flush()
+	assert.Len(t, fallback.messages(), 5)
+
+	// after the timeout a single probe batch is sent, which closes the breaker again on success
+	sink.mutex.Lock()
+	sink.failing = nil
+	sink.mutex.Unlock()
+	mock.Add(time.Minute)
+	assert.False(t, output.Stats().BreakerOpen)
+	writeTestRecords(output, 1)
+	waitUntil(func() bool { return len(sink.batchSizes()) == 1 })
+	assert.Equal(t, 3, sink.callCount())
+	assert.Equal(t, []int{1}, sink.batchSizes())
+
+	assert.Equal(t, log.BatchingStats{Batches: 1, Records: 1, Failures: 2, FallbackRecords: 5}, output.Stats())
+}
+
+func TestBatchingOutputSendsInBackground(t *testing.T) {
+	release := make(chan struct{})
+	sink := &testSink{}
+	output, _ := prepareTestBatchingOutput(log.SinkFunc(func(ctx context.Context, batch []*log.Record) error {
+		<-release
+		return sink.Send(ctx, batch)
+	}))
+	output.MaxRecords = 2
+
+	// writing a full batch must not wait for the sink
+	writeTestRecords(output, 4)
+	assert.Empty(t, sink.batchSizes())
+
+	close(release)
+	assert.NoError(t, output.Close())
+	assert.Equal(t, []int{2, 2}, sink.batchSizes())
+}
+
+func TestBatchingOutputKeepsFailedBatches(t *testing.T) {
+	sink := &testSink{failing: errors.New("connection refused")}
+	output, _ := prepareTestBatchingOutput(sink)
+	output.MaxRecords = 0
+	output.MaxPendingRecords = 3
+
+	writeTestRecords(output, 2)
+	assert.Error(t, output.Flush())
+	assert.Equal(t, log.BatchingStats{Failures: 1}, output.Stats())
+
+	// the oldest batch is dropped once the kept batches exceed the limit
+	writeTestRecords(output, 2)
+	assert.Error(t, output.Flush())
+	assert.Equal(t, log.BatchingStats{Failures: 2, Dropped: 2}, output.Stats())
+
+	sink.failing = nil
+	assert.NoError(t, output.Flush())
+	assert.Equal(t, []int{2}, sink.batchSizes())
+	assert.Equal(t, log.BatchingStats{Batches: 1, Records: 2, Failures: 2, Dropped: 2}, output.Stats())
+}
+
+func TestBatchingOutputClose(t *testing.T) {
+	sink := &testSink{}
+	output, _ := prepareTestBatchingOutput(sink)
+
+	writeTestRecords(output, 1)
+	assert.NoError(t, output.Close())
+	assert.NoError(t, output.Close())
+	assert.Equal(t, []int{1}, sink.batchSizes())
+
+	assert.Equal(t, log.ErrOutputClosed, output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"}))
+	assert.NoError(t, output.Flush())
+	assert.Equal(t, []int{1}, sink.batchSizes())
+}
+
+func TestBatchingOutputWithoutMaxBytes(t *testing.T) {
+	sink := &testSink{}
+	output, _ := prepareTestBatchingOutput(sink)
+	output.MaxBytes = 0
+
+	calls := 0
+	lazy := log.Lazy("state", func() interface{} {
+		calls++
+		return 3
+	})
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message", Fields: []log.Field{lazy}})
+	assert.NoError(t, output.Close())
+	assert.Equal(t, 0, calls, "lazy fields must not be evaluated without a byte limit")
+}
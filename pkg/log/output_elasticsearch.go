@@ -0,0 +1,297 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acarl005/stripansi"
+	"github.com/benbjohnson/clock"
+)
+
+// ElasticsearchOutput indexes records as ECS compatible documents in Elasticsearch or OpenSearch using the bulk API
+type ElasticsearchOutput struct {
+	RetryConfig
+	Endpoint      string
+	Index         string
+	Username      string
+	Password      string
+	Headers       map[string]string
+	ServiceName   string
+	BatchSize     int
+	FlushInterval time.Duration
+	Client        *http.Client
+	Clock         clock.Clock
+
+	batcher   *BatchingOutput
+	startOnce sync.Once
+}
+
+type elasticsearchDocument struct {
+	index  string
+	source []byte
+}
+
+// An ElasticsearchBulkError is returned if documents were rejected by the bulk API with a non retryable error
+type ElasticsearchBulkError struct {
+	Rejected int
+	Reasons  []string
+}
+
+func (err *ElasticsearchBulkError) Error() string {
+	return fmt.Sprintf("%d documents were rejected: %s", err.Rejected, strings.Join(err.Reasons, "; "))
+}
+
+// An elasticsearchResponseError is returned if the bulk API accepted the request but its response could not be parsed,
+// the documents are considered delivered as sending them again may duplicate them
+type elasticsearchResponseError struct {
+	err error
+}
+
+func (err *elasticsearchResponseError) Error() string {
+	return "invalid bulk response: " + err.err.Error()
+}
+
+// NewElasticsearchOutput initializes a new ElasticsearchOutput sending to the provided cluster (e.g. http://localhost:9200).
+// The index may contain a time layout in curly braces (e.g. logs-{2006.01.02}) that is replaced with the UTC time of the record.
+func NewElasticsearchOutput(endpoint string, index string) *ElasticsearchOutput {
+	return &ElasticsearchOutput{
+		RetryConfig:   NewRetryConfig(),
+		Endpoint:      strings.TrimSuffix(endpoint, "/"),
+		Index:         index,
+		Headers:       map[string]string{},
+		BatchSize:     500,
+		FlushInterval: 5 * time.Second,
+		Client:        &http.Client{Timeout: 30 * time.Second},
+		Clock:         clock.New(),
+	}
+}
+
+// WriteRecord converts the record to a document and adds it to the current batch, which is sent in the background once
+// it is full
+func (o *ElasticsearchOutput) WriteRecord(record *Record) error {
+	o.start()
+
+	encoded, err := o.encode(record)
+	if err != nil {
+		return err
+	}
+	return o.batcher.WriteRecord(encoded)
+}
+
+// Flush sends all buffered documents, batches that failed with a retryable error are kept for the next attempt
+func (o *ElasticsearchOutput) Flush() error {
+	o.start()
+	return o.batcher.Flush()
+}
+
+// Close sends all remaining documents
+func (o *ElasticsearchOutput) Close() error {
+	o.start()
+	return o.batcher.Close()
+}
+
+// sendSpooled sends the records replayed by a SpoolOutput on the calling goroutine, bypassing the background sending
+func (o *ElasticsearchOutput) sendSpooled(records []*Record) (handled int, retryable bool, err error) {
+	o.start()
+	return o.batcher.sendRecords(records, o.encode)
+}
+
+// encode returns a copy of the record holding its document
+func (o *ElasticsearchOutput) encode(record *Record) (*Record, error) {
+	timestamp := record.Time
+	if timestamp.IsZero() {
+		timestamp = o.Clock.Now()
+	}
+
+	source, err := json.Marshal(o.newDocument(record, timestamp))
+	if err != nil {
+		return nil, err
+	}
+	return withEncoded(record, elasticsearchDocument{index: elasticsearchIndex(o.Index, timestamp), source: source}), nil
+}
+
+func (o *ElasticsearchOutput) start() {
+	o.startOnce.Do(func() {
+		o.batcher = newOutputBatcher(SinkFunc(o.sendBatch), o.RetryConfig, o.BatchSize, o.FlushInterval, o.Clock)
+	})
+}
+
+// sendBatch sends the documents of the batch and retries the documents that were rejected with a retryable status. If
+// the first request fails the whole batch is retried by the batcher, as no document was indexed yet.
+func (o *ElasticsearchOutput) sendBatch(ctx context.Context, batch []*Record) error {
+	documents := make([]elasticsearchDocument, 0, len(batch))
+	for _, record := range batch {
+		documents = append(documents, record.encoded.(elasticsearchDocument))
+	}
+
+	var bulkErr *ElasticsearchBulkError
+	var responseErr *elasticsearchResponseError
+	for attempt := 0; len(documents) > 0; attempt++ {
+		if attempt > 0 {
+			o.Clock.Sleep(o.backoff(attempt, 0))
+		}
+
+		payload := &bytes.Buffer{}
+		for _, document := range documents {
+			action, _ := json.Marshal(map[string]map[string]string{"create": {"_index": document.index}})
+			payload.Write(action)
+			payload.WriteString("\n")
+			payload.Write(document.source)
+			payload.WriteString("\n")
+		}
+
+		body, _, err := send(o.Client, o.Clock, func() (*http.Request, error) {
+			request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.Endpoint+"/_bulk", bytes.NewReader(payload.Bytes()))
+			if err != nil {
+				return nil, err
+			}
+			request.Header.Set("Content-Type", "application/x-ndjson")
+			if o.Username != "" || o.Password != "" {
+				request.SetBasicAuth(o.Username, o.Password)
+			}
+			for key, value := range o.Headers {
+				request.Header.Set(key, value)
+			}
+			return request, nil
+		})
+
+		// only failed requests are retried as a whole, documents of accepted requests may already have been indexed
+		retryable := documents
+		if err != nil {
+			if attempt == 0 {
+				return err
+			}
+		} else {
+			var rejected *ElasticsearchBulkError
+			var parseErr error
+			retryable, rejected, parseErr = parseElasticsearchBulkResponse(body, documents)
+			if parseErr != nil {
+				responseErr = &elasticsearchResponseError{err: parseErr}
+			}
+			if rejected != nil {
+				if bulkErr == nil {
+					bulkErr = &ElasticsearchBulkError{}
+				}
+				bulkErr.Rejected += rejected.Rejected
+				bulkErr.Reasons = append(bulkErr.Reasons, rejected.Reasons...)
+			}
+		}
+
+		if len(retryable) > 0 && attempt >= o.MaxRetries {
+			if bulkErr == nil {
+				bulkErr = &ElasticsearchBulkError{}
+			}
+			bulkErr.Rejected += len(retryable)
+			bulkErr.Reasons = append(bulkErr.Reasons, "retries exhausted")
+			break
+		}
+		documents = retryable
+	}
+
+	if bulkErr != nil {
+		return bulkErr
+	}
+	if responseErr != nil {
+		return responseErr
+	}
+	return nil
+}
+
+// newDocument maps the record to the Elastic Common Schema
+func (o *ElasticsearchOutput) newDocument(record *Record, timestamp time.Time) map[string]interface{} {
+	logObject := map[string]interface{}{"level": strings.ToLower(record.Level.String())}
+	if record.Package != "" {
+		logObject["logger"] = record.Package
+	}
+	if record.Function != "" {
+		logObject["origin"] = map[string]interface{}{"function": record.Function}
+	}
+
+	document := map[string]interface{}{
+		"@timestamp": timestamp.UTC().Format(time.RFC3339Nano),
+		"message":    stripansi.Strip(record.Message),
+		"log":        logObject,
+		"ecs":        map[string]interface{}{"version": "8.11.0"},
+	}
+	if o.ServiceName != "" {
+		document["service"] = map[string]interface{}{"name": o.ServiceName}
+	}
+
+	for _, field := range record.Fields {
+		switch field.Key {
+		case TraceIDField:
+			document["trace"] = map[string]interface{}{"id": formatTraceID(field.Interface())}
+		case SpanIDField:
+			document["span"] = map[string]interface{}{"id": formatTraceID(field.Interface())}
+		default:
+			if err, ok := field.Interface().(error); ok && field.Key == "error" {
+				document["error"] = map[string]interface{}{"message": err.Error(), "type": fmt.Sprintf("%T", err)}
+				continue
+			}
+
+			key := field.Key
+			if _, reserved := document[key]; reserved {
+				key = "fields." + key
+			}
+			document[key] = fieldValue(field.Interface())
+		}
+	}
+	return document
+}
+
+// elasticsearchIndex replaces the time layout in curly braces of the index pattern with the formatted timestamp
+func elasticsearchIndex(pattern string, timestamp time.Time) string {
+	start := strings.Index(pattern, "{")
+	end := strings.LastIndex(pattern, "}")
+	if start < 0 || end < start {
+		return pattern
+	}
+	return pattern[:start] + timestamp.UTC().Format(pattern[start+1:end]) + pattern[end+1:]
+}
+
+// parseElasticsearchBulkResponse returns the documents that failed with a retryable status and an error for the rejected documents
+func parseElasticsearchBulkResponse(body []byte, documents []elasticsearchDocument) (retryable []elasticsearchDocument, rejected *ElasticsearchBulkError, err error) {
+	response := struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, nil, err
+	}
+	if !response.Errors {
+		return nil, nil, nil
+	}
+	if len(response.Items) != len(documents) {
+		return nil, nil, fmt.Errorf("bulk response contains %d items for %d documents", len(response.Items), len(documents))
+	}
+
+	for i, item := range response.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 {
+				continue
+			}
+			if isRetryableStatus(result.Status) {
+				retryable = append(retryable, documents[i])
+				continue
+			}
+			if rejected == nil {
+				rejected = &ElasticsearchBulkError{}
+			}
+			rejected.Rejected++
+			rejected.Reasons = append(rejected.Reasons, result.Error.Type+": "+result.Error.Reason)
+		}
+	}
+	return retryable, rejected, nil
+}
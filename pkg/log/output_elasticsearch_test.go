@@ -0,0 +1,177 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+type elasticsearchRequest struct {
+	indices   []string
+	documents []map[string]interface{}
+}
+
+// fakeElasticsearch answers bulk requests with the item statuses returned by the status function
+type fakeElasticsearch struct {
+	mutex    sync.Mutex
+	requests []elasticsearchRequest
+	status   func(request int, document map[string]interface{}) int
+}
+
+func (e *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	request := elasticsearchRequest{}
+	for scanner.Scan() {
+		action := map[string]map[string]string{}
+		json.Unmarshal(scanner.Bytes(), &action)
+		request.indices = append(request.indices, action["create"]["_index"])
+
+		scanner.Scan()
+		document := map[string]interface{}{}
+		json.Unmarshal(scanner.Bytes(), &document)
+		request.documents = append(request.documents, document)
+	}
+	e.requests = append(e.requests, request)
+
+	errors := false
+	items := []string{}
+	for _, document := range request.documents {
+		status := http.StatusCreated
+		if e.status != nil {
+			status = e.status(len(e.requests), document)
+		}
+		if status == http.StatusCreated {
+			items = append(items, `{"create":{"status":201}}`)
+		} else {
+			errors = true
+			items = append(items, fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"error_%d","reason":"rejected"}}}`, status, status))
+		}
+	}
+	fmt.Fprintf(w, `{"took":1,"errors":%t,"items":[%s]}`, errors, strings.Join(items, ","))
+}
+
+func TestElasticsearchOutput(t *testing.T) {
+	elasticsearch := &fakeElasticsearch{}
+	server := httptest.NewServer(elasticsearch)
+	defer server.Close()
+
+	output := log.NewElasticsearchOutput(server.URL, "logs-{2006.01.02}")
+	output.FlushInterval = 0
+	output.ServiceName = "test-service"
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	logger.WithFields(
+		log.Field{Key: "user", Value: "alice"},
+		log.Field{Key: "message", Value: "shadowed"},
+		log.Field{Key: log.TraceIDField, Value: "5b8efff798038103d269b633813fc60c"},
+		log.Field{Key: "error", Value: fmt.Errorf("connection refused")},
+	).Error("this is a test message")
+	assert.NoError(t, logger.Close())
+
+	assert.Len(t, elasticsearch.requests, 1)
+	document := elasticsearch.requests[0].documents[0]
+
+	timestamp, err := time.Parse(time.RFC3339Nano, document["@timestamp"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"logs-" + timestamp.Format("2006.01.02")}, elasticsearch.requests[0].indices)
+
+	assert.Equal(t, "this is a test message", document["message"])
+	assert.Equal(t, map[string]interface{}{
+		"level":  "error",
+		"logger": "github.com/timbasel/go-log/pkg/log_test",
+		"origin": map[string]interface{}{"function": "TestElasticsearchOutput"},
+	}, document["log"])
+	assert.Equal(t, map[string]interface{}{"name": "test-service"}, document["service"])
+	assert.Equal(t, map[string]interface{}{"id": "5b8efff798038103d269b633813fc60c"}, document["trace"])
+	assert.Equal(t, "connection refused", document["error"].(map[string]interface{})["message"])
+	assert.Equal(t, "alice", document["user"])
+	assert.Equal(t, "shadowed", document["fields.message"])
+}
+
+func TestElasticsearchOutputIndexPattern(t *testing.T) {
+	elasticsearch := &fakeElasticsearch{}
+	server := httptest.NewServer(elasticsearch)
+	defer server.Close()
+
+	output := log.NewElasticsearchOutput(server.URL, "logs-{2006.01.02}-app")
+	output.FlushInterval = 0
+
+	timestamp, _ := time.Parse(time.RFC3339, "2026-10-18T23:30:00-02:00")
+	output.WriteRecord(&log.Record{Time: timestamp, Level: log.InfoLevel, Message: "this is a test message"})
+	assert.NoError(t, output.Flush())
+
+	assert.Equal(t, []string{"logs-2026.10.19-app"}, elasticsearch.requests[0].indices)
+	assert.Equal(t, "2026-10-19T01:30:00Z", elasticsearch.requests[0].documents[0]["@timestamp"])
+}
+
+func TestElasticsearchOutputRetryFailedItems(t *testing.T) {
+	elasticsearch := &fakeElasticsearch{status: func(request int, document map[string]interface{}) int {
+		switch {
+		case document["message"] == "retried" && request == 1:
+			return http.StatusTooManyRequests
+		case document["message"] == "rejected":
+			return http.StatusBadRequest
+		}
+		return http.StatusCreated
+	}}
+	server := httptest.NewServer(elasticsearch)
+	defer server.Close()
+
+	output := log.NewElasticsearchOutput(server.URL, "logs")
+	output.FlushInterval = 0
+	output.MinBackoff = time.Millisecond
+
+	for _, msg := range []string{"accepted", "retried", "rejected"} {
+		output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: msg})
+	}
+	err := output.Flush()
+
+	assert.Len(t, elasticsearch.requests, 2)
+	assert.Len(t, elasticsearch.requests[0].documents, 3)
+	assert.Len(t, elasticsearch.requests[1].documents, 1)
+	assert.Equal(t, "retried", elasticsearch.requests[1].documents[0]["message"])
+
+	assert.IsType(t, &log.ElasticsearchBulkError{}, err)
+	assert.Equal(t, 1, err.(*log.ElasticsearchBulkError).Rejected)
+	assert.Equal(t, []string{"error_400: rejected"}, err.(*log.ElasticsearchBulkError).Reasons)
+}
+
+func TestElasticsearchOutputInvalidResponse(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	output := log.NewElasticsearchOutput(server.URL, "logs")
+	output.FlushInterval = 0
+	output.MinBackoff = time.Millisecond
+
+	// the accepted documents are not sent again, as they may already have been indexed
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"})
+	assert.Error(t, output.Flush())
+	assert.NoError(t, output.Flush())
+	assert.Equal(t, 1, requests)
+}
@@ -0,0 +1,322 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// EmailOutput mails a digest of all records at or above Level over SMTP. A digest is sent in the background
+// FlushInterval after its first record and as soon as Threshold records were collected. Every record in the digest is
+// surrounded by up to ContextSize of the records written before and after it. The records written before are kept in a
+// ring buffer, to collect the records written after it a record is held back until ContextSize records followed or
+// ContextDelay passed. Records are rendered with the formatter when they are written, so timestamps reflect the time
+// the record was logged and not the time the digest was sent.
+type EmailOutput struct {
+	RetryConfig
+	Address       string
+	Username      string
+	Password      string
+	StartTLS      bool
+	TLSConfig     *tls.Config
+	From          string
+	To            []string
+	Subject       string
+	Level         Level
+	Formatter     Formatter
+	ContextSize   int
+	ContextDelay  time.Duration
+	Threshold     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	Clock         clock.Clock
+
+	mutex      sync.Mutex
+	recent     []string
+	next       int
+	held       *emailAlert
+	heldRecord *Record
+	heldTimer  *clock.Timer
+	batcher    *BatchingOutput
+	startOnce  sync.Once
+}
+
+type emailAlert struct {
+	context   []string
+	line      string
+	following []string
+}
+
+// NewEmailOutput initializes a new EmailOutput mailing Error records through the SMTP server at the address (host:port)
+func NewEmailOutput(address string, from string, to ...string) *EmailOutput {
+	formatter := NewDefaultFormatter()
+	formatter.ColorsDisabled = true
+
+	host, _ := os.Hostname()
+	return &EmailOutput{
+		RetryConfig:   NewRetryConfig(),
+		Address:       address,
+		From:          from,
+		To:            to,
+		Subject:       "error records logged on " + host,
+		Level:         ErrorLevel,
+		Formatter:     formatter,
+		ContextSize:   10,
+		ContextDelay:  10 * time.Second,
+		Threshold:     50,
+		FlushInterval: 15 * time.Minute,
+		Timeout:       30 * time.Second,
+		Clock:         clock.New(),
+	}
+}
+
+// WriteRecord adds records at or above the level to the digest and keeps all others as context for the held record or
+// the next one
+func (o *EmailOutput) WriteRecord(record *Record) error {
+	o.start()
+	if o.batcher.isClosed() {
+		return ErrOutputClosed
+	}
+
+	var line string
+	if formatter, ok := o.Formatter.(RecordFormatter); ok {
+		line = formatter.FormatRecord(record)
+	} else {
+		line = o.Formatter.Format(record.Level, record.Message)
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if record.Level < o.Level {
+		if o.held == nil {
+			o.remember(line)
+			return nil
+		}
+		o.held.following = append(o.held.following, line)
+		if len(o.held.following) < o.ContextSize {
+			return nil
+		}
+		return o.release()
+	}
+
+	// the context is consumed by the alert so that it is not repeated for the following alerts. While an alert is held
+	// the records are collected as its following records, which precede this alert as well.
+	context := o.context()
+	if o.held != nil {
+		context = o.held.following
+	}
+	err := o.release()
+	alert := &emailAlert{context: context, line: line}
+	o.recent, o.next = nil, 0
+	if o.ContextSize <= 0 {
+		if writeErr := o.batcher.WriteRecord(withEncoded(record, *alert)); err == nil {
+			err = writeErr
+		}
+		return err
+	}
+
+	o.held, o.heldRecord = alert, record
+	o.heldTimer = o.Clock.AfterFunc(o.ContextDelay, func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		if o.held == alert {
+			o.release()
+		}
+	})
+	return err
+}
+
+// Flush mails the digest of all collected records including the held one, digests that failed with a transient error
+// are kept for the next attempt
+func (o *EmailOutput) Flush() error {
+	o.start()
+
+	o.mutex.Lock()
+	err := o.release()
+	o.mutex.Unlock()
+
+	if flushErr := o.batcher.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// Close mails the remaining digest including the held record
+func (o *EmailOutput) Close() error {
+	o.start()
+
+	o.mutex.Lock()
+	err := o.release()
+	o.mutex.Unlock()
+
+	if closeErr := o.batcher.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// release adds the held alert with the records that followed it to the digest, the caller must hold the mutex
+func (o *EmailOutput) release() error {
+	if o.held == nil {
+		return nil
+	}
+	o.heldTimer.Stop()
+	alert, record := *o.held, o.heldRecord
+	o.held, o.heldRecord, o.heldTimer = nil, nil, nil
+	return o.batcher.WriteRecord(withEncoded(record, alert))
+}
+
+func (o *EmailOutput) start() {
+	o.startOnce.Do(func() {
+		o.batcher = newOutputBatcher(SinkFunc(o.sendBatch), o.RetryConfig, o.Threshold, o.FlushInterval, o.Clock)
+		o.batcher.Retryable = isRetryableSMTPError
+	})
+}
+
+func (o *EmailOutput) sendBatch(ctx context.Context, batch []*Record) error {
+	alerts := make([]emailAlert, 0, len(batch))
+	for _, record := range batch {
+		alerts = append(alerts, record.encoded.(emailAlert))
+	}
+	return o.send(ctx, o.newMessage(alerts))
+}
+
+// remember adds the line to the ring buffer of recent records
+func (o *EmailOutput) remember(line string) {
+	if o.ContextSize <= 0 {
+		return
+	}
+	if len(o.recent) < o.ContextSize {
+		o.recent = append(o.recent, line)
+		return
+	}
+	o.recent[o.next] = line
+	o.next = (o.next + 1) % o.ContextSize
+}
+
+// context returns the lines of the ring buffer from oldest to newest
+func (o *EmailOutput) context() []string {
+	return append(append([]string{}, o.recent[o.next:]...), o.recent[:o.next]...)
+}
+
+func (o *EmailOutput) newMessage(alerts []emailAlert) []byte {
+	body := &strings.Builder{}
+	fmt.Fprintf(body, "%d records were logged at or above level %s.\n", len(alerts), o.Level)
+	for i, alert := range alerts {
+		surrounding := []string{}
+		if len(alert.context) > 0 {
+			surrounding = append(surrounding, fmt.Sprintf("%d preceding", len(alert.context)))
+		}
+		if len(alert.following) > 0 {
+			surrounding = append(surrounding, fmt.Sprintf("%d following", len(alert.following)))
+		}
+
+		fmt.Fprintf(body, "\n--- record %d of %d", i+1, len(alerts))
+		if len(surrounding) > 0 {
+			fmt.Fprintf(body, " with %s records", strings.Join(surrounding, " and "))
+		}
+		body.WriteString(" ---\n")
+		for _, line := range alert.context {
+			body.WriteString(line)
+		}
+		body.WriteString(alert.line)
+		for _, line := range alert.following {
+			body.WriteString(line)
+		}
+	}
+
+	message := &bytes.Buffer{}
+	fmt.Fprintf(message, "From: %s\r\n", o.From)
+	fmt.Fprintf(message, "To: %s\r\n", strings.Join(o.To, ", "))
+	fmt.Fprintf(message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("%s (%d)", o.Subject, len(alerts))))
+	fmt.Fprintf(message, "Date: %s\r\n", o.Clock.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	message.WriteString("\r\n")
+	// lines may already end with CRLF, they are normalized first so that they do not end with a doubled CR
+	message.WriteString(strings.ReplaceAll(strings.ReplaceAll(body.String(), "\r\n", "\n"), "\n", "\r\n"))
+	return message.Bytes()
+}
+
+func (o *EmailOutput) send(ctx context.Context, message []byte) error {
+	host, _, err := net.SplitHostPort(o.Address)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: o.Timeout}
+	connection, err := dialer.DialContext(ctx, "tcp", o.Address)
+	if err != nil {
+		return err
+	}
+	if o.Timeout > 0 {
+		connection.SetDeadline(time.Now().Add(o.Timeout))
+	}
+
+	client, err := smtp.NewClient(connection, host)
+	if err != nil {
+		connection.Close()
+		return err
+	}
+	defer client.Close()
+
+	if o.StartTLS {
+		config := &tls.Config{}
+		if o.TLSConfig != nil {
+			config = o.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+		if err := client.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if o.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", o.Username, o.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(o.From); err != nil {
+		return err
+	}
+	for _, recipient := range o.To {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// isRetryableSMTPError reports if sending may succeed when tried again, which is the case for network errors and
+// transient negative replies (4xx) of the server
+func isRetryableSMTPError(err error) bool {
+	if smtpErr, ok := err.(*textproto.Error); ok {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+	return true
+}
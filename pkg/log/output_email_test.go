@@ -0,0 +1,345 @@
+package log_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+	Auth string
+	TLS  bool
+}
+
+// fakeSMTP is a minimal SMTP server accepting PLAIN auth and optionally STARTTLS, which rejects the first
+// transactions with a transient error while failures is set
+type fakeSMTP struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	mutex     sync.Mutex
+	messages  []smtpMessage
+	failures  int
+}
+
+func newFakeSMTP(t *testing.T, tlsConfig *tls.Config) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := &fakeSMTP{listener: listener, tlsConfig: tlsConfig}
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handle(connection)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTP) handle(connection net.Conn) {
+	defer func() { connection.Close() }()
+	text := textproto.NewConn(connection)
+	text.PrintfLine("220 localhost fake smtp")
+
+	message := smtpMessage{}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument := line, ""
+		if index := strings.Index(line, " "); index >= 0 {
+			command, argument = line[:index], line[index+1:]
+		}
+
+		switch strings.ToUpper(command) {
+		case "EHLO":
+			if s.tlsConfig != nil && !message.TLS {
+				text.PrintfLine("250-localhost\r\n250-STARTTLS\r\n250 AUTH PLAIN")
+			} else {
+				text.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start tls")
+			tlsConnection := tls.Server(connection, s.tlsConfig)
+			if err := tlsConnection.Handshake(); err != nil {
+				return
+			}
+			connection = tlsConnection
+			text = textproto.NewConn(connection)
+			message.TLS = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(argument, "PLAIN "))
+			message.Auth = string(credentials)
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.mutex.Lock()
+			fail := s.failures > 0
+			if fail {
+				s.failures--
+			}
+			s.mutex.Unlock()
+			if fail {
+				text.PrintfLine("451 try again later")
+				continue
+			}
+			message.From = strings.Trim(strings.TrimPrefix(argument, "FROM:"), "<>")
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			message.To = append(message.To, strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, _ := text.ReadDotBytes()
+			message.Data = string(data)
+			s.mutex.Lock()
+			s.messages = append(s.messages, message)
+			s.mutex.Unlock()
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTP) receivedMessages() []smtpMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.messages
+}
+
+func prepareTestEmailOutput(address string) (*log.EmailOutput, *clock.Mock) {
+	mock := clock.NewMock()
+	output := log.NewEmailOutput(address, "app@example.com", "oncall@example.com", "team@example.com")
+	output.Subject = "error records"
+	output.FlushInterval = 0
+	output.Clock = mock
+	output.Formatter = log.NewRawFormatter()
+	return output, mock
+}
+
+func TestEmailOutput(t *testing.T) {
+	server := newFakeSMTP(t, nil)
+	defer server.listener.Close()
+
+	output, _ := prepareTestEmailOutput(server.listener.Addr().String())
+	output.Username = "user"
+	output.Password = "secret"
+	output.ContextSize = 2
+
+	logger := log.NewLogger()
+	logger.SetDebugMode(true)
+	logger.SetRecordOutputs(output)
+	logger.Debug("first message")
+	logger.Info("second message")
+	logger.Info("third message")
+	logger.Error("first error")
+	logger.Error("second error")
+	logger.Info("fourth message")
+	assert.Empty(t, server.receivedMessages())
+	assert.NoError(t, logger.Close())
+
+	messages := server.receivedMessages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "app@example.com", messages[0].From)
+	assert.Equal(t, []string{"oncall@example.com", "team@example.com"}, messages[0].To)
+	assert.Equal(t, "\x00user\x00secret", messages[0].Auth)
+	assert.False(t, messages[0].TLS)
+
+	headers, body := splitEmail(messages[0].Data)
+	assert.Contains(t, headers, "Subject: error records (2)")
+	assert.Contains(t, headers, "To: oncall@example.com, team@example.com")
+	assert.Contains(t, headers, "Content-Type: text/plain; charset=utf-8")
+	assert.Equal(t, "2 records were logged at or above level ERROR.\n"+
+		"\n--- record 1 of 2 with 2 preceding records ---\n"+
+		"second message\nthird message\nfirst error\n"+
+		"\n--- record 2 of 2 with 1 following records ---\n"+
+		"second error\nfourth message\n", body)
+}
+
+func TestEmailOutputFollowingRecords(t *testing.T) {
+	server := newFakeSMTP(t, nil)
+	defer server.listener.Close()
+
+	output, mock := prepareTestEmailOutput(server.listener.Addr().String())
+	output.ContextSize = 2
+	output.ContextDelay = time.Minute
+	output.Threshold = 1
+
+	// the error is held back until enough records followed it
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "first error"})
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	assert.Empty(t, server.receivedMessages())
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	waitUntil(func() bool { return len(server.receivedMessages()) == 1 })
+	assert.Len(t, server.receivedMessages(), 1)
+
+	// or until the context delay passed
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "second error"})
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "third message"})
+	mock.Add(time.Minute)
+	waitUntil(func() bool { return len(server.receivedMessages()) == 2 })
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "fourth message"})
+	assert.NoError(t, output.Close())
+
+	messages := server.receivedMessages()
+	assert.Len(t, messages, 2)
+	_, body := splitEmail(messages[0].Data)
+	assert.Equal(t, "1 records were logged at or above level ERROR.\n"+
+		"\n--- record 1 of 1 with 2 following records ---\n"+
+		"first error\nfirst message\nsecond message\n", body)
+	_, body = splitEmail(messages[1].Data)
+	assert.Equal(t, "1 records were logged at or above level ERROR.\n"+
+		"\n--- record 1 of 1 with 1 following records ---\n"+
+		"second error\nthird message\n", body)
+}
+
+func TestEmailOutputConsecutiveErrors(t *testing.T) {
+	server := newFakeSMTP(t, nil)
+	defer server.listener.Close()
+
+	output, _ := prepareTestEmailOutput(server.listener.Addr().String())
+	output.ContextSize = 2
+
+	// the records following a held error precede the next error as well
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "first error"})
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message\r\nspanning two lines"})
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "second error"})
+	assert.NoError(t, output.Close())
+
+	messages := server.receivedMessages()
+	assert.Len(t, messages, 1)
+	assert.NotContains(t, messages[0].Data, "\r")
+	_, body := splitEmail(messages[0].Data)
+	assert.Equal(t, "2 records were logged at or above level ERROR.\n"+
+		"\n--- record 1 of 2 with 1 preceding and 1 following records ---\n"+
+		"first message\nfirst error\nsecond message\nspanning two lines\n"+
+		"\n--- record 2 of 2 with 1 preceding records ---\n"+
+		"second message\nspanning two lines\nsecond error\n", body)
+}
+
+func TestEmailOutputThreshold(t *testing.T) {
+	server := newFakeSMTP(t, nil)
+	defer server.listener.Close()
+
+	output, _ := prepareTestEmailOutput(server.listener.Addr().String())
+	output.Threshold = 2
+
+	for _, msg := range []string{"first error", "second error", "third error"} {
+		assert.NoError(t, output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: msg}))
+	}
+	waitUntil(func() bool { return len(server.receivedMessages()) == 1 })
+	assert.Len(t, server.receivedMessages(), 1)
+	_, body := splitEmail(server.receivedMessages()[0].Data)
+	assert.Contains(t, body, "second error")
+	assert.NotContains(t, body, "third error")
+
+	assert.NoError(t, output.Close())
+	assert.Len(t, server.receivedMessages(), 2)
+}
+
+func TestEmailOutputFlushInterval(t *testing.T) {
+	server := newFakeSMTP(t, nil)
+	defer server.listener.Close()
+
+	output, mock := prepareTestEmailOutput(server.listener.Addr().String())
+	output.FlushInterval = time.Minute
+	defer output.Close()
+
+	// the digest is sent FlushInterval after the record was released from being held back for context
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "this is a test message"})
+	mock.Add(output.ContextDelay + time.Minute)
+	for i := 0; i < 1000 && len(server.receivedMessages()) < 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Len(t, server.receivedMessages(), 1)
+}
+
+func TestEmailOutputRetry(t *testing.T) {
+	server := newFakeSMTP(t, nil)
+	server.failures = 1
+	defer server.listener.Close()
+
+	output, _ := prepareTestEmailOutput(server.listener.Addr().String())
+	output.Clock = clock.New()
+	output.MinBackoff = time.Millisecond
+
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "this is a test message"})
+	assert.NoError(t, output.Flush())
+	assert.Len(t, server.receivedMessages(), 1)
+}
+
+func TestEmailOutputStartTLS(t *testing.T) {
+	certificate, pool := newTestCertificate(t)
+	server := newFakeSMTP(t, &tls.Config{Certificates: []tls.Certificate{certificate}})
+	defer server.listener.Close()
+
+	output, _ := prepareTestEmailOutput(server.listener.Addr().String())
+	output.StartTLS = true
+	output.TLSConfig = &tls.Config{RootCAs: pool}
+	output.Username = "user"
+	output.Password = "secret"
+
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "this is a test message"})
+	assert.NoError(t, output.Close())
+
+	messages := server.receivedMessages()
+	assert.Len(t, messages, 1)
+	assert.True(t, messages[0].TLS)
+	assert.Equal(t, "\x00user\x00secret", messages[0].Auth)
+}
+
+func splitEmail(data string) (headers string, body string) {
+	parts := strings.SplitN(data, "\n\n", 2)
+	return parts[0], parts[1]
+}
+
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	parsed, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
@@ -0,0 +1,279 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Encrypted files consist of self-contained frames, each starting with the frame magic, the frame type and the length
+// of the payload. Every writer session starts with a header frame holding a random data key, which is either sealed
+// with the AES-GCM master key or encrypted with the RSA-OAEP public key of the recipient, followed by data frames
+// holding the AES-GCM encrypted chunks. Readers resynchronise on the frame magic, so torn or corrupted frames only
+// lose their own contents and sessions can be appended to existing files. The chunks of a session are numbered, so
+// chunks that are removed or reordered within a session fail the read.
+var encryptedFrameMagic = []byte("GLE1")
+
+const (
+	encryptedFrameHeader = 'H'
+	encryptedFrameData   = 'D'
+
+	encryptedModeAESGCM = 1
+	encryptedModeRSA    = 2
+
+	encryptedFramePrefix = 9
+	encryptedChunkSize   = 64 << 10
+	encryptedMaxPayload  = encryptedChunkSize + 1024
+)
+
+// EncryptedWriter encrypts everything written to it in appendable, self-framed chunks. Every call to Write produces
+// its own chunks, so a crash can at most tear the record that was written last.
+type EncryptedWriter struct {
+	Writer io.Writer
+
+	mutex   sync.Mutex
+	header  []byte
+	aead    cipher.AEAD
+	counter uint64
+}
+
+// NewEncryptedWriter initializes a new EncryptedWriter encrypting with the AES key (16, 24 or 32 bytes)
+func NewEncryptedWriter(writer io.Writer, key []byte) (*EncryptedWriter, error) {
+	master, err := newEncryptionAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncryptedWriter(writer, func(dataKey []byte) ([]byte, error) {
+		nonce := make([]byte, master.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		return append([]byte{encryptedModeAESGCM}, master.Seal(nonce, nonce, dataKey, []byte{encryptedModeAESGCM})...), nil
+	})
+}
+
+// NewEnvelopeEncryptedWriter initializes a new EncryptedWriter whose output can only be decrypted with the private
+// key belonging to the public key, so the host writing the log is not able to read it
+func NewEnvelopeEncryptedWriter(writer io.Writer, publicKey *rsa.PublicKey) (*EncryptedWriter, error) {
+	return newEncryptedWriter(writer, func(dataKey []byte) ([]byte, error) {
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, dataKey, encryptedFrameMagic)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{encryptedModeRSA}, wrapped...), nil
+	})
+}
+
+func newEncryptedWriter(writer io.Writer, wrap func(dataKey []byte) ([]byte, error)) (*EncryptedWriter, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newEncryptionAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedWriter{Writer: writer, header: appendEncryptedFrame(nil, encryptedFrameHeader, wrapped), aead: aead}, nil
+}
+
+// Write encrypts the data and appends it as data frames, the session header is written before the first frame
+func (w *EncryptedWriter) Write(data []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	output := w.header
+	for start := 0; start < len(data); start += encryptedChunkSize {
+		end := start + encryptedChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		nonce := make([]byte, w.aead.NonceSize())
+		binary.BigEndian.PutUint64(nonce[len(nonce)-8:], w.counter)
+		w.counter++
+
+		payload := append([]byte{}, nonce[len(nonce)-8:]...)
+		payload = w.aead.Seal(payload, nonce, data[start:end], []byte{encryptedFrameData})
+		output = appendEncryptedFrame(output, encryptedFrameData, payload)
+	}
+
+	if _, err := w.Writer.Write(output); err != nil {
+		return 0, err
+	}
+	w.header = nil
+	return len(data), nil
+}
+
+// Close closes the underlying writer if it implements io.Closer
+func (w *EncryptedWriter) Close() error {
+	if closer, ok := w.Writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// DecryptingReader streams the plaintext of files written by an EncryptedWriter. Torn and corrupted frames are
+// skipped, their size is reported by Skipped. Reading fails if the chunks of a session do not follow each other, as
+// chunks may have been removed or reordered.
+type DecryptingReader struct {
+	reader  *bufio.Reader
+	unwrap  func(mode byte, wrapped []byte) ([]byte, error)
+	aead    cipher.AEAD
+	next    uint64
+	pending []byte
+	skipped int64
+	err     error
+}
+
+// NewDecryptingReader initializes a new DecryptingReader for files encrypted with the AES key
+func NewDecryptingReader(reader io.Reader, key []byte) *DecryptingReader {
+	return newDecryptingReader(reader, func(mode byte, wrapped []byte) ([]byte, error) {
+		master, err := newEncryptionAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		if mode != encryptedModeAESGCM || len(wrapped) < master.NonceSize() {
+			return nil, fmt.Errorf("session is not encrypted with an aes key")
+		}
+		nonce, sealed := wrapped[:master.NonceSize()], wrapped[master.NonceSize():]
+		return master.Open(nil, nonce, sealed, []byte{encryptedModeAESGCM})
+	})
+}
+
+// NewEnvelopeDecryptingReader initializes a new DecryptingReader for files encrypted with the public key belonging to the private key
+func NewEnvelopeDecryptingReader(reader io.Reader, privateKey *rsa.PrivateKey) *DecryptingReader {
+	return newDecryptingReader(reader, func(mode byte, wrapped []byte) ([]byte, error) {
+		if mode != encryptedModeRSA {
+			return nil, fmt.Errorf("session is not encrypted with a public key")
+		}
+		return rsa.DecryptOAEP(sha256.New(), nil, privateKey, wrapped, encryptedFrameMagic)
+	})
+}
+
+func newDecryptingReader(reader io.Reader, unwrap func(mode byte, wrapped []byte) ([]byte, error)) *DecryptingReader {
+	return &DecryptingReader{reader: bufio.NewReaderSize(reader, encryptedFramePrefix+encryptedMaxPayload), unwrap: unwrap}
+}
+
+// Read reads decrypted data
+func (r *DecryptingReader) Read(data []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.readFrame()
+	}
+	n := copy(data, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Skipped returns the number of bytes that were skipped because they did not belong to a valid frame
+func (r *DecryptingReader) Skipped() int64 {
+	return r.skipped
+}
+
+// readFrame decrypts the next valid frame, skipping a single byte and searching for the next frame magic whenever
+// the current position does not hold a frame that can be authenticated
+func (r *DecryptingReader) readFrame() error {
+	for {
+		prefix, err := r.reader.Peek(encryptedFramePrefix)
+		if err != nil {
+			return r.discardTail(err)
+		}
+		length := int(binary.BigEndian.Uint32(prefix[5:]))
+		if !bytes.Equal(prefix[:4], encryptedFrameMagic) || length > encryptedMaxPayload {
+			r.skip(1)
+			continue
+		}
+
+		frame, err := r.reader.Peek(encryptedFramePrefix + length)
+		if err != nil {
+			// a frame that ends early may still be followed by complete frames of a later session
+			if next := bytes.Index(frame[1:], encryptedFrameMagic); next >= 0 {
+				r.skip(next + 1)
+				continue
+			}
+			return r.discardTail(err)
+		}
+		payload := frame[encryptedFramePrefix:]
+
+		switch frame[4] {
+		case encryptedFrameHeader:
+			if len(payload) > 0 {
+				if dataKey, err := r.unwrap(payload[0], payload[1:]); err == nil {
+					if r.aead, err = newEncryptionAEAD(dataKey); err == nil {
+						r.next = 0
+						r.reader.Discard(len(frame))
+						continue
+					}
+				}
+			}
+		case encryptedFrameData:
+			if r.aead != nil && len(payload) >= 8 {
+				nonce := make([]byte, r.aead.NonceSize())
+				copy(nonce[len(nonce)-8:], payload[:8])
+				if plaintext, err := r.aead.Open(nil, nonce, payload[8:], []byte{encryptedFrameData}); err == nil {
+					r.reader.Discard(len(frame))
+					if counter := binary.BigEndian.Uint64(payload[:8]); counter != r.next {
+						return fmt.Errorf("expected encrypted chunk %d but found chunk %d, chunks were removed or reordered", r.next, counter)
+					}
+					r.next++
+					r.pending = plaintext
+					return nil
+				}
+			}
+		}
+		r.skip(1)
+	}
+}
+
+func (r *DecryptingReader) skip(n int) {
+	discarded, _ := r.reader.Discard(n)
+	r.skipped += int64(discarded)
+}
+
+// discardTail skips the incomplete frame at the end of the file, which is left behind by a crash while writing
+func (r *DecryptingReader) discardTail(err error) error {
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	for {
+		discarded, err := r.reader.Discard(encryptedFramePrefix)
+		r.skipped += int64(discarded)
+		if err != nil {
+			return io.EOF
+		}
+	}
+}
+
+func appendEncryptedFrame(output []byte, frameType byte, payload []byte) []byte {
+	output = append(output, encryptedFrameMagic...)
+	output = append(output, frameType)
+	output = appendUint32(output, uint32(len(payload)))
+	return append(output, payload...)
+}
+
+func newEncryptionAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,143 @@
+package log_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+var encryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func writeEncrypted(t *testing.T, buffer *bytes.Buffer, messages ...string) {
+	writer, err := log.NewEncryptedWriter(buffer, encryptionKey)
+	assert.NoError(t, err)
+
+	logger := log.NewLogger()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{writer: log.NewRawFormatter()})
+	for _, msg := range messages {
+		logger.Info(msg)
+	}
+}
+
+func readDecrypted(t *testing.T, reader *log.DecryptingReader) string {
+	plaintext, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(plaintext)
+}
+
+func TestEncryptedWriter(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeEncrypted(t, buffer, "first message", "second message")
+	assert.NotContains(t, buffer.String(), "message")
+
+	reader := log.NewDecryptingReader(bytes.NewReader(buffer.Bytes()), encryptionKey)
+	assert.Equal(t, "first message\nsecond message\n", readDecrypted(t, reader))
+	assert.Equal(t, int64(0), reader.Skipped())
+}
+
+func TestEncryptedWriterAppend(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeEncrypted(t, buffer, "first message")
+	writeEncrypted(t, buffer, "second message")
+
+	reader := log.NewDecryptingReader(bytes.NewReader(buffer.Bytes()), encryptionKey)
+	assert.Equal(t, "first message\nsecond message\n", readDecrypted(t, reader))
+}
+
+func TestEncryptedWriterLargeWrite(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer, err := log.NewEncryptedWriter(buffer, encryptionKey)
+	assert.NoError(t, err)
+
+	message := strings.Repeat("0123456789", 20000)
+	n, err := writer.Write([]byte(message))
+	assert.NoError(t, err)
+	assert.Equal(t, len(message), n)
+
+	reader := log.NewDecryptingReader(bytes.NewReader(buffer.Bytes()), encryptionKey)
+	assert.Equal(t, message, readDecrypted(t, reader))
+}
+
+func TestEncryptedWriterTornTail(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeEncrypted(t, buffer, "first message", "second message")
+	torn := buffer.Bytes()[:buffer.Len()-5]
+
+	reader := log.NewDecryptingReader(bytes.NewReader(torn), encryptionKey)
+	assert.Equal(t, "first message\n", readDecrypted(t, reader))
+	assert.NotZero(t, reader.Skipped())
+
+	// sessions appended after a crash are still readable
+	appended := bytes.NewBuffer(append([]byte{}, torn...))
+	writeEncrypted(t, appended, "third message")
+	reader = log.NewDecryptingReader(bytes.NewReader(appended.Bytes()), encryptionKey)
+	assert.Equal(t, "first message\nthird message\n", readDecrypted(t, reader))
+}
+
+func TestEncryptedWriterCorruption(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeEncrypted(t, buffer, "first message", "second message", "third message")
+
+	// flip a byte in the ciphertext of the second message
+	data := buffer.Bytes()
+	index := bytes.LastIndex(data, []byte("GLE1D"))
+	index = bytes.LastIndex(data[:index], []byte("GLE1D"))
+	data[index+20] ^= 0xff
+
+	// the chunk of the second message is missing, so the third message can not be trusted to follow it
+	reader := log.NewDecryptingReader(bytes.NewReader(data), encryptionKey)
+	plaintext, err := ioutil.ReadAll(reader)
+	assert.Equal(t, "first message\n", string(plaintext))
+	assert.EqualError(t, err, "expected encrypted chunk 1 but found chunk 2, chunks were removed or reordered")
+	assert.NotZero(t, reader.Skipped())
+}
+
+func TestEncryptedWriterReordered(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeEncrypted(t, buffer, "first message", "second message", "third message")
+
+	// swap the frames of the second and third message
+	data := buffer.Bytes()
+	third := bytes.LastIndex(data, []byte("GLE1D"))
+	second := bytes.LastIndex(data[:third], []byte("GLE1D"))
+	reordered := append(append(append([]byte{}, data[:second]...), data[third:]...), data[second:third]...)
+
+	reader := log.NewDecryptingReader(bytes.NewReader(reordered), encryptionKey)
+	plaintext, err := ioutil.ReadAll(reader)
+	assert.Equal(t, "first message\n", string(plaintext))
+	assert.EqualError(t, err, "expected encrypted chunk 1 but found chunk 2, chunks were removed or reordered")
+}
+
+func TestEncryptedWriterWrongKey(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writeEncrypted(t, buffer, "first message")
+
+	reader := log.NewDecryptingReader(bytes.NewReader(buffer.Bytes()), []byte("fedcba9876543210fedcba9876543210"))
+	assert.Empty(t, readDecrypted(t, reader))
+	assert.Equal(t, int64(buffer.Len()), reader.Skipped())
+}
+
+func TestEnvelopeEncryptedWriter(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	buffer := &bytes.Buffer{}
+	writer, err := log.NewEnvelopeEncryptedWriter(buffer, &privateKey.PublicKey)
+	assert.NoError(t, err)
+	writer.Write([]byte("first message\n"))
+	writer.Write([]byte("second message\n"))
+
+	reader := log.NewEnvelopeDecryptingReader(bytes.NewReader(buffer.Bytes()), privateKey)
+	assert.Equal(t, "first message\nsecond message\n", readDecrypted(t, reader))
+
+	// the symmetric reader can not decrypt envelope sessions
+	reader = log.NewDecryptingReader(bytes.NewReader(buffer.Bytes()), encryptionKey)
+	assert.Empty(t, readDecrypted(t, reader))
+}
@@ -0,0 +1,230 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/acarl005/stripansi"
+	"github.com/benbjohnson/clock"
+)
+
+// FluentOutput sends records to fluentd or fluent-bit using the forward protocol in PackedForward mode
+type FluentOutput struct {
+	RetryConfig
+	Address       string
+	Tag           string
+	Compress      bool
+	RequireAck    bool
+	Timeout       time.Duration
+	BatchSize     int
+	FlushInterval time.Duration
+	Clock         clock.Clock
+
+	connection net.Conn
+	reader     *bufio.Reader
+	batcher    *BatchingOutput
+	startOnce  sync.Once
+}
+
+// NewFluentOutput initializes a new FluentOutput sending to the forward input listening on the address (e.g. localhost:24224)
+func NewFluentOutput(address string, tag string) *FluentOutput {
+	return &FluentOutput{
+		RetryConfig:   NewRetryConfig(),
+		Address:       address,
+		Tag:           tag,
+		Timeout:       10 * time.Second,
+		BatchSize:     100,
+		FlushInterval: 5 * time.Second,
+		Clock:         clock.New(),
+	}
+}
+
+// WriteRecord encodes the record as forward protocol entry and adds it to the current batch, which is sent in the
+// background once it is full
+func (o *FluentOutput) WriteRecord(record *Record) error {
+	o.start()
+
+	encoded, err := o.encode(record)
+	if err != nil {
+		return err
+	}
+	return o.batcher.WriteRecord(encoded)
+}
+
+// Flush sends all buffered entries and waits for their ack if required, batches that failed are kept for the next
+// attempt
+func (o *FluentOutput) Flush() error {
+	o.start()
+	return o.batcher.Flush()
+}
+
+// Close sends all remaining entries and closes the connection
+func (o *FluentOutput) Close() error {
+	o.start()
+	err := o.batcher.Close()
+	o.disconnect()
+	return err
+}
+
+// sendSpooled sends the records replayed by a SpoolOutput on the calling goroutine, bypassing the background sending
+func (o *FluentOutput) sendSpooled(records []*Record) (handled int, retryable bool, err error) {
+	o.start()
+	return o.batcher.sendRecords(records, o.encode)
+}
+
+// encode returns a copy of the record holding its forward protocol entry
+func (o *FluentOutput) encode(record *Record) (*Record, error) {
+	timestamp := record.Time
+	if timestamp.IsZero() {
+		timestamp = o.Clock.Now()
+	}
+	return withEncoded(record, appendFluentEntry(nil, timestamp, record)), nil
+}
+
+func (o *FluentOutput) start() {
+	o.startOnce.Do(func() {
+		o.batcher = newOutputBatcher(SinkFunc(o.sendBatch), o.RetryConfig, o.BatchSize, o.FlushInterval, o.Clock)
+	})
+}
+
+// sendBatch sends the entries of the batch as a single PackedForward message, the connection is dropped on failure and
+// opened again for the next attempt
+func (o *FluentOutput) sendBatch(ctx context.Context, batch []*Record) error {
+	entries := []byte{}
+	for _, record := range batch {
+		entries = append(entries, record.encoded.([]byte)...)
+	}
+
+	message, chunk, err := o.newMessage(entries, len(batch))
+	if err != nil {
+		return err
+	}
+	if err := o.send(ctx, message, chunk); err != nil {
+		o.disconnect()
+		return err
+	}
+	return nil
+}
+
+// newMessage encodes the entries as [tag, entries, option] message with a unique chunk id if acks are required
+func (o *FluentOutput) newMessage(entries []byte, count int) (message []byte, chunk string, err error) {
+	options := map[string]interface{}{"size": count}
+
+	if o.Compress {
+		compressed := &bytes.Buffer{}
+		writer := gzip.NewWriter(compressed)
+		if _, err := writer.Write(entries); err != nil {
+			return nil, "", err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, "", err
+		}
+		entries = compressed.Bytes()
+		options["compressed"] = "gzip"
+	}
+
+	if o.RequireAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, "", err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+		options["chunk"] = chunk
+	}
+
+	message = appendMsgpackArrayHeader(nil, 3)
+	message = appendMsgpackString(message, o.Tag)
+	message = appendMsgpackBinary(message, entries)
+	message = appendMsgpackMapHeader(message, len(options))
+	for _, key := range []string{"size", "compressed", "chunk"} {
+		if value, ok := options[key]; ok {
+			message = appendMsgpackString(message, key)
+			message = appendMsgpackValue(message, value)
+		}
+	}
+	return message, chunk, nil
+}
+
+func (o *FluentOutput) send(ctx context.Context, message []byte, chunk string) error {
+	if o.connection == nil {
+		dialer := &net.Dialer{Timeout: o.Timeout}
+		connection, err := dialer.DialContext(ctx, "tcp", o.Address)
+		if err != nil {
+			return err
+		}
+		o.connection = connection
+		o.reader = bufio.NewReader(connection)
+	}
+
+	if o.Timeout > 0 {
+		o.connection.SetDeadline(time.Now().Add(o.Timeout))
+	}
+	if _, err := o.connection.Write(message); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	response, err := readMsgpackStringMap(o.reader)
+	if err != nil {
+		return err
+	}
+	if response["ack"] != chunk {
+		return fmt.Errorf("received ack %q for chunk %q", response["ack"], chunk)
+	}
+	return nil
+}
+
+func (o *FluentOutput) disconnect() {
+	if o.connection != nil {
+		o.connection.Close()
+		o.connection = nil
+		o.reader = nil
+	}
+}
+
+// appendFluentEntry encodes the record as [time, record] entry of a PackedForward message
+func appendFluentEntry(buffer []byte, timestamp time.Time, record *Record) []byte {
+	size := 2 + len(record.Fields)
+	if record.Package != "" {
+		size++
+	}
+	if record.Function != "" {
+		size++
+	}
+
+	buffer = appendMsgpackArrayHeader(buffer, 2)
+	buffer = appendMsgpackEventTime(buffer, timestamp)
+	buffer = appendMsgpackMapHeader(buffer, size)
+	buffer = appendMsgpackString(buffer, "level")
+	buffer = appendMsgpackString(buffer, record.Level.String())
+	buffer = appendMsgpackString(buffer, "message")
+	buffer = appendMsgpackString(buffer, stripansi.Strip(record.Message))
+	if record.Package != "" {
+		buffer = appendMsgpackString(buffer, "package")
+		buffer = appendMsgpackString(buffer, record.Package)
+	}
+	if record.Function != "" {
+		buffer = appendMsgpackString(buffer, "function")
+		buffer = appendMsgpackString(buffer, record.Function)
+	}
+	for _, field := range record.Fields {
+		key := field.Key
+		switch key {
+		case "level", "message", "package", "function":
+			key = "fields." + key
+		}
+		buffer = appendMsgpackString(buffer, key)
+		buffer = appendMsgpackValue(buffer, field.Interface())
+	}
+	return buffer
+}
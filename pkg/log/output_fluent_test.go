@@ -0,0 +1,294 @@
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+type fluentEntry struct {
+	Time   time.Time
+	Record map[string]interface{}
+}
+
+type fluentMessage struct {
+	Tag     string
+	Entries []fluentEntry
+	Options map[string]interface{}
+}
+
+// fakeFluent is a forward protocol input decoding PackedForward messages and answering chunk options with acks
+type fakeFluent struct {
+	listener    net.Listener
+	mutex       sync.Mutex
+	messages    []fluentMessage
+	connections int
+	dropAcks    int
+}
+
+func newFakeFluent(t *testing.T) *fakeFluent {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	fluent := &fakeFluent{listener: listener}
+	go fluent.serve()
+	return fluent
+}
+
+func (f *fakeFluent) serve() {
+	for {
+		connection, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		f.connections++
+		f.mutex.Unlock()
+		go f.handle(connection)
+	}
+}
+
+func (f *fakeFluent) handle(connection net.Conn) {
+	defer connection.Close()
+	reader := bufio.NewReader(connection)
+	for {
+		value, err := decodeMsgpack(reader)
+		if err != nil {
+			return
+		}
+		message := value.([]interface{})
+		options := message[2].(map[string]interface{})
+
+		entries := message[1].([]byte)
+		if options["compressed"] == "gzip" {
+			gzipReader, _ := gzip.NewReader(bytes.NewReader(entries))
+			entries, _ = ioutil.ReadAll(gzipReader)
+		}
+
+		decoded := fluentMessage{Tag: message[0].(string), Options: options}
+		entryReader := bufio.NewReader(bytes.NewReader(entries))
+		for {
+			entry, err := decodeMsgpack(entryReader)
+			if err == io.EOF {
+				break
+			}
+			pair := entry.([]interface{})
+			decoded.Entries = append(decoded.Entries, fluentEntry{Time: pair[0].(time.Time), Record: pair[1].(map[string]interface{})})
+		}
+
+		f.mutex.Lock()
+		dropAck := f.dropAcks > 0
+		if dropAck {
+			f.dropAcks--
+		} else {
+			f.messages = append(f.messages, decoded)
+		}
+		f.mutex.Unlock()
+
+		if chunk, ok := options["chunk"].(string); ok {
+			if dropAck {
+				return
+			}
+			response := []byte{0x81, 0xa3, 'a', 'c', 'k', 0xa0 | byte(len(chunk))}
+			connection.Write(append(response, chunk...))
+		}
+	}
+}
+
+// decodeMsgpack decodes the subset of MessagePack produced by the fluent output
+func decodeMsgpack(reader *bufio.Reader) (interface{}, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	readLength := func(size int) int {
+		buffer := make([]byte, size)
+		io.ReadFull(reader, buffer)
+		switch size {
+		case 1:
+			return int(buffer[0])
+		case 2:
+			return int(binary.BigEndian.Uint16(buffer))
+		}
+		return int(binary.BigEndian.Uint32(buffer))
+	}
+	readBytes := func(length int) []byte {
+		buffer := make([]byte, length)
+		io.ReadFull(reader, buffer)
+		return buffer
+	}
+	readArray := func(length int) (interface{}, error) {
+		values := make([]interface{}, length)
+		for i := range values {
+			if values[i], err = decodeMsgpack(reader); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	readMap := func(length int) (interface{}, error) {
+		values := map[string]interface{}{}
+		for i := 0; i < length; i++ {
+			key, err := decodeMsgpack(reader)
+			if err != nil {
+				return nil, err
+			}
+			if values[key.(string)], err = decodeMsgpack(reader); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+
+	switch {
+	case header <= 0x7f:
+		return int64(header), nil
+	case header >= 0xe0:
+		return int64(int8(header)), nil
+	case header&0xf0 == 0x80:
+		return readMap(int(header & 0x0f))
+	case header&0xf0 == 0x90:
+		return readArray(int(header & 0x0f))
+	case header&0xe0 == 0xa0:
+		return string(readBytes(int(header & 0x1f))), nil
+	}
+
+	switch header {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		return readBytes(readLength(1 << (header - 0xc4))), nil
+	case 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(readBytes(8))), nil
+	case 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(readBytes(4)))), nil
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(readBytes(8))), nil
+	case 0xd7:
+		data := readBytes(9)
+		return time.Unix(int64(binary.BigEndian.Uint32(data[1:5])), int64(binary.BigEndian.Uint32(data[5:9]))), nil
+	case 0xd9, 0xda, 0xdb:
+		return string(readBytes(readLength(1 << (header - 0xd9)))), nil
+	case 0xdc:
+		return readArray(readLength(2))
+	case 0xde:
+		return readMap(readLength(2))
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%x", header)
+}
+
+func (f *fakeFluent) receivedMessages() []fluentMessage {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.messages
+}
+
+func waitForFluentMessages(f *fakeFluent, count int) []fluentMessage {
+	for i := 0; i < 1000 && len(f.receivedMessages()) < count; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	return f.receivedMessages()
+}
+
+func TestFluentOutput(t *testing.T) {
+	fluent := newFakeFluent(t)
+	defer fluent.listener.Close()
+
+	output := log.NewFluentOutput(fluent.listener.Addr().String(), "app.log")
+	output.FlushInterval = 0
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	logger.WithFields(log.Field{Key: "attempt", Value: 3}, log.Field{Key: "level", Value: "shadowed"}).Error("this is a test message")
+	logger.Info("another message")
+	assert.NoError(t, logger.Close())
+
+	messages := waitForFluentMessages(fluent, 1)
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "app.log", messages[0].Tag)
+	assert.Equal(t, int64(2), messages[0].Options["size"])
+	assert.NotContains(t, messages[0].Options, "chunk")
+
+	assert.Len(t, messages[0].Entries, 2)
+	assert.Equal(t, map[string]interface{}{
+		"level":        "ERROR",
+		"message":      "this is a test message",
+		"package":      "github.com/timbasel/go-log/pkg/log_test",
+		"function":     "TestFluentOutput",
+		"attempt":      int64(3),
+		"fields.level": "shadowed",
+	}, messages[0].Entries[0].Record)
+	assert.Equal(t, "another message", messages[0].Entries[1].Record["message"])
+}
+
+func TestFluentOutputEventTime(t *testing.T) {
+	fluent := newFakeFluent(t)
+	defer fluent.listener.Close()
+
+	output := log.NewFluentOutput(fluent.listener.Addr().String(), "app.log")
+	output.FlushInterval = 0
+
+	timestamp := time.Unix(1697650000, 123456789)
+	output.WriteRecord(&log.Record{Time: timestamp, Level: log.InfoLevel, Message: "this is a test message"})
+	assert.NoError(t, output.Close())
+
+	messages := waitForFluentMessages(fluent, 1)
+	assert.True(t, timestamp.Equal(messages[0].Entries[0].Time))
+}
+
+func TestFluentOutputCompressedAck(t *testing.T) {
+	fluent := newFakeFluent(t)
+	defer fluent.listener.Close()
+
+	output := log.NewFluentOutput(fluent.listener.Addr().String(), "app.log")
+	output.FlushInterval = 0
+	output.Compress = true
+	output.RequireAck = true
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	assert.NoError(t, output.Flush())
+
+	messages := fluent.receivedMessages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "gzip", messages[0].Options["compressed"])
+	assert.NotEmpty(t, messages[0].Options["chunk"])
+	assert.Len(t, messages[0].Entries, 2)
+	assert.NoError(t, output.Close())
+}
+
+func TestFluentOutputResendWithoutAck(t *testing.T) {
+	fluent := newFakeFluent(t)
+	fluent.dropAcks = 1
+	defer fluent.listener.Close()
+
+	output := log.NewFluentOutput(fluent.listener.Addr().String(), "app.log")
+	output.FlushInterval = 0
+	output.RequireAck = true
+	output.MinBackoff = time.Millisecond
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"})
+	assert.NoError(t, output.Close())
+
+	messages := fluent.receivedMessages()
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "this is a test message", messages[0].Entries[0].Record["message"])
+	assert.Equal(t, 2, fluent.connections)
+}
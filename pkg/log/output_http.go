@@ -0,0 +1,128 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// RetryConfig configures how network outputs retry requests that failed with a transient error
+type RetryConfig struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// NewRetryConfig initializes a new RetryConfig with the defaults used by the network outputs
+func NewRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxRetries: 5,
+		MinBackoff: 500 * time.Millisecond,
+		MaxBackoff: 30 * time.Second,
+	}
+}
+
+// backoff returns how long to wait before the provided retry attempt, but never less than the delay requested by the server
+func (config RetryConfig) backoff(attempt int, requested time.Duration) time.Duration {
+	delay := config.MinBackoff
+	for i := 1; i < attempt && delay < config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if config.MaxBackoff > 0 && delay > config.MaxBackoff {
+		delay = config.MaxBackoff
+	}
+	if requested > delay {
+		delay = requested
+	}
+	return delay
+}
+
+// An HTTPError is returned by network outputs when the server rejected a request
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay requested by the Retry-After header of the response
+	RetryAfter time.Duration
+}
+
+func (err *HTTPError) Error() string {
+	if err.Body == "" {
+		return fmt.Sprintf("request failed with status %d", err.StatusCode)
+	}
+	return fmt.Sprintf("request failed with status %d: %s", err.StatusCode, err.Body)
+}
+
+// isRetryableStatus reports if a request that failed with the status code may succeed when sent again
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// sendWithRetry sends the request built by newRequest and retries it with exponential backoff as long as the
+// request fails with a network error or a retryable status code, honoring the Retry-After header of the response.
+// The body of the first successful response is returned.
+func sendWithRetry(client *http.Client, clk clock.Clock, config RetryConfig, newRequest func() (*http.Request, error)) (body []byte, err error) {
+	for attempt := 0; ; attempt++ {
+		var requested time.Duration
+		body, requested, err = send(client, clk, newRequest)
+		if err == nil {
+			return body, nil
+		}
+
+		if httpErr, ok := err.(*HTTPError); ok && !isRetryableStatus(httpErr.StatusCode) {
+			return nil, err
+		}
+		if attempt >= config.MaxRetries {
+			return nil, err
+		}
+		clk.Sleep(config.backoff(attempt+1, requested))
+	}
+}
+
+func send(client *http.Client, clk clock.Clock, newRequest func() (*http.Request, error)) (body []byte, retryAfter time.Duration, err error) {
+	request, err := newRequest()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	body, err = ioutil.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		retryAfter := parseRetryAfter(clk, response.Header.Get("Retry-After"))
+		return nil, retryAfter, &HTTPError{StatusCode: response.StatusCode, Body: string(body), RetryAfter: retryAfter}
+	}
+	return body, 0, nil
+}
+
+// parseRetryAfter parses the value of a Retry-After header which is either a number of seconds or a http date
+func parseRetryAfter(clk clock.Clock, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(clk.Now()); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
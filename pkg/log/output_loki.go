@@ -0,0 +1,331 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/golang/snappy"
+)
+
+// LokiOverflowValue replaces the values of derived labels once the maximum number of distinct values is reached
+const LokiOverflowValue = "_overflow"
+
+// LokiOutput pushes records to a Grafana Loki server using its push API
+type LokiOutput struct {
+	RetryConfig
+	Endpoint       string
+	Headers        map[string]string
+	Formatter      Formatter
+	Labels         map[string]string
+	LevelLabel     string
+	PackageLabel   string
+	FieldLabels    []string
+	MaxLabelValues int
+	Protobuf       bool
+	BatchSize      int
+	FlushInterval  time.Duration
+	Client         *http.Client
+	Clock          clock.Clock
+
+	mutex       sync.Mutex
+	labelValues map[string]map[string]bool
+	batcher     *BatchingOutput
+	startOnce   sync.Once
+}
+
+type lokiEntry struct {
+	labels    map[string]string
+	timestamp time.Time
+	line      string
+}
+
+// NewLokiOutput initializes a new LokiOutput sending to the push endpoint of a server (e.g. http://localhost:3100/loki/api/v1/push)
+func NewLokiOutput(endpoint string) *LokiOutput {
+	formatter := NewLogfmtFormatter()
+	formatter.TimestampDisabled = true
+
+	return &LokiOutput{
+		RetryConfig:    NewRetryConfig(),
+		Endpoint:       endpoint,
+		Headers:        map[string]string{},
+		Formatter:      formatter,
+		Labels:         map[string]string{},
+		LevelLabel:     "level",
+		MaxLabelValues: 100,
+		BatchSize:      100,
+		FlushInterval:  5 * time.Second,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+		Clock:          clock.New(),
+	}
+}
+
+// WriteRecord renders the record with the formatter of the output and adds it to the current batch, which is pushed in
+// the background once it is full
+func (o *LokiOutput) WriteRecord(record *Record) error {
+	o.start()
+
+	encoded, err := o.encode(record)
+	if err != nil {
+		return err
+	}
+	return o.batcher.WriteRecord(encoded)
+}
+
+// Flush pushes all buffered records to the server, batches that failed with a retryable error are kept for the next
+// attempt
+func (o *LokiOutput) Flush() error {
+	o.start()
+	return o.batcher.Flush()
+}
+
+// Close pushes all remaining records
+func (o *LokiOutput) Close() error {
+	o.start()
+	return o.batcher.Close()
+}
+
+// sendSpooled sends the records replayed by a SpoolOutput on the calling goroutine, bypassing the background sending
+func (o *LokiOutput) sendSpooled(records []*Record) (handled int, retryable bool, err error) {
+	o.start()
+	return o.batcher.sendRecords(records, o.encode)
+}
+
+// encode returns a copy of the record holding its rendered line and labels
+func (o *LokiOutput) encode(record *Record) (*Record, error) {
+	var line string
+	if recordFormatter, ok := o.Formatter.(RecordFormatter); ok {
+		line = recordFormatter.FormatRecord(record)
+	} else {
+		line = o.Formatter.Format(record.Level, record.Message)
+	}
+
+	timestamp := record.Time
+	if timestamp.IsZero() {
+		timestamp = o.Clock.Now()
+	}
+
+	// the labels are derived while holding the lock as they update the seen label values
+	o.mutex.Lock()
+	labels := o.labels(record)
+	o.mutex.Unlock()
+
+	return withEncoded(record, lokiEntry{
+		labels:    labels,
+		timestamp: timestamp,
+		line:      strings.TrimSuffix(line, "\n"),
+	}), nil
+}
+
+func (o *LokiOutput) start() {
+	o.startOnce.Do(func() {
+		o.batcher = newOutputBatcher(SinkFunc(o.sendBatch), o.RetryConfig, o.BatchSize, o.FlushInterval, o.Clock)
+	})
+}
+
+func (o *LokiOutput) sendBatch(ctx context.Context, batch []*Record) error {
+	entries := make([]lokiEntry, 0, len(batch))
+	for _, record := range batch {
+		entries = append(entries, record.encoded.(lokiEntry))
+	}
+	streams := groupLokiStreams(entries)
+
+	var payload []byte
+	var contentType string
+	if o.Protobuf {
+		payload = snappy.Encode(nil, encodeLokiProtobuf(streams))
+		contentType = "application/x-protobuf"
+	} else {
+		var err error
+		if payload, err = encodeLokiJSON(streams); err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+
+	_, _, err := send(o.Client, o.Clock, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.Endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", contentType)
+		for key, value := range o.Headers {
+			request.Header.Set(key, value)
+		}
+		return request, nil
+	})
+	return err
+}
+
+// labels returns the static labels of the output combined with the labels derived from the record
+func (o *LokiOutput) labels(record *Record) map[string]string {
+	labels := map[string]string{}
+	for name, value := range o.Labels {
+		labels[name] = value
+	}
+
+	if o.LevelLabel != "" {
+		labels[o.LevelLabel] = strings.ToLower(record.Level.String())
+	}
+	if o.PackageLabel != "" && record.Package != "" {
+		labels[o.PackageLabel] = o.limitLabelValue(o.PackageLabel, record.Package)
+	}
+	for _, key := range o.FieldLabels {
+		for _, field := range record.Fields {
+			if field.Key == key {
+				name := lokiLabelName(key)
+				labels[name] = o.limitLabelValue(name, fmt.Sprint(fieldValue(field.Interface())))
+			}
+		}
+	}
+	return labels
+}
+
+// limitLabelValue replaces the value with LokiOverflowValue if the label would exceed its maximum number of distinct values
+func (o *LokiOutput) limitLabelValue(name string, value string) string {
+	if o.MaxLabelValues <= 0 {
+		return value
+	}
+
+	if o.labelValues == nil {
+		o.labelValues = map[string]map[string]bool{}
+	}
+	values, ok := o.labelValues[name]
+	if !ok {
+		values = map[string]bool{}
+		o.labelValues[name] = values
+	}
+
+	if !values[value] {
+		if len(values) >= o.MaxLabelValues {
+			return LokiOverflowValue
+		}
+		values[value] = true
+	}
+	return value
+}
+
+// lokiLabelName converts a field key to a valid label name by replacing all unsupported characters with underscores
+func lokiLabelName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')
+		if !valid {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+type lokiStream struct {
+	labels  map[string]string
+	entries []lokiEntry
+}
+
+// groupLokiStreams groups entries with identical labels into streams, keeping the order in which they were written
+func groupLokiStreams(entries []lokiEntry) []*lokiStream {
+	streams := []*lokiStream{}
+	index := map[string]*lokiStream{}
+	for _, entry := range entries {
+		key := formatLokiLabels(entry.labels)
+		stream, ok := index[key]
+		if !ok {
+			stream = &lokiStream{labels: entry.labels}
+			index[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.entries = append(stream.entries, entry)
+	}
+	return streams
+}
+
+// formatLokiLabels renders labels in the prometheus selector format used by the protobuf push request
+func formatLokiLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	builder := &strings.Builder{}
+	builder.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(name)
+		builder.WriteString("=")
+		builder.WriteString(strconv.Quote(labels[name]))
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
+
+func encodeLokiJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	request := struct {
+		Streams []jsonStream `json:"streams"`
+	}{Streams: []jsonStream{}}
+
+	for _, stream := range streams {
+		values := make([][2]string, 0, len(stream.entries))
+		for _, entry := range stream.entries {
+			values = append(values, [2]string{strconv.FormatInt(entry.timestamp.UnixNano(), 10), entry.line})
+		}
+		request.Streams = append(request.Streams, jsonStream{Stream: stream.labels, Values: values})
+	}
+	return json.Marshal(request)
+}
+
+// encodeLokiProtobuf encodes the streams as logproto.PushRequest message
+func encodeLokiProtobuf(streams []*lokiStream) []byte {
+	request := []byte{}
+	for _, stream := range streams {
+		message := appendProtobufString(nil, 1, formatLokiLabels(stream.labels))
+		for _, entry := range stream.entries {
+			timestamp := appendProtobufVarint(nil, 1, uint64(entry.timestamp.Unix()))
+			timestamp = appendProtobufVarint(timestamp, 2, uint64(entry.timestamp.Nanosecond()))
+
+			entryMessage := appendProtobufBytes(nil, 1, timestamp)
+			entryMessage = appendProtobufString(entryMessage, 2, entry.line)
+			message = appendProtobufBytes(message, 2, entryMessage)
+		}
+		request = appendProtobufBytes(request, 1, message)
+	}
+	return request
+}
+
+func appendProtobufVarint(buffer []byte, field int, value uint64) []byte {
+	buffer = appendUvarint(buffer, uint64(field<<3))
+	return appendUvarint(buffer, value)
+}
+
+func appendProtobufBytes(buffer []byte, field int, value []byte) []byte {
+	buffer = appendUvarint(buffer, uint64(field<<3|2))
+	buffer = appendUvarint(buffer, uint64(len(value)))
+	return append(buffer, value...)
+}
+
+func appendProtobufString(buffer []byte, field int, value string) []byte {
+	return appendProtobufBytes(buffer, field, []byte(value))
+}
+
+func appendUvarint(buffer []byte, value uint64) []byte {
+	for value >= 0x80 {
+		buffer = append(buffer, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(buffer, byte(value))
+}
@@ -0,0 +1,207 @@
+package log_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+type lokiStream struct {
+	Labels string
+	Stream map[string]string
+	Lines  []string
+}
+
+// fakeLoki decodes push requests in both the json and the snappy compressed protobuf format
+type fakeLoki struct {
+	mutex        sync.Mutex
+	contentTypes []string
+	streams      []lokiStream
+}
+
+func (l *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	l.contentTypes = append(l.contentTypes, r.Header.Get("Content-Type"))
+
+	if r.Header.Get("Content-Type") == "application/x-protobuf" {
+		decoded, err := snappy.Decode(nil, body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, stream := range decodeProtobuf(decoded)[1] {
+			fields := decodeProtobuf(stream)
+			decodedStream := lokiStream{Labels: string(fields[1][0])}
+			for _, entry := range fields[2] {
+				decodedStream.Lines = append(decodedStream.Lines, string(decodeProtobuf(entry)[2][0]))
+			}
+			l.streams = append(l.streams, decodedStream)
+		}
+	} else {
+		request := struct {
+			Streams []struct {
+				Stream map[string]string `json:"stream"`
+				Values [][2]string       `json:"values"`
+			} `json:"streams"`
+		}{}
+		if err := json.Unmarshal(body, &request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, stream := range request.Streams {
+			decodedStream := lokiStream{Stream: stream.Stream}
+			for _, value := range stream.Values {
+				decodedStream.Lines = append(decodedStream.Lines, value[1])
+			}
+			l.streams = append(l.streams, decodedStream)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeProtobuf decodes the length delimited fields of a protobuf message, skipping all varint fields
+func decodeProtobuf(message []byte) map[int][][]byte {
+	fields := map[int][][]byte{}
+	for len(message) > 0 {
+		key, n := readUvarint(message)
+		message = message[n:]
+		if key&7 == 0 {
+			_, n = readUvarint(message)
+			message = message[n:]
+			continue
+		}
+		length, n := readUvarint(message)
+		message = message[n:]
+		fields[int(key>>3)] = append(fields[int(key>>3)], message[:length])
+		message = message[length:]
+	}
+	return fields
+}
+
+func readUvarint(buffer []byte) (value uint64, n int) {
+	for shift := uint(0); ; shift += 7 {
+		b := buffer[n]
+		n++
+		value |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return value, n
+		}
+	}
+}
+
+func prepareTestLokiOutput(url string) *log.LokiOutput {
+	output := log.NewLokiOutput(url + "/loki/api/v1/push")
+	output.FlushInterval = 0
+	output.Labels["app"] = "test"
+	formatter := log.NewLogfmtFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	output.Formatter = formatter
+	return output
+}
+
+func TestLokiOutput(t *testing.T) {
+	loki := &fakeLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	output := prepareTestLokiOutput(server.URL)
+	output.FieldLabels = []string{"tenant.id"}
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+
+	logger.WithFields(log.Field{Key: "tenant.id", Value: "a"}).Info("first message")
+	logger.Error("second message")
+	logger.WithFields(log.Field{Key: "tenant.id", Value: "a"}).Info("third message")
+	assert.NoError(t, logger.Close())
+
+	assert.Equal(t, []string{"application/json"}, loki.contentTypes)
+	assert.Equal(t, []lokiStream{
+		{
+			Stream: map[string]string{"app": "test", "level": "info", "tenant_id": "a"},
+			Lines:  []string{"level=INFO msg=\"first message\" tenant.id=a", "level=INFO msg=\"third message\" tenant.id=a"},
+		},
+		{
+			Stream: map[string]string{"app": "test", "level": "error"},
+			Lines:  []string{"level=ERROR msg=\"second message\""},
+		},
+	}, loki.streams)
+}
+
+func TestLokiOutputJSONFormatter(t *testing.T) {
+	loki := &fakeLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	output := prepareTestLokiOutput(server.URL)
+	output.LevelLabel = ""
+	output.PackageLabel = "package"
+	formatter := log.NewJSONFormatter()
+	formatter.TimestampDisabled = true
+	output.Formatter = formatter
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	logger.Info("this is a test message")
+	assert.NoError(t, logger.Close())
+
+	packageName := "github.com/timbasel/go-log/pkg/log_test"
+	assert.Equal(t, []lokiStream{{
+		Stream: map[string]string{"app": "test", "package": packageName},
+		Lines:  []string{"{\"function\":\"TestLokiOutputJSONFormatter\",\"level\":\"INFO\",\"msg\":\"this is a test message\",\"package\":\"" + packageName + "\"}"},
+	}}, loki.streams)
+}
+
+func TestLokiOutputLabelCardinality(t *testing.T) {
+	loki := &fakeLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	output := prepareTestLokiOutput(server.URL)
+	output.LevelLabel = ""
+	output.FieldLabels = []string{"user"}
+	output.MaxLabelValues = 2
+
+	for _, user := range []string{"alice", "bob", "carol", "alice"} {
+		output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: user, Fields: []log.Field{{Key: "user", Value: user}}})
+	}
+	assert.NoError(t, output.Flush())
+
+	users := []string{}
+	for _, stream := range loki.streams {
+		users = append(users, stream.Stream["user"])
+	}
+	assert.Equal(t, []string{"alice", "bob", log.LokiOverflowValue}, users)
+	assert.Len(t, loki.streams[0].Lines, 2)
+	assert.Equal(t, []string{"level=INFO msg=carol user=carol"}, loki.streams[2].Lines)
+}
+
+func TestLokiOutputProtobuf(t *testing.T) {
+	loki := &fakeLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	output := prepareTestLokiOutput(server.URL)
+	output.Protobuf = true
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "second message"})
+	assert.NoError(t, output.Flush())
+
+	assert.Equal(t, []string{"application/x-protobuf"}, loki.contentTypes)
+	assert.Equal(t, []lokiStream{
+		{Labels: "{app=\"test\", level=\"info\"}", Lines: []string{"level=INFO msg=\"first message\""}},
+		{Labels: "{app=\"test\", level=\"error\"}", Lines: []string{"level=ERROR msg=\"second message\""}},
+	}, loki.streams)
+}
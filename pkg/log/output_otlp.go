@@ -0,0 +1,288 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/acarl005/stripansi"
+	"github.com/benbjohnson/clock"
+)
+
+// OTLPOutput exports records to an OpenTelemetry collector as OTLP/HTTP JSON log requests
+type OTLPOutput struct {
+	RetryConfig
+	Endpoint           string
+	Headers            map[string]string
+	ResourceAttributes map[string]string
+	ScopeName          string
+	BatchSize          int
+	FlushInterval      time.Duration
+	Client             *http.Client
+	Clock              clock.Clock
+
+	batcher   *BatchingOutput
+	startOnce sync.Once
+}
+
+// NewOTLPOutput initializes a new OTLPOutput sending to the logs endpoint of a collector (e.g. http://localhost:4318/v1/logs)
+func NewOTLPOutput(endpoint string, serviceName string) *OTLPOutput {
+	return &OTLPOutput{
+		RetryConfig:        NewRetryConfig(),
+		Endpoint:           endpoint,
+		Headers:            map[string]string{},
+		ResourceAttributes: map[string]string{"service.name": serviceName},
+		ScopeName:          "github.com/timbasel/go-log",
+		BatchSize:          100,
+		FlushInterval:      5 * time.Second,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		Clock:              clock.New(),
+	}
+}
+
+// WriteRecord converts the record to an OTLP log record and adds it to the current batch, which is exported in the
+// background once it is full
+func (o *OTLPOutput) WriteRecord(record *Record) error {
+	o.start()
+
+	encoded, err := o.encode(record)
+	if err != nil {
+		return err
+	}
+	return o.batcher.WriteRecord(encoded)
+}
+
+// Flush exports all buffered records, batches that failed with a retryable error are kept for the next attempt
+func (o *OTLPOutput) Flush() error {
+	o.start()
+	return o.batcher.Flush()
+}
+
+// Close exports all remaining records
+func (o *OTLPOutput) Close() error {
+	o.start()
+	return o.batcher.Close()
+}
+
+// sendSpooled sends the records replayed by a SpoolOutput on the calling goroutine, bypassing the background sending
+func (o *OTLPOutput) sendSpooled(records []*Record) (handled int, retryable bool, err error) {
+	o.start()
+	return o.batcher.sendRecords(records, o.encode)
+}
+
+// encode returns a copy of the record holding its OTLP log record
+func (o *OTLPOutput) encode(record *Record) (*Record, error) {
+	return withEncoded(record, o.newLogRecord(record)), nil
+}
+
+func (o *OTLPOutput) start() {
+	o.startOnce.Do(func() {
+		o.batcher = newOutputBatcher(SinkFunc(o.sendBatch), o.RetryConfig, o.BatchSize, o.FlushInterval, o.Clock)
+	})
+}
+
+func (o *OTLPOutput) sendBatch(ctx context.Context, batch []*Record) error {
+	logRecords := make([]otlpLogRecord, 0, len(batch))
+	for _, record := range batch {
+		logRecords = append(logRecords, record.encoded.(otlpLogRecord))
+	}
+
+	payload, err := json.Marshal(o.newRequest(logRecords))
+	if err != nil {
+		return err
+	}
+
+	_, _, err = send(o.Client, o.Clock, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.Endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		for key, value := range o.Headers {
+			request.Header.Set(key, value)
+		}
+		return request, nil
+	})
+	return err
+}
+
+func (o *OTLPOutput) newRequest(logRecords []otlpLogRecord) otlpLogsRequest {
+	resource := otlpResource{Attributes: []otlpKeyValue{}}
+	keys := make([]string, 0, len(o.ResourceAttributes))
+	for key := range o.ResourceAttributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		resource.Attributes = append(resource.Attributes, otlpKeyValue{Key: key, Value: otlpValue(o.ResourceAttributes[key])})
+	}
+
+	return otlpLogsRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource: resource,
+		ScopeLogs: []otlpScopeLogs{{
+			Scope:      otlpScope{Name: o.ScopeName},
+			LogRecords: logRecords,
+		}},
+	}}}
+}
+
+func (o *OTLPOutput) newLogRecord(record *Record) otlpLogRecord {
+	timestamp := record.Time
+	if timestamp.IsZero() {
+		timestamp = o.Clock.Now()
+	}
+	unixNano := strconv.FormatInt(timestamp.UnixNano(), 10)
+
+	logRecord := otlpLogRecord{
+		TimeUnixNano:         unixNano,
+		ObservedTimeUnixNano: unixNano,
+		SeverityNumber:       otlpSeverityNumber(record.Level),
+		SeverityText:         record.Level.String(),
+		Body:                 otlpValue(stripansi.Strip(record.Message)),
+		Attributes:           []otlpKeyValue{},
+	}
+
+	if record.Package != "" {
+		logRecord.Attributes = append(logRecord.Attributes, otlpKeyValue{Key: "code.namespace", Value: otlpValue(record.Package)})
+	}
+	if record.Function != "" {
+		logRecord.Attributes = append(logRecord.Attributes, otlpKeyValue{Key: "code.function", Value: otlpValue(record.Function)})
+	}
+	if record.Caller != nil && record.Caller.File != "" {
+		logRecord.Attributes = append(logRecord.Attributes,
+			otlpKeyValue{Key: "code.filepath", Value: otlpValue(record.Caller.File)},
+			otlpKeyValue{Key: "code.lineno", Value: otlpIntValue(int64(record.Caller.Line))})
+	}
+
+	for _, field := range record.Fields {
+		switch field.Key {
+		case TraceIDField:
+			logRecord.TraceID = formatTraceID(field.Interface())
+		case SpanIDField:
+			logRecord.SpanID = formatTraceID(field.Interface())
+		default:
+			logRecord.Attributes = append(logRecord.Attributes, otlpKeyValue{Key: field.Key, Value: otlpValue(field.Interface())})
+		}
+	}
+
+	return logRecord
+}
+
+// otlpSeverityNumber maps a level to the matching OpenTelemetry SeverityNumber
+func otlpSeverityNumber(level Level) int {
+	switch level {
+	case DebugLevel:
+		return 5
+	case InfoLevel:
+		return 9
+	case ErrorLevel:
+		return 17
+	}
+	return 0
+}
+
+func otlpValue(value interface{}) otlpAnyValue {
+	switch v := value.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		return otlpIntValue(int64(v))
+	case int8:
+		return otlpIntValue(int64(v))
+	case int16:
+		return otlpIntValue(int64(v))
+	case int32:
+		return otlpIntValue(int64(v))
+	case int64:
+		return otlpIntValue(v)
+	case uint8:
+		return otlpIntValue(int64(v))
+	case uint16:
+		return otlpIntValue(int64(v))
+	case uint32:
+		return otlpIntValue(int64(v))
+	case uint:
+		return otlpUintValue(uint64(v))
+	case uint64:
+		return otlpUintValue(v)
+	case uintptr:
+		return otlpUintValue(uint64(v))
+	case float32:
+		double := float64(v)
+		return otlpAnyValue{DoubleValue: &double}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	}
+
+	str := fmt.Sprint(fieldValue(value))
+	return otlpAnyValue{StringValue: &str}
+}
+
+func otlpIntValue(value int64) otlpAnyValue {
+	str := strconv.FormatInt(value, 10)
+	return otlpAnyValue{IntValue: &str}
+}
+
+// otlpUintValue encodes unsigned integers as int values, values that do not fit into the signed 64 bit int values of
+// OTLP are sent as strings
+func otlpUintValue(value uint64) otlpAnyValue {
+	if value > math.MaxInt64 {
+		str := strconv.FormatUint(value, 10)
+		return otlpAnyValue{StringValue: &str}
+	}
+	return otlpIntValue(int64(value))
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId,omitempty"`
+	SpanID               string         `json:"spanId,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
@@ -0,0 +1,225 @@
+package log_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+type otlpCollector struct {
+	mutex    sync.Mutex
+	requests []map[string]interface{}
+	headers  []http.Header
+	times    []time.Time
+	clock    clock.Clock
+	statuses []int
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	request := map[string]interface{}{}
+	json.Unmarshal(body, &request)
+	c.requests = append(c.requests, request)
+	c.headers = append(c.headers, r.Header)
+	if c.clock != nil {
+		c.times = append(c.times, c.clock.Now())
+	}
+
+	if len(c.statuses) > 0 {
+		status := c.statuses[0]
+		c.statuses = c.statuses[1:]
+		if status != http.StatusOK {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(status)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *otlpCollector) requestCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.requests)
+}
+
+func otlpLogRecords(request map[string]interface{}) []interface{} {
+	resourceLogs := request["resourceLogs"].([]interface{})[0].(map[string]interface{})
+	scopeLogs := resourceLogs["scopeLogs"].([]interface{})[0].(map[string]interface{})
+	return scopeLogs["logRecords"].([]interface{})
+}
+
+func otlpAttributes(logRecord map[string]interface{}) map[string]interface{} {
+	attributes := map[string]interface{}{}
+	for _, attribute := range logRecord["attributes"].([]interface{}) {
+		keyValue := attribute.(map[string]interface{})
+		attributes[keyValue["key"].(string)] = keyValue["value"]
+	}
+	return attributes
+}
+
+func TestOTLPOutput(t *testing.T) {
+	requireDebug(t)
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	output := log.NewOTLPOutput(server.URL+"/v1/logs", "test-service")
+	output.Headers["Authorization"] = "Bearer secret"
+	output.FlushInterval = 0
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	logger.SetDebugMode(true)
+
+	logger.WithFields(
+		log.Field{Key: "user", Value: "alice"},
+		log.Field{Key: "attempt", Value: 3},
+		log.Field{Key: "size", Value: uint64(7)},
+		log.Field{Key: "huge", Value: uint64(math.MaxUint64)},
+		log.Field{Key: log.TraceIDField, Value: "5b8efff798038103d269b633813fc60c"},
+		log.Field{Key: log.SpanIDField, Value: "eee19b7ec3c1b174"},
+	).Error("this is a test message")
+	logger.Debug("this is a debug message")
+	assert.Equal(t, 0, collector.requestCount())
+
+	assert.NoError(t, logger.Close())
+	assert.Equal(t, 1, collector.requestCount())
+	assert.Equal(t, "application/json", collector.headers[0].Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", collector.headers[0].Get("Authorization"))
+
+	request := collector.requests[0]
+	resource := request["resourceLogs"].([]interface{})[0].(map[string]interface{})["resource"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"stringValue": "test-service"}, otlpAttributes(resource)["service.name"])
+
+	logRecords := otlpLogRecords(request)
+	assert.Len(t, logRecords, 2)
+
+	errorRecord := logRecords[0].(map[string]interface{})
+	assert.Equal(t, float64(17), errorRecord["severityNumber"])
+	assert.Equal(t, "ERROR", errorRecord["severityText"])
+	assert.Equal(t, map[string]interface{}{"stringValue": "this is a test message"}, errorRecord["body"])
+	assert.Equal(t, "5b8efff798038103d269b633813fc60c", errorRecord["traceId"])
+	assert.Equal(t, "eee19b7ec3c1b174", errorRecord["spanId"])
+	assert.NotEmpty(t, errorRecord["timeUnixNano"])
+
+	attributes := otlpAttributes(errorRecord)
+	assert.Equal(t, map[string]interface{}{"stringValue": "github.com/timbasel/go-log/pkg/log_test"}, attributes["code.namespace"])
+	assert.Equal(t, map[string]interface{}{"stringValue": "TestOTLPOutput"}, attributes["code.function"])
+	assert.Equal(t, map[string]interface{}{"stringValue": "alice"}, attributes["user"])
+	assert.Equal(t, map[string]interface{}{"intValue": "3"}, attributes["attempt"])
+	assert.Equal(t, map[string]interface{}{"intValue": "7"}, attributes["size"])
+	assert.Equal(t, map[string]interface{}{"stringValue": "18446744073709551615"}, attributes["huge"])
+	assert.True(t, strings.HasSuffix(attributes["code.filepath"].(map[string]interface{})["stringValue"].(string), "output_otlp_test.go"))
+	assert.NotEmpty(t, attributes["code.lineno"].(map[string]interface{})["intValue"])
+	assert.NotContains(t, attributes, log.TraceIDField)
+
+	debugRecord := logRecords[1].(map[string]interface{})
+	assert.Equal(t, float64(5), debugRecord["severityNumber"])
+	assert.Equal(t, "DEBUG", debugRecord["severityText"])
+	assert.NotContains(t, debugRecord, "traceId")
+}
+
+func TestOTLPOutputBatchSize(t *testing.T) {
+	collector := &otlpCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	output := log.NewOTLPOutput(server.URL, "test-service")
+	output.FlushInterval = 0
+	output.BatchSize = 2
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+
+	logger.Info("first")
+	assert.Equal(t, 0, collector.requestCount())
+	logger.Info("second")
+	waitUntil(func() bool { return collector.requestCount() == 1 })
+	assert.Equal(t, 1, collector.requestCount())
+	assert.Len(t, otlpLogRecords(collector.requests[0]), 2)
+
+	assert.NoError(t, output.Close())
+	assert.NoError(t, output.Close())
+	assert.Equal(t, log.ErrOutputClosed, output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "third"}))
+}
+
+func TestOTLPOutputRetryAfter(t *testing.T) {
+	mock := clock.NewMock()
+	collector := &otlpCollector{clock: mock, statuses: []int{http.StatusServiceUnavailable, http.StatusOK}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	output := log.NewOTLPOutput(server.URL, "test-service")
+	output.FlushInterval = 0
+	output.Clock = mock
+	output.MinBackoff = 100 * time.Millisecond
+
+	assert.NoError(t, output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"}))
+
+	done := make(chan error)
+	go func() { done <- output.Flush() }()
+
+	for {
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+			assert.Equal(t, 2, collector.requestCount())
+			assert.True(t, collector.times[1].Sub(collector.times[0]) >= 2*time.Second)
+			return
+		default:
+			if collector.requestCount() > 0 {
+				mock.Add(500 * time.Millisecond)
+			} else {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestOTLPOutputNonRetryableStatus(t *testing.T) {
+	collector := &otlpCollector{statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	output := log.NewOTLPOutput(server.URL, "test-service")
+	output.FlushInterval = 0
+
+	assert.NoError(t, output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"}))
+	err := output.Flush()
+
+	assert.IsType(t, &log.HTTPError{}, err)
+	assert.Equal(t, http.StatusBadRequest, err.(*log.HTTPError).StatusCode)
+	assert.Equal(t, 1, collector.requestCount())
+}
+
+func TestOTLPOutputKeepsFailedBatch(t *testing.T) {
+	collector := &otlpCollector{statuses: []int{http.StatusServiceUnavailable, http.StatusOK}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	output := log.NewOTLPOutput(server.URL, "test-service")
+	output.FlushInterval = 0
+	output.MaxRetries = 0
+
+	assert.NoError(t, output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"}))
+	assert.Error(t, output.Flush())
+
+	// the failed batch is exported again with the next flush
+	assert.NoError(t, output.Flush())
+	assert.Equal(t, 2, collector.requestCount())
+	assert.Len(t, otlpLogRecords(collector.requests[1]), 1)
+}
@@ -0,0 +1,248 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acarl005/stripansi"
+	"github.com/benbjohnson/clock"
+)
+
+// SplunkOutput sends records as events to a Splunk HTTP Event Collector
+type SplunkOutput struct {
+	RetryConfig
+	Endpoint        string
+	Token           string
+	Host            string
+	Source          string
+	SourceType      string
+	Index           string
+	IndexedFields   []string
+	UseAck          bool
+	Channel         string
+	AckTimeout      time.Duration
+	AckPollInterval time.Duration
+	BatchSize       int
+	FlushInterval   time.Duration
+	Client          *http.Client
+	Clock           clock.Clock
+
+	batcher   *BatchingOutput
+	startOnce sync.Once
+}
+
+// NewSplunkOutput initializes a new SplunkOutput sending to the event endpoint of a collector (e.g. https://localhost:8088/services/collector/event)
+func NewSplunkOutput(endpoint string, token string) *SplunkOutput {
+	host, _ := os.Hostname()
+	return &SplunkOutput{
+		RetryConfig:     NewRetryConfig(),
+		Endpoint:        endpoint,
+		Token:           token,
+		Host:            host,
+		Source:          "go-log",
+		SourceType:      "_json",
+		AckTimeout:      30 * time.Second,
+		AckPollInterval: time.Second,
+		BatchSize:       100,
+		FlushInterval:   5 * time.Second,
+		Client:          &http.Client{Timeout: 10 * time.Second},
+		Clock:           clock.New(),
+	}
+}
+
+// WriteRecord converts the record to an event and adds it to the current batch, which is sent in the background once it
+// is full
+func (o *SplunkOutput) WriteRecord(record *Record) error {
+	o.start()
+
+	encoded, err := o.encode(record)
+	if err != nil {
+		return err
+	}
+	return o.batcher.WriteRecord(encoded)
+}
+
+// Flush sends all buffered events and waits for their acknowledgement if enabled, batches that failed with a retryable
+// error or were not acknowledged are kept for the next attempt
+func (o *SplunkOutput) Flush() error {
+	o.start()
+	return o.batcher.Flush()
+}
+
+// Close sends all remaining events
+func (o *SplunkOutput) Close() error {
+	o.start()
+	return o.batcher.Close()
+}
+
+// sendSpooled sends the records replayed by a SpoolOutput on the calling goroutine, bypassing the background sending
+func (o *SplunkOutput) sendSpooled(records []*Record) (handled int, retryable bool, err error) {
+	o.start()
+	return o.batcher.sendRecords(records, o.encode)
+}
+
+// encode returns a copy of the record holding its event
+func (o *SplunkOutput) encode(record *Record) (*Record, error) {
+	event, err := json.Marshal(o.newEvent(record))
+	if err != nil {
+		return nil, err
+	}
+	return withEncoded(record, event), nil
+}
+
+func (o *SplunkOutput) start() {
+	o.startOnce.Do(func() {
+		if o.UseAck && o.Channel == "" {
+			o.Channel = newChannelID()
+		}
+		o.batcher = newOutputBatcher(SinkFunc(o.sendBatch), o.RetryConfig, o.BatchSize, o.FlushInterval, o.Clock)
+	})
+}
+
+// sendBatch sends the events of the batch, if acks are enabled the batch only succeeds once the collector acknowledged it
+func (o *SplunkOutput) sendBatch(ctx context.Context, batch []*Record) error {
+	events := make([][]byte, 0, len(batch))
+	for _, record := range batch {
+		events = append(events, record.encoded.([]byte))
+	}
+	payload := bytes.Join(events, []byte("\n"))
+
+	body, _, err := send(o.Client, o.Clock, func() (*http.Request, error) {
+		return o.newRequest(ctx, o.Endpoint, payload)
+	})
+	if err != nil || !o.UseAck {
+		return err
+	}
+
+	response := struct {
+		AckID *int64 `json:"ackId"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	if response.AckID == nil {
+		return fmt.Errorf("collector did not return an ack id for channel %s", o.Channel)
+	}
+
+	acked, err := o.waitForAck(ctx, *response.AckID)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("events with ack id %d were not acknowledged within %s", *response.AckID, o.AckTimeout)
+	}
+	return nil
+}
+
+// waitForAck polls the ack endpoint of the collector until the events are acknowledged or the ack timeout is reached
+func (o *SplunkOutput) waitForAck(ctx context.Context, ackID int64) (acked bool, err error) {
+	endpoint := strings.TrimSuffix(o.Endpoint, "/event") + "/ack?channel=" + o.Channel
+	payload, _ := json.Marshal(map[string][]int64{"acks": {ackID}})
+	deadline := o.Clock.Now().Add(o.AckTimeout)
+
+	for {
+		body, err := sendWithRetry(o.Client, o.Clock, o.RetryConfig, func() (*http.Request, error) {
+			return o.newRequest(ctx, endpoint, payload)
+		})
+		if err != nil {
+			return false, err
+		}
+
+		response := struct {
+			Acks map[string]bool `json:"acks"`
+		}{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return false, err
+		}
+		if response.Acks[fmt.Sprint(ackID)] {
+			return true, nil
+		}
+
+		if !o.Clock.Now().Before(deadline) {
+			return false, nil
+		}
+		o.Clock.Sleep(o.AckPollInterval)
+	}
+}
+
+func (o *SplunkOutput) newRequest(ctx context.Context, endpoint string, payload []byte) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Splunk "+o.Token)
+	if o.Channel != "" {
+		request.Header.Set("X-Splunk-Request-Channel", o.Channel)
+	}
+	return request, nil
+}
+
+func (o *SplunkOutput) newEvent(record *Record) map[string]interface{} {
+	timestamp := record.Time
+	if timestamp.IsZero() {
+		timestamp = o.Clock.Now()
+	}
+
+	body := map[string]interface{}{
+		"message": stripansi.Strip(record.Message),
+		"level":   record.Level.String(),
+	}
+	if record.Package != "" {
+		body["package"] = record.Package
+	}
+	if record.Function != "" {
+		body["function"] = record.Function
+	}
+
+	indexed := map[string]string{}
+	for _, field := range record.Fields {
+		if searchFunctionList(o.IndexedFields, field.Key) {
+			indexed[field.Key] = fmt.Sprint(fieldValue(field.Interface()))
+			continue
+		}
+		key := field.Key
+		if _, reserved := body[key]; reserved {
+			key = "fields." + key
+		}
+		body[key] = fieldValue(field.Interface())
+	}
+
+	event := map[string]interface{}{
+		"time":  json.Number(fmt.Sprintf("%d.%03d", timestamp.Unix(), timestamp.Nanosecond()/int(time.Millisecond))),
+		"event": body,
+	}
+	if o.Host != "" {
+		event["host"] = o.Host
+	}
+	if o.Source != "" {
+		event["source"] = o.Source
+	}
+	if o.SourceType != "" {
+		event["sourcetype"] = o.SourceType
+	}
+	if o.Index != "" {
+		event["index"] = o.Index
+	}
+	if len(indexed) > 0 {
+		event["fields"] = indexed
+	}
+	return event
+}
+
+// newChannelID generates a random UUID used to identify the channel of an ack enabled output
+func newChannelID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
@@ -0,0 +1,201 @@
+package log_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+// fakeSplunk is a minimal HTTP Event Collector that acknowledges events after the configured number of ack polls
+type fakeSplunk struct {
+	mutex       sync.Mutex
+	token       string
+	busy        int
+	pendingAcks int
+	events      []map[string]interface{}
+	channels    []string
+	eventPosts  int
+	ackPolls    int
+}
+
+func (s *fakeSplunk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r.Header.Get("Authorization") != "Splunk "+s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"text":"Invalid token","code":4}`)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/services/collector/event":
+		s.eventPosts++
+		if s.busy > 0 {
+			s.busy--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"text":"Server is busy","code":9}`)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		for {
+			event := map[string]interface{}{}
+			if err := decoder.Decode(&event); err == io.EOF {
+				break
+			} else if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.events = append(s.events, event)
+		}
+		s.channels = append(s.channels, r.Header.Get("X-Splunk-Request-Channel"))
+
+		if r.Header.Get("X-Splunk-Request-Channel") != "" {
+			fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, s.eventPosts)
+		} else {
+			fmt.Fprint(w, `{"text":"Success","code":0}`)
+		}
+	case "/services/collector/ack":
+		s.ackPolls++
+		request := struct {
+			Acks []int `json:"acks"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		acked := s.pendingAcks <= 0
+		s.pendingAcks--
+		fmt.Fprintf(w, `{"acks":{"%d":%t}}`, request.Acks[0], acked)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSplunkOutput(t *testing.T) {
+	splunk := &fakeSplunk{token: "secret"}
+	server := httptest.NewServer(splunk)
+	defer server.Close()
+
+	output := log.NewSplunkOutput(server.URL+"/services/collector/event", "secret")
+	output.FlushInterval = 0
+	output.Host = "test-host"
+	output.Index = "main"
+	output.IndexedFields = []string{"tenant"}
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	logger.WithFields(log.Field{Key: "tenant", Value: 42}, log.Field{Key: "user", Value: "alice"}).Error("this is a test message")
+	logger.Info("another message")
+	assert.NoError(t, logger.Close())
+
+	assert.Equal(t, 1, splunk.eventPosts)
+	assert.Len(t, splunk.events, 2)
+
+	event := splunk.events[0]
+	assert.Equal(t, "test-host", event["host"])
+	assert.Equal(t, "go-log", event["source"])
+	assert.Equal(t, "_json", event["sourcetype"])
+	assert.Equal(t, "main", event["index"])
+	assert.Equal(t, map[string]interface{}{"tenant": "42"}, event["fields"])
+	assert.Equal(t, map[string]interface{}{
+		"message":  "this is a test message",
+		"level":    "ERROR",
+		"package":  "github.com/timbasel/go-log/pkg/log_test",
+		"function": "TestSplunkOutput",
+		"user":     "alice",
+	}, event["event"])
+	assert.InDelta(t, float64(time.Now().UnixNano())/1e9, event["time"], 60)
+	assert.NotContains(t, splunk.events[1], "fields")
+}
+
+func TestSplunkOutputTimestamp(t *testing.T) {
+	splunk := &fakeSplunk{token: "secret"}
+	server := httptest.NewServer(splunk)
+	defer server.Close()
+
+	output := log.NewSplunkOutput(server.URL+"/services/collector/event", "secret")
+	output.FlushInterval = 0
+
+	output.WriteRecord(&log.Record{Time: time.Unix(1697650000, 123456789), Level: log.InfoLevel, Message: "this is a test message"})
+	assert.NoError(t, output.Flush())
+
+	assert.Equal(t, 1697650000.123, splunk.events[0]["time"])
+}
+
+func TestSplunkOutputBusy(t *testing.T) {
+	splunk := &fakeSplunk{token: "secret", busy: 2}
+	server := httptest.NewServer(splunk)
+	defer server.Close()
+
+	output := log.NewSplunkOutput(server.URL+"/services/collector/event", "secret")
+	output.FlushInterval = 0
+	output.MinBackoff = time.Millisecond
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"})
+	assert.NoError(t, output.Flush())
+
+	assert.Equal(t, 3, splunk.eventPosts)
+	assert.Len(t, splunk.events, 1)
+}
+
+func TestSplunkOutputInvalidToken(t *testing.T) {
+	splunk := &fakeSplunk{token: "secret"}
+	server := httptest.NewServer(splunk)
+	defer server.Close()
+
+	output := log.NewSplunkOutput(server.URL+"/services/collector/event", "wrong")
+	output.FlushInterval = 0
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"})
+	err := output.Flush()
+
+	assert.IsType(t, &log.HTTPError{}, err)
+	assert.Equal(t, http.StatusUnauthorized, err.(*log.HTTPError).StatusCode)
+	assert.Empty(t, splunk.events)
+}
+
+func TestSplunkOutputAck(t *testing.T) {
+	splunk := &fakeSplunk{token: "secret", pendingAcks: 2}
+	server := httptest.NewServer(splunk)
+	defer server.Close()
+
+	output := log.NewSplunkOutput(server.URL+"/services/collector/event", "secret")
+	output.FlushInterval = 0
+	output.UseAck = true
+	output.AckPollInterval = time.Millisecond
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"})
+	assert.NoError(t, output.Flush())
+
+	assert.Equal(t, 1, splunk.eventPosts)
+	assert.Equal(t, 3, splunk.ackPolls)
+	assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", splunk.channels[0])
+}
+
+func TestSplunkOutputAckTimeout(t *testing.T) {
+	splunk := &fakeSplunk{token: "secret", pendingAcks: 1000}
+	server := httptest.NewServer(splunk)
+	defer server.Close()
+
+	output := log.NewSplunkOutput(server.URL+"/services/collector/event", "secret")
+	output.FlushInterval = 0
+	output.UseAck = true
+	output.Channel = "00000000-0000-4000-8000-000000000000"
+	output.AckTimeout = 0
+	output.MaxRetries = 1
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"})
+	assert.Error(t, output.Flush())
+
+	// the unacknowledged events are sent again before giving up
+	assert.Equal(t, 2, splunk.eventPosts)
+	assert.Equal(t, []string{output.Channel, output.Channel}, splunk.channels)
+}
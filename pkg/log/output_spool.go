@@ -0,0 +1,454 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// The RecordFlusher interface is implemented by record outputs that buffer records until they are flushed
+type RecordFlusher interface {
+	RecordWriter
+	Flush() error
+}
+
+// A spoolSender is implemented by outputs that send replayed records directly instead of batching them in the
+// background. They report how many leading records were handled and if their error is retryable.
+type spoolSender interface {
+	sendSpooled(records []*Record) (handled int, retryable bool, err error)
+}
+
+// SpoolOutput persists records to segment files in a directory and replays them in order to the wrapped output,
+// deleting a segment only after the wrapped output flushed all of its records successfully. Segments that were not
+// sent yet are picked up again after a restart. Segments that failed with an error that is not retryable are renamed
+// to the .rejected extension and skipped. The network outputs of this package receive the replayed records directly
+// on the sending goroutine. Other wrapped outputs should not flush on their own, otherwise records they sent in the
+// background are sent again if the segment fails later on.
+type SpoolOutput struct {
+	Output        RecordFlusher
+	Directory     string
+	SegmentSize   int64
+	MaxSize       int64
+	SyncWrites    bool
+	FlushInterval time.Duration
+	Clock         clock.Clock
+
+	mutex     sync.Mutex
+	sendMutex sync.Mutex
+	segments  []spoolSegment
+	active    *os.File
+	current   spoolSegment
+	sending   string
+	sequence  uint64
+	size      int64
+	dropped   int64
+	startOnce sync.Once
+	stop      func()
+}
+
+type spoolSegment struct {
+	path string
+	size int64
+}
+
+type spoolRecord struct {
+	Time     time.Time    `json:"time"`
+	Level    Level        `json:"level"`
+	Message  string       `json:"message"`
+	Package  string       `json:"package,omitempty"`
+	Function string       `json:"function,omitempty"`
+	Fields   []spoolField `json:"fields,omitempty"`
+}
+
+type spoolField struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+const (
+	spoolSegmentExtension  = ".spool"
+	spoolRejectedExtension = ".rejected"
+)
+
+// NewSpoolOutput initializes a new SpoolOutput in the directory, resuming all segments left from a previous run
+func NewSpoolOutput(directory string, output RecordFlusher) (*SpoolOutput, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	o := &SpoolOutput{
+		Output:        output,
+		Directory:     directory,
+		SegmentSize:   4 << 20,
+		MaxSize:       256 << 20,
+		FlushInterval: 5 * time.Second,
+		Clock:         clock.New(),
+	}
+
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, spoolSegmentExtension) {
+			continue
+		}
+		sequence, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		if file.Size() == 0 {
+			os.Remove(filepath.Join(directory, name))
+			continue
+		}
+		o.segments = append(o.segments, spoolSegment{path: filepath.Join(directory, name), size: file.Size()})
+		o.size += file.Size()
+		if sequence >= o.sequence {
+			o.sequence = sequence + 1
+		}
+	}
+	sort.Slice(o.segments, func(i, j int) bool { return o.segments[i].path < o.segments[j].path })
+
+	return o, nil
+}
+
+// WriteRecord appends the record to the active segment, evicting the oldest segments if the spool is full
+func (o *SpoolOutput) WriteRecord(record *Record) error {
+	o.startOnce.Do(func() {
+		o.stop = startFlushLoop(o.Clock, o.FlushInterval, func() { o.Flush() })
+	})
+
+	line, err := encodeSpoolRecord(record)
+	if err != nil {
+		return err
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	size := int64(len(line))
+	for o.MaxSize > 0 && o.size+size > o.MaxSize {
+		if !o.evictOldestSegment() {
+			break
+		}
+	}
+	if o.MaxSize > 0 && o.size+size > o.MaxSize {
+		o.dropped++
+		return fmt.Errorf("spool is full, dropped record")
+	}
+
+	if o.active == nil {
+		path := filepath.Join(o.Directory, fmt.Sprintf("%020d%s", o.sequence, spoolSegmentExtension))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		o.sequence++
+		o.active = file
+		o.current = spoolSegment{path: path}
+	}
+
+	if _, err := o.active.Write(line); err != nil {
+		return err
+	}
+	if o.SyncWrites {
+		if err := o.active.Sync(); err != nil {
+			return err
+		}
+	}
+	o.current.size += size
+	o.size += size
+
+	if o.current.size >= o.SegmentSize {
+		o.rotate()
+	}
+	return nil
+}
+
+// Flush replays all spooled segments to the wrapped output, stopping at the first segment that failed with a retryable
+// error. Rejected segments are set aside and the following segments are still sent.
+func (o *SpoolOutput) Flush() error {
+	o.sendMutex.Lock()
+	defer o.sendMutex.Unlock()
+
+	o.mutex.Lock()
+	if o.current.size > 0 {
+		o.rotate()
+	}
+	segments := append([]spoolSegment{}, o.segments...)
+	o.mutex.Unlock()
+
+	var first error
+	for _, segment := range segments {
+		o.mutex.Lock()
+		o.sending = segment.path
+		o.mutex.Unlock()
+
+		retryable, err := o.sendSegment(segment)
+
+		o.mutex.Lock()
+		o.sending = ""
+		switch {
+		case err == nil:
+			o.removeSegment(segment.path, "")
+		case !retryable:
+			o.removeSegment(segment.path, strings.TrimSuffix(segment.path, spoolSegmentExtension)+spoolRejectedExtension)
+		}
+		o.mutex.Unlock()
+
+		if err != nil && first == nil {
+			first = err
+		}
+		if retryable {
+			break
+		}
+	}
+	return first
+}
+
+// Close stops the background sending, tries to send all spooled records and closes the wrapped output.
+// Records that could not be sent remain in the spool directory.
+func (o *SpoolOutput) Close() error {
+	o.startOnce.Do(func() {})
+	if o.stop != nil {
+		o.stop()
+	}
+	err := o.Flush()
+
+	o.mutex.Lock()
+	o.rotate()
+	o.mutex.Unlock()
+
+	if closer, ok := o.Output.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Dropped returns the number of records that were lost because the spool exceeded its maximum size
+func (o *SpoolOutput) Dropped() int64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.dropped
+}
+
+// Size returns the number of bytes currently stored in the spool
+func (o *SpoolOutput) Size() int64 {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.size
+}
+
+// sendSegment replays the records of the segment to the wrapped output and reports if a failure is worth trying again
+func (o *SpoolOutput) sendSegment(segment spoolSegment) (retryable bool, err error) {
+	records, err := readSpoolSegment(segment.path)
+	if os.IsNotExist(err) {
+		// the segment was evicted while waiting to be sent
+		return false, nil
+	} else if err != nil {
+		return true, err
+	}
+
+	if sender, ok := o.Output.(spoolSender); ok {
+		handled, retryable, err := sender.sendSpooled(records)
+		if retryable && handled > 0 {
+			// the records that were already delivered are removed, so they are not sent again with the segment
+			o.truncateSegment(segment, records[handled:])
+		}
+		return retryable, err
+	}
+	for _, record := range records {
+		if err := o.Output.WriteRecord(record); err != nil {
+			return isRetryableError(err), err
+		}
+	}
+	if err := o.Output.Flush(); err != nil {
+		return isRetryableError(err), err
+	}
+	return false, nil
+}
+
+// truncateSegment replaces the contents of the segment with the remaining records
+func (o *SpoolOutput) truncateSegment(segment spoolSegment, remaining []*Record) {
+	content := []byte{}
+	for _, record := range remaining {
+		line, err := encodeSpoolRecord(record)
+		if err != nil {
+			continue
+		}
+		content = append(content, line...)
+	}
+
+	temporary := segment.path + ".tmp"
+	if err := ioutil.WriteFile(temporary, content, 0600); err != nil {
+		return
+	}
+	if err := os.Rename(temporary, segment.path); err != nil {
+		os.Remove(temporary)
+		return
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for i := range o.segments {
+		if o.segments[i].path == segment.path {
+			o.size += int64(len(content)) - o.segments[i].size
+			o.segments[i].size = int64(len(content))
+		}
+	}
+}
+
+// readSpoolSegment decodes all records of the segment, lines that can not be decoded were torn by a crash and are skipped
+func readSpoolSegment(path string) ([]*Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []*Record{}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			if record, decodeErr := decodeSpoolRecord(line); decodeErr == nil {
+				records = append(records, record)
+			}
+		}
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rotate closes the active segment and queues it for sending
+func (o *SpoolOutput) rotate() {
+	if o.active == nil {
+		return
+	}
+	o.active.Close()
+	o.active = nil
+	if o.current.size > 0 {
+		o.segments = append(o.segments, o.current)
+	} else {
+		os.Remove(o.current.path)
+	}
+}
+
+// evictOldestSegment removes the oldest segment that is not being sent, as the records of the segment being sent are
+// delivered anyway, and reports if a segment was evicted
+func (o *SpoolOutput) evictOldestSegment() bool {
+	index := 0
+	for index < len(o.segments) && o.segments[index].path == o.sending {
+		index++
+	}
+	if index >= len(o.segments) {
+		return false
+	}
+	segment := o.segments[index]
+	o.segments = append(o.segments[:index], o.segments[index+1:]...)
+	o.size -= segment.size
+
+	if file, err := os.Open(segment.path); err == nil {
+		lines, _ := countLines(file)
+		o.dropped += lines
+		file.Close()
+	}
+	os.Remove(segment.path)
+	return true
+}
+
+// removeSegment removes the segment from the spool, the file is renamed to rejectedPath if set and deleted otherwise
+func (o *SpoolOutput) removeSegment(path string, rejectedPath string) {
+	for i, segment := range o.segments {
+		if segment.path == path {
+			o.segments = append(o.segments[:i], o.segments[i+1:]...)
+			o.size -= segment.size
+			if rejectedPath != "" {
+				os.Rename(path, rejectedPath)
+			} else {
+				os.Remove(path)
+			}
+			return
+		}
+	}
+}
+
+func countLines(reader io.Reader) (int64, error) {
+	count := int64(0)
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(buffer)
+		count += int64(bytes.Count(buffer[:n], []byte("\n")))
+		if err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+	}
+}
+
+func encodeSpoolRecord(record *Record) ([]byte, error) {
+	spooled := spoolRecord{
+		Time:     record.Time,
+		Level:    record.Level,
+		Message:  record.Message,
+		Package:  record.Package,
+		Function: record.Function,
+	}
+	for _, field := range record.Fields {
+		spooled.Fields = append(spooled.Fields, spoolField{Key: field.Key, Value: fieldValue(field.Interface())})
+	}
+
+	line, err := json.Marshal(spooled)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+func decodeSpoolRecord(line []byte) (*Record, error) {
+	spooled := spoolRecord{}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&spooled); err != nil {
+		return nil, err
+	}
+
+	record := &Record{
+		Time:     spooled.Time,
+		Level:    spooled.Level,
+		Message:  spooled.Message,
+		Package:  spooled.Package,
+		Function: spooled.Function,
+	}
+	for _, field := range spooled.Fields {
+		value := field.Value
+		if number, ok := value.(json.Number); ok {
+			if integer, err := number.Int64(); err == nil {
+				value = integer
+			} else if float, err := number.Float64(); err == nil {
+				value = float
+			}
+		}
+		record.Fields = append(record.Fields, Field{Key: field.Key, Value: value})
+	}
+	return record, nil
+}
@@ -0,0 +1,283 @@
+package log_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+// recordingOutput collects flushed records and fails all flushes while unavailable is set
+type recordingOutput struct {
+	mutex       sync.Mutex
+	buffer      []*log.Record
+	records     []*log.Record
+	unavailable bool
+	flushes     int
+}
+
+func (o *recordingOutput) WriteRecord(record *log.Record) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.buffer = append(o.buffer, record)
+	return nil
+}
+
+func (o *recordingOutput) Flush() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.flushes++
+	buffer := o.buffer
+	o.buffer = nil
+	if o.unavailable {
+		return &log.HTTPError{StatusCode: http.StatusServiceUnavailable}
+	}
+	o.records = append(o.records, buffer...)
+	return nil
+}
+
+func (o *recordingOutput) messages() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	messages := []string{}
+	for _, record := range o.records {
+		messages = append(messages, record.Message)
+	}
+	return messages
+}
+
+func spoolSegments(t *testing.T, directory string) []string {
+	files, err := filepath.Glob(filepath.Join(directory, "*.spool"))
+	assert.NoError(t, err)
+	return files
+}
+
+func prepareTestSpoolOutput(t *testing.T, directory string, output log.RecordFlusher) *log.SpoolOutput {
+	spool, err := log.NewSpoolOutput(directory, output)
+	assert.NoError(t, err)
+	spool.FlushInterval = 0
+	return spool
+}
+
+func TestSpoolOutput(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(directory)
+
+	output := &recordingOutput{unavailable: true}
+	spool := prepareTestSpoolOutput(t, directory, output)
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(spool)
+	logger.WithFields(log.Field{Key: "attempt", Value: 3}).Info("first message")
+	logger.Error("second message")
+
+	assert.Error(t, spool.Flush())
+	assert.Empty(t, output.messages())
+	assert.Len(t, spoolSegments(t, directory), 1)
+
+	logger.Info("third message")
+	output.unavailable = false
+	assert.NoError(t, spool.Flush())
+
+	assert.Equal(t, []string{"first message", "second message", "third message"}, output.messages())
+	assert.Empty(t, spoolSegments(t, directory))
+	assert.Equal(t, int64(0), spool.Size())
+
+	first := output.records[0]
+	assert.Equal(t, log.InfoLevel, first.Level)
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test", first.Package)
+	assert.Equal(t, "TestSpoolOutput", first.Function)
+	assert.Equal(t, []log.Field{{Key: "attempt", Value: int64(3)}}, first.Fields)
+	assert.False(t, first.Time.IsZero())
+}
+
+func TestSpoolOutputResumeAfterRestart(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(directory)
+
+	collector := &otlpCollector{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	otlp := log.NewOTLPOutput(server.URL, "test-service")
+	otlp.FlushInterval = 0
+	otlp.MaxRetries = 0
+	spool := prepareTestSpoolOutput(t, directory, otlp)
+	spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	assert.Error(t, spool.Close())
+	assert.Len(t, spoolSegments(t, directory), 1)
+
+	otlp = log.NewOTLPOutput(server.URL, "test-service")
+	otlp.FlushInterval = 0
+	spool = prepareTestSpoolOutput(t, directory, otlp)
+	spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "third message"})
+	assert.NoError(t, spool.Close())
+
+	// every segment is flushed on its own, so the resumed segment and the new one are sent separately
+	assert.Equal(t, 3, collector.requestCount())
+	assert.Len(t, otlpLogRecords(collector.requests[1]), 2)
+	assert.Equal(t, map[string]interface{}{"stringValue": "first message"}, otlpLogRecords(collector.requests[1])[0].(map[string]interface{})["body"])
+	assert.Len(t, otlpLogRecords(collector.requests[2]), 1)
+	assert.Empty(t, spoolSegments(t, directory))
+}
+
+func TestSpoolOutputPartiallySentSegment(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(directory)
+
+	collector := &otlpCollector{statuses: []int{http.StatusOK, http.StatusServiceUnavailable}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	otlp := log.NewOTLPOutput(server.URL, "test-service")
+	otlp.BatchSize = 1
+	otlp.MaxRetries = 0
+	spool := prepareTestSpoolOutput(t, directory, otlp)
+	spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	assert.Error(t, spool.Flush())
+
+	// the delivered record is removed from the segment, so only the failed one is sent again
+	assert.NoError(t, spool.Close())
+	assert.Equal(t, 3, collector.requestCount())
+	for i, message := range []string{"first message", "second message", "second message"} {
+		assert.Equal(t, map[string]interface{}{"stringValue": message}, otlpLogRecords(collector.requests[i])[0].(map[string]interface{})["body"])
+	}
+	assert.Empty(t, spoolSegments(t, directory))
+}
+
+func TestSpoolOutputRejectedSegment(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(directory)
+
+	collector := &otlpCollector{statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	otlp := log.NewOTLPOutput(server.URL, "test-service")
+	spool := prepareTestSpoolOutput(t, directory, otlp)
+	spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "rejected message"})
+	assert.Error(t, spool.Flush())
+
+	// the rejected segment is set aside instead of blocking the following segments
+	spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "accepted message"})
+	assert.NoError(t, spool.Close())
+	assert.Equal(t, 2, collector.requestCount())
+	assert.Empty(t, spoolSegments(t, directory))
+
+	rejected, _ := filepath.Glob(filepath.Join(directory, "*.rejected"))
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, int64(0), spool.Size())
+}
+
+func TestSpoolOutputSegments(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(directory)
+
+	output := &recordingOutput{unavailable: true}
+	spool := prepareTestSpoolOutput(t, directory, output)
+	spool.SegmentSize = 1
+
+	for _, msg := range []string{"first message", "second message", "third message"} {
+		spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: msg})
+	}
+	assert.Len(t, spoolSegments(t, directory), 3)
+
+	// sending stops at the first segment that failed to preserve the order of the records
+	assert.Error(t, spool.Flush())
+	assert.Equal(t, 1, output.flushes)
+
+	output.unavailable = false
+	assert.NoError(t, spool.Flush())
+	assert.Equal(t, []string{"first message", "second message", "third message"}, output.messages())
+	assert.Equal(t, 4, output.flushes)
+}
+
+func TestSpoolOutputEviction(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(directory)
+
+	output := &recordingOutput{}
+	spool := prepareTestSpoolOutput(t, directory, output)
+	spool.SegmentSize = 1
+
+	assert.NoError(t, spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "message 1"}))
+	recordSize := spool.Size()
+	spool.MaxSize = 2 * recordSize
+
+	for _, msg := range []string{"message 2", "message 3", "message 4"} {
+		assert.NoError(t, spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: msg}))
+	}
+	assert.Equal(t, 2*recordSize, spool.Size())
+	assert.Equal(t, int64(2), spool.Dropped())
+
+	assert.NoError(t, spool.Flush())
+	assert.Equal(t, []string{"message 3", "message 4"}, output.messages())
+}
+
+// blockingOutput blocks the flush of the first segment until it is released
+type blockingOutput struct {
+	recordingOutput
+	sending chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (o *blockingOutput) Flush() error {
+	o.once.Do(func() {
+		close(o.sending)
+		<-o.release
+	})
+	return o.recordingOutput.Flush()
+}
+
+func TestSpoolOutputEvictionWhileSending(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(directory)
+
+	output := &blockingOutput{sending: make(chan struct{}), release: make(chan struct{})}
+	spool := prepareTestSpoolOutput(t, directory, output)
+	spool.SegmentSize = 1
+
+	assert.NoError(t, spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "message 1"}))
+	spool.MaxSize = 2 * spool.Size()
+
+	flushed := make(chan error)
+	go func() { flushed <- spool.Flush() }()
+	<-output.sending
+
+	// the segment being sent is delivered, so the next oldest segment is evicted instead
+	assert.NoError(t, spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "message 2"}))
+	assert.NoError(t, spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "message 3"}))
+	assert.Equal(t, int64(1), spool.Dropped())
+
+	close(output.release)
+	assert.NoError(t, <-flushed)
+	assert.NoError(t, spool.Flush())
+	assert.Equal(t, []string{"message 1", "message 3"}, output.messages())
+}
+
+func TestSpoolOutputFlushWithoutRecords(t *testing.T) {
+	directory, _ := ioutil.TempDir("", "spool")
+	defer os.RemoveAll(directory)
+
+	output := &recordingOutput{}
+	spool := prepareTestSpoolOutput(t, directory, output)
+	spool.SegmentSize = 1 << 20
+
+	assert.NoError(t, spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "message 1"}))
+	assert.NoError(t, spool.Flush())
+	assert.NoError(t, spool.Flush())
+	assert.NoError(t, spool.Flush())
+	assert.Empty(t, spoolSegments(t, directory), "flushes without records must not create segments")
+	assert.NoError(t, spool.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "message 2"}))
+	assert.Len(t, spoolSegments(t, directory), 1)
+	assert.Equal(t, []string{"message 1"}, output.messages())
+}
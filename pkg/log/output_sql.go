@@ -0,0 +1,301 @@
+package log
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// The SQLDialect selects the placeholder style, identifier quoting and column types used by a SQLOutput
+type SQLDialect int
+
+const (
+	// SQLiteDialect is used for SQLite databases
+	SQLiteDialect SQLDialect = iota
+	// PostgresDialect is used for PostgreSQL databases
+	PostgresDialect
+	// MySQLDialect is used for MySQL and MariaDB databases
+	MySQLDialect
+)
+
+// SQLColumns maps the parts of a record to the columns of the log table, parts with an empty column name are not stored
+type SQLColumns struct {
+	Time     string
+	Level    string
+	Package  string
+	Function string
+	Message  string
+	// Fields holds the fields of the record encoded as JSON object
+	Fields string
+}
+
+// SQLOutput inserts records into a table of a database/sql database. Records are buffered and inserted with
+// multi-row INSERT statements inside of a single transaction per batch. Batches that failed with a connection or transaction
+// error are retried, batches rejected by the database are dropped.
+type SQLOutput struct {
+	RetryConfig
+	DB            *sql.DB
+	Dialect       SQLDialect
+	Table         string
+	Columns       SQLColumns
+	CreateTable   bool
+	BatchSize     int
+	RowsPerInsert int
+	FlushInterval time.Duration
+	Clock         clock.Clock
+
+	created   bool
+	batcher   *BatchingOutput
+	startOnce sync.Once
+}
+
+// NewSQLOutput initializes a new SQLOutput inserting into the table of the database using the dialect
+func NewSQLOutput(db *sql.DB, dialect SQLDialect, table string) *SQLOutput {
+	return &SQLOutput{
+		RetryConfig: NewRetryConfig(),
+		DB:          db,
+		Dialect:     dialect,
+		Table:       table,
+		Columns: SQLColumns{
+			Time:     "time",
+			Level:    "level",
+			Package:  "package",
+			Function: "function",
+			Message:  "message",
+			Fields:   "fields",
+		},
+		BatchSize:     100,
+		RowsPerInsert: 50,
+		FlushInterval: 5 * time.Second,
+		Clock:         clock.New(),
+	}
+}
+
+// WriteRecord converts the record to a row and adds it to the current batch, which is inserted in the background once it
+// is full
+func (o *SQLOutput) WriteRecord(record *Record) error {
+	o.start()
+
+	encoded, err := o.encode(record)
+	if err != nil {
+		return err
+	}
+	return o.batcher.WriteRecord(encoded)
+}
+
+// Flush inserts all buffered rows in one transaction per batch, creating the table first if enabled. Batches that
+// failed are kept for the next attempt.
+func (o *SQLOutput) Flush() error {
+	o.start()
+	return o.batcher.Flush()
+}
+
+// Close inserts all remaining rows, the database itself is not closed
+func (o *SQLOutput) Close() error {
+	o.start()
+	return o.batcher.Close()
+}
+
+// sendSpooled sends the records replayed by a SpoolOutput on the calling goroutine, bypassing the background sending
+func (o *SQLOutput) sendSpooled(records []*Record) (handled int, retryable bool, err error) {
+	o.start()
+	return o.batcher.sendRecords(records, o.encode)
+}
+
+// encode returns a copy of the record holding its row
+func (o *SQLOutput) encode(record *Record) (*Record, error) {
+	row, err := o.newRow(record)
+	if err != nil {
+		return nil, err
+	}
+	return withEncoded(record, row), nil
+}
+
+func (o *SQLOutput) start() {
+	o.startOnce.Do(func() {
+		o.batcher = newOutputBatcher(SinkFunc(o.sendBatch), o.RetryConfig, o.BatchSize, o.FlushInterval, o.Clock)
+		o.batcher.Retryable = isRetryableSQLError
+	})
+}
+
+func (o *SQLOutput) sendBatch(ctx context.Context, batch []*Record) error {
+	rows := make([][]interface{}, 0, len(batch))
+	for _, record := range batch {
+		rows = append(rows, record.encoded.([]interface{}))
+	}
+	return o.insert(ctx, rows)
+}
+
+// CreateTableStatement returns the DDL statement creating the log table for the dialect, unknown dialects return an
+// error
+func (o *SQLOutput) CreateTableStatement() (string, error) {
+	// the types of the id, time, level, text and json columns
+	types := map[SQLDialect][]string{
+		SQLiteDialect:   {"INTEGER PRIMARY KEY AUTOINCREMENT", "TIMESTAMP", "VARCHAR(16)", "TEXT", "TEXT"},
+		PostgresDialect: {"BIGSERIAL PRIMARY KEY", "TIMESTAMPTZ", "VARCHAR(16)", "TEXT", "JSONB"},
+		MySQLDialect:    {"BIGINT AUTO_INCREMENT PRIMARY KEY", "DATETIME(6)", "VARCHAR(16)", "TEXT", "JSON"},
+	}[o.Dialect]
+	if types == nil {
+		return "", fmt.Errorf("unknown sql dialect %d", o.Dialect)
+	}
+
+	definitions := []string{o.quote("id") + " " + types[0]}
+	for _, column := range o.columns() {
+		columnType := types[3]
+		switch column {
+		case o.Columns.Time:
+			columnType = types[1] + " NOT NULL"
+		case o.Columns.Level:
+			columnType = types[2] + " NOT NULL"
+		case o.Columns.Fields:
+			columnType = types[4]
+		}
+		definitions = append(definitions, o.quote(column)+" "+columnType)
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", o.quote(o.Table), strings.Join(definitions, ", ")), nil
+}
+
+func (o *SQLOutput) insert(ctx context.Context, rows [][]interface{}) error {
+	if o.CreateTable && !o.created {
+		statement, err := o.CreateTableStatement()
+		if err != nil {
+			return err
+		}
+		if _, err := o.DB.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+		o.created = true
+	}
+
+	transaction, err := o.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	rowsPerInsert := o.RowsPerInsert
+	if rowsPerInsert <= 0 {
+		rowsPerInsert = len(rows)
+	}
+	for start := 0; start < len(rows); start += rowsPerInsert {
+		end := start + rowsPerInsert
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		query, args := o.insertStatement(rows[start:end])
+		if _, err := transaction.ExecContext(ctx, query, args...); err != nil {
+			transaction.Rollback()
+			return err
+		}
+	}
+	return transaction.Commit()
+}
+
+// insertStatement builds a single INSERT statement for all rows
+func (o *SQLOutput) insertStatement(rows [][]interface{}) (string, []interface{}) {
+	columns := o.columns()
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = o.quote(column)
+	}
+
+	query := &strings.Builder{}
+	fmt.Fprintf(query, "INSERT INTO %s (%s) VALUES ", o.quote(o.Table), strings.Join(quoted, ", "))
+
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j, value := range row {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			args = append(args, value)
+			query.WriteString(o.placeholder(len(args)))
+		}
+		query.WriteString(")")
+	}
+	return query.String(), args
+}
+
+// columns returns the names of the mapped columns in the order of the values of a row
+func (o *SQLOutput) columns() []string {
+	columns := []string{}
+	for _, column := range []string{o.Columns.Time, o.Columns.Level, o.Columns.Package, o.Columns.Function, o.Columns.Message, o.Columns.Fields} {
+		if column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+func (o *SQLOutput) newRow(record *Record) ([]interface{}, error) {
+	timestamp := record.Time
+	if timestamp.IsZero() {
+		timestamp = o.Clock.Now()
+	}
+
+	var fields interface{}
+	if len(record.Fields) > 0 {
+		values := map[string]interface{}{}
+		for _, field := range record.Fields {
+			values[field.Key] = fieldValue(field.Interface())
+		}
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		fields = string(encoded)
+	}
+
+	row := []interface{}{}
+	for _, column := range []struct {
+		name  string
+		value interface{}
+	}{
+		{o.Columns.Time, timestamp.UTC()},
+		{o.Columns.Level, record.Level.String()},
+		{o.Columns.Package, record.Package},
+		{o.Columns.Function, record.Function},
+		{o.Columns.Message, record.Message},
+		{o.Columns.Fields, fields},
+	} {
+		if column.name != "" {
+			row = append(row, column.value)
+		}
+	}
+	return row, nil
+}
+
+func (o *SQLOutput) placeholder(index int) string {
+	if o.Dialect == PostgresDialect {
+		return fmt.Sprintf("$%d", index)
+	}
+	return "?"
+}
+
+func (o *SQLOutput) quote(identifier string) string {
+	if o.Dialect == MySQLDialect {
+		return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+// isRetryableSQLError reports if inserting may succeed when tried again, which is only the case for connection and
+// transaction errors. Errors caused by the rows themselves like constraint violations are not retried.
+func isRetryableSQLError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, sql.ErrTxDone) || errors.As(err, &netErr)
+}
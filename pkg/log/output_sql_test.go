@@ -0,0 +1,228 @@
+package log_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+type sqlStatement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// fakeDB is an in-memory database/sql driver that records the statements of committed transactions and fails the
+// statement executed at position failOn with failure
+type fakeDB struct {
+	mutex     sync.Mutex
+	committed []sqlStatement
+	executed  []sqlStatement
+	pending   []sqlStatement
+	inTx      bool
+	rollbacks int
+	commits   int
+	failOn    int
+	failure   error
+}
+
+type fakeConn struct{ db *fakeDB }
+type fakeTx struct{ db *fakeDB }
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (db *fakeDB) Connect(ctx context.Context) (driver.Conn, error) { return &fakeConn{db: db}, nil }
+func (db *fakeDB) Driver() driver.Driver                            { return nil }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.mutex.Lock()
+	defer c.db.mutex.Unlock()
+	c.db.inTx = true
+	return &fakeTx{db: c.db}, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.db.mutex.Lock()
+	defer tx.db.mutex.Unlock()
+	tx.db.committed = append(tx.db.committed, tx.db.pending...)
+	tx.db.pending, tx.db.inTx = nil, false
+	tx.db.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.db.mutex.Lock()
+	defer tx.db.mutex.Unlock()
+	tx.db.pending, tx.db.inTx = nil, false
+	tx.db.rollbacks++
+	return nil
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("queries are not supported")
+}
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mutex.Lock()
+	defer s.db.mutex.Unlock()
+	statement := sqlStatement{Query: s.query, Args: args}
+	s.db.executed = append(s.db.executed, statement)
+	if len(s.db.executed) == s.db.failOn {
+		return nil, s.db.failure
+	}
+	if s.db.inTx {
+		s.db.pending = append(s.db.pending, statement)
+	} else {
+		s.db.committed = append(s.db.committed, statement)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (db *fakeDB) commitCount() int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.commits
+}
+
+func prepareTestSQLOutput(dialect log.SQLDialect) (*log.SQLOutput, *fakeDB) {
+	db := &fakeDB{}
+	output := log.NewSQLOutput(sql.OpenDB(db), dialect, "logs")
+	output.FlushInterval = 0
+	output.MaxRetries = 0
+	return output, db
+}
+
+func TestSQLOutput(t *testing.T) {
+	output, db := prepareTestSQLOutput(log.PostgresDialect)
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	logger.WithFields(log.Field{Key: "attempt", Value: 3}).Error("this is a test message")
+	logger.Info("another message")
+	assert.NoError(t, logger.Close())
+
+	assert.Equal(t, 1, db.commits)
+	assert.Len(t, db.committed, 1)
+	assert.Equal(t, `INSERT INTO "logs" ("time", "level", "package", "function", "message", "fields") VALUES `+
+		`($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12)`, db.committed[0].Query)
+
+	args := db.committed[0].Args
+	assert.Len(t, args, 12)
+	assert.IsType(t, time.Time{}, args[0])
+	assert.Equal(t, []driver.Value{"ERROR", "github.com/timbasel/go-log/pkg/log_test", "TestSQLOutput", "this is a test message", `{"attempt":3}`}, args[1:6])
+	assert.Equal(t, []driver.Value{"INFO", "github.com/timbasel/go-log/pkg/log_test", "TestSQLOutput", "another message", nil}, args[7:12])
+}
+
+func TestSQLOutputColumnMapping(t *testing.T) {
+	output, db := prepareTestSQLOutput(log.MySQLDialect)
+	output.Columns = log.SQLColumns{Time: "logged_at", Level: "severity", Message: "text"}
+
+	timestamp := time.Date(2023, 10, 18, 12, 0, 0, 0, time.UTC)
+	output.WriteRecord(&log.Record{Time: timestamp, Level: log.InfoLevel, Message: "this is a test message", Package: "main"})
+	assert.NoError(t, output.Flush())
+
+	assert.Equal(t, "INSERT INTO `logs` (`logged_at`, `severity`, `text`) VALUES (?, ?, ?)", db.committed[0].Query)
+	assert.Equal(t, []driver.Value{timestamp, "INFO", "this is a test message"}, db.committed[0].Args)
+}
+
+func TestSQLOutputBatches(t *testing.T) {
+	output, db := prepareTestSQLOutput(log.SQLiteDialect)
+	output.BatchSize = 5
+	output.RowsPerInsert = 2
+
+	for i := 0; i < 6; i++ {
+		output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "this is a test message"})
+	}
+	waitUntil(func() bool { return db.commitCount() == 1 })
+	assert.Equal(t, 1, db.commits)
+	assert.Len(t, db.committed, 3)
+	assert.Equal(t, 2, strings.Count(db.committed[0].Query, "(?, ?, ?, ?, ?, ?)"))
+	assert.Equal(t, 1, strings.Count(db.committed[2].Query, "(?, ?, ?, ?, ?, ?)"))
+
+	assert.NoError(t, output.Close())
+	assert.Equal(t, 2, db.commits)
+	assert.Len(t, db.committed, 4)
+}
+
+func TestSQLOutputRollback(t *testing.T) {
+	output, db := prepareTestSQLOutput(log.SQLiteDialect)
+	output.RowsPerInsert = 1
+	output.MaxRetries = 1
+	output.MinBackoff = time.Millisecond
+	db.failOn = 2
+	db.failure = driver.ErrBadConn
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	assert.NoError(t, output.Flush())
+
+	// the second insert of the first attempt failed, so the whole transaction was rolled back and sent again
+	assert.Len(t, db.executed, 4)
+	assert.Equal(t, 1, db.rollbacks)
+	assert.Equal(t, 1, db.commits)
+	assert.Len(t, db.committed, 2)
+	assert.Equal(t, "first message", db.committed[0].Args[4])
+	assert.Equal(t, "second message", db.committed[1].Args[4])
+}
+
+func TestSQLOutputRejectedBatch(t *testing.T) {
+	output, db := prepareTestSQLOutput(log.SQLiteDialect)
+	output.MaxRetries = 3
+	db.failOn = 1
+	db.failure = errors.New("UNIQUE constraint failed: logs.id")
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	assert.EqualError(t, output.Flush(), "UNIQUE constraint failed: logs.id")
+	assert.Len(t, db.executed, 1, "errors caused by the rows must not be retried")
+
+	// the rejected batch is dropped instead of blocking the following batches
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	assert.NoError(t, output.Flush())
+	assert.Len(t, db.committed, 1)
+	assert.Equal(t, "second message", db.committed[0].Args[4])
+}
+
+func TestSQLOutputCreateTable(t *testing.T) {
+	output, db := prepareTestSQLOutput(log.PostgresDialect)
+	output.CreateTable = true
+
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "first message"})
+	assert.NoError(t, output.Flush())
+	output.WriteRecord(&log.Record{Level: log.InfoLevel, Message: "second message"})
+	assert.NoError(t, output.Flush())
+
+	assert.Len(t, db.committed, 3)
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS "logs" ("id" BIGSERIAL PRIMARY KEY, "time" TIMESTAMPTZ NOT NULL, `+
+		`"level" VARCHAR(16) NOT NULL, "package" TEXT, "function" TEXT, "message" TEXT, "fields" JSONB)`, db.committed[0].Query)
+
+	sqlite, _ := prepareTestSQLOutput(log.SQLiteDialect)
+	sqlite.Columns.Fields = ""
+	statement, err := sqlite.CreateTableStatement()
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS "logs" ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "time" TIMESTAMP NOT NULL, `+
+		`"level" VARCHAR(16) NOT NULL, "package" TEXT, "function" TEXT, "message" TEXT)`, statement)
+
+	mysql, _ := prepareTestSQLOutput(log.MySQLDialect)
+	statement, err = mysql.CreateTableStatement()
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS `logs` (`id` BIGINT AUTO_INCREMENT PRIMARY KEY, `time` DATETIME(6) NOT NULL, "+
+		"`level` VARCHAR(16) NOT NULL, `package` TEXT, `function` TEXT, `message` TEXT, `fields` JSON)", statement)
+
+	unknown, _ := prepareTestSQLOutput(log.SQLDialect(42))
+	_, err = unknown.CreateTableStatement()
+	assert.EqualError(t, err, "unknown sql dialect 42")
+}
@@ -0,0 +1,311 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+const (
+	// WebhookTemplateJSON renders alerts as a generic JSON object
+	WebhookTemplateJSON = `{"level":{{json .Level.String}},"message":{{json .Message}},"time":{{json .Time}},"package":{{json .Package}},"function":{{json .Function}},"fields":{{json .Fields}},"count":{{.Count}},"digest":{{.Digest}}}`
+	// WebhookTemplateSlack renders alerts as Slack incoming webhook message
+	WebhookTemplateSlack = `{"text":{{json .Text}}}`
+	// WebhookTemplateMattermost renders alerts as Mattermost incoming webhook message
+	WebhookTemplateMattermost = `{"username":"go-log","text":{{json .Text}}}`
+)
+
+// A WebhookAlert is the data the payload template of a WebhookOutput is executed with
+type WebhookAlert struct {
+	Level    Level
+	Message  string
+	Time     time.Time
+	Package  string
+	Function string
+	Fields   map[string]interface{}
+	// Text is the record rendered by the formatter of the output, or the summary of a digest
+	Text string
+	// Count is the number of alerts summarised by a digest, or 1 for regular alerts
+	Count  int
+	Digest bool
+}
+
+// WebhookOutput posts a templated JSON payload for every record at or above Level. Identical messages are only sent
+// once per DedupWindow and at most RateLimit alerts are sent per RateInterval. Alerts suppressed by either limit are
+// summarised in a digest that is sent every DigestInterval and when the output is closed.
+// Alerts are rendered when they are written and posted by a background sender from a bounded queue, so logging never
+// waits for the webhook. Flush and Close wait until the queued alerts were sent.
+type WebhookOutput struct {
+	RetryConfig
+	URL            string
+	Template       string
+	Headers        map[string]string
+	Level          Level
+	Formatter      RecordFormatter
+	DedupWindow    time.Duration
+	RateLimit      int
+	RateInterval   time.Duration
+	DigestInterval time.Duration
+	Client         *http.Client
+	Clock          clock.Clock
+
+	mutex       sync.Mutex
+	renderMutex sync.Mutex
+	template    *template.Template
+	parsed      string
+	lastSent    map[string]time.Time
+	sent        []time.Time
+	suppressed  map[string]*suppressedAlert
+	batcher     *BatchingOutput
+	startOnce   sync.Once
+	stop        func()
+}
+
+type suppressedAlert struct {
+	level   Level
+	message string
+	count   int
+}
+
+// NewWebhookOutput initializes a new WebhookOutput posting Error records with the generic JSON template to the url
+func NewWebhookOutput(url string) *WebhookOutput {
+	formatter := NewDefaultFormatter()
+	formatter.ColorsDisabled = true
+	formatter.TimestampDisabled = true
+
+	return &WebhookOutput{
+		RetryConfig:    NewRetryConfig(),
+		URL:            url,
+		Template:       WebhookTemplateJSON,
+		Headers:        map[string]string{},
+		Level:          ErrorLevel,
+		Formatter:      formatter,
+		DedupWindow:    5 * time.Minute,
+		RateLimit:      10,
+		RateInterval:   time.Minute,
+		DigestInterval: 5 * time.Minute,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+		Clock:          clock.New(),
+	}
+}
+
+// NewSlackWebhookOutput initializes a new WebhookOutput posting to a Slack incoming webhook
+func NewSlackWebhookOutput(url string) *WebhookOutput {
+	o := NewWebhookOutput(url)
+	o.Template = WebhookTemplateSlack
+	return o
+}
+
+// NewMattermostWebhookOutput initializes a new WebhookOutput posting to a Mattermost incoming webhook
+func NewMattermostWebhookOutput(url string) *WebhookOutput {
+	o := NewWebhookOutput(url)
+	o.Template = WebhookTemplateMattermost
+	return o
+}
+
+// WriteRecord queues an alert for the record unless it is below the level, a duplicate or exceeds the rate limit
+func (o *WebhookOutput) WriteRecord(record *Record) error {
+	if record.Level < o.Level {
+		return nil
+	}
+	o.start()
+
+	if !o.allow(record) {
+		return nil
+	}
+
+	alert := WebhookAlert{
+		Level:    record.Level,
+		Message:  record.Message,
+		Time:     record.Time,
+		Package:  record.Package,
+		Function: record.Function,
+		Fields:   map[string]interface{}{},
+		Text:     strings.TrimRight(o.Formatter.FormatRecord(record), "\n"),
+		Count:    1,
+	}
+	for _, field := range record.Fields {
+		alert.Fields[field.Key] = fieldValue(field.Interface())
+	}
+	return o.enqueue(alert)
+}
+
+// Flush queues a digest of the alerts suppressed since the last digest and sends all queued alerts
+func (o *WebhookOutput) Flush() error {
+	o.start()
+	err := o.enqueueDigest()
+	if flushErr := o.batcher.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// Close stops the digest timer and sends the remaining digest and queued alerts
+func (o *WebhookOutput) Close() error {
+	o.start()
+	o.stop()
+	err := o.enqueueDigest()
+	if closeErr := o.batcher.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (o *WebhookOutput) start() {
+	o.startOnce.Do(func() {
+		o.batcher = newOutputBatcher(SinkFunc(o.sendBatch), o.RetryConfig, 1, 0, o.Clock)
+		o.stop = startFlushLoop(o.Clock, o.DigestInterval, func() { o.Flush() })
+	})
+}
+
+// enqueueDigest queues a digest of the alerts suppressed since the last digest, if there are any
+func (o *WebhookOutput) enqueueDigest() error {
+	o.mutex.Lock()
+	suppressed := o.suppressed
+	o.suppressed = nil
+	o.mutex.Unlock()
+
+	if len(suppressed) == 0 {
+		return nil
+	}
+
+	alerts := []*suppressedAlert{}
+	for _, alert := range suppressed {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].count != alerts[j].count {
+			return alerts[i].count > alerts[j].count
+		}
+		return alerts[i].message < alerts[j].message
+	})
+
+	digest := WebhookAlert{Time: o.Clock.Now(), Fields: map[string]interface{}{}, Digest: true}
+	lines := []string{}
+	for _, alert := range alerts {
+		if alert.level > digest.Level {
+			digest.Level = alert.level
+		}
+		digest.Count += alert.count
+		lines = append(lines, fmt.Sprintf("%dx [%s] %s", alert.count, alert.level, alert.message))
+	}
+	digest.Message = fmt.Sprintf("suppressed %d alerts", digest.Count)
+	digest.Text = digest.Message + ":\n" + strings.Join(lines, "\n")
+
+	return o.enqueue(digest)
+}
+
+// allow records the alert as sent if it passes deduplication and the rate limit, otherwise it is added to the digest
+func (o *WebhookOutput) allow(record *Record) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	now := o.Clock.Now()
+	key := record.Level.String() + "\x00" + record.Message
+	if o.lastSent == nil {
+		o.lastSent = map[string]time.Time{}
+	}
+	if o.suppressed == nil {
+		o.suppressed = map[string]*suppressedAlert{}
+	}
+
+	for k, sent := range o.lastSent {
+		if now.Sub(sent) >= o.DedupWindow {
+			delete(o.lastSent, k)
+		}
+	}
+	for len(o.sent) > 0 && now.Sub(o.sent[0]) >= o.RateInterval {
+		o.sent = o.sent[1:]
+	}
+
+	_, duplicate := o.lastSent[key]
+	limited := o.RateLimit > 0 && len(o.sent) >= o.RateLimit
+	if duplicate || limited {
+		alert, ok := o.suppressed[key]
+		if !ok {
+			alert = &suppressedAlert{level: record.Level, message: record.Message}
+			o.suppressed[key] = alert
+		}
+		alert.count++
+		return false
+	}
+
+	if o.DedupWindow > 0 {
+		o.lastSent[key] = now
+	}
+	if o.RateLimit > 0 {
+		o.sent = append(o.sent, now)
+	}
+	return true
+}
+
+// enqueue renders the alert, so template errors are returned to the caller, and hands it to the background sender
+func (o *WebhookOutput) enqueue(alert WebhookAlert) error {
+	payload, err := o.render(alert)
+	if err != nil {
+		return err
+	}
+	return o.batcher.WriteRecord(&Record{Level: alert.Level, Message: alert.Message, Time: alert.Time, encoded: payload})
+}
+
+func (o *WebhookOutput) sendBatch(ctx context.Context, batch []*Record) error {
+	for _, record := range batch {
+		if err := o.post(ctx, record.encoded.([]byte)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *WebhookOutput) post(ctx context.Context, payload []byte) error {
+	_, _, err := send(o.Client, o.Clock, func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		for key, value := range o.Headers {
+			request.Header.Set(key, value)
+		}
+		return request, nil
+	})
+	return err
+}
+
+// render executes the payload template, which is parsed again whenever the Template field changed
+func (o *WebhookOutput) render(alert WebhookAlert) ([]byte, error) {
+	o.renderMutex.Lock()
+	defer o.renderMutex.Unlock()
+
+	if o.template == nil || o.parsed != o.Template {
+		parsed, err := template.New("webhook").Funcs(template.FuncMap{"json": webhookJSON}).Parse(o.Template)
+		if err != nil {
+			return nil, err
+		}
+		o.template, o.parsed = parsed, o.Template
+	}
+
+	payload := &bytes.Buffer{}
+	if err := o.template.Execute(payload, alert); err != nil {
+		return nil, err
+	}
+	if !json.Valid(payload.Bytes()) {
+		return nil, fmt.Errorf("webhook template rendered invalid json: %s", payload.String())
+	}
+	return payload.Bytes(), nil
+}
+
+// webhookJSON encodes a value as JSON for use inside of payload templates
+func webhookJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
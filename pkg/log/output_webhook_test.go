@@ -0,0 +1,247 @@
+package log_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+// webhookReceiver collects the decoded payloads posted to it
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	payloads []map[string]interface{}
+	headers  []http.Header
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.payloads = append(r.payloads, payload)
+	r.headers = append(r.headers, req.Header)
+}
+
+func (r *webhookReceiver) received() []map[string]interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.payloads
+}
+
+func prepareTestWebhookOutput(output *log.WebhookOutput) (*log.WebhookOutput, *clock.Mock) {
+	mock := clock.NewMock()
+	output.Clock = mock
+	output.DigestInterval = 0
+	output.MaxRetries = 0
+	return output, mock
+}
+
+func TestWebhookOutput(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	output, _ := prepareTestWebhookOutput(log.NewWebhookOutput(server.URL))
+	output.Headers["Authorization"] = "Bearer token"
+
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	logger.Info("this message is below the level")
+	logger.WithFields(log.Field{Key: "attempt", Value: 3}).Error("this is a test message")
+	assert.NoError(t, logger.Close())
+
+	payloads := receiver.received()
+	assert.Len(t, payloads, 1)
+	assert.Equal(t, "ERROR", payloads[0]["level"])
+	assert.Equal(t, "this is a test message", payloads[0]["message"])
+	assert.Equal(t, "github.com/timbasel/go-log/pkg/log_test", payloads[0]["package"])
+	assert.Equal(t, "TestWebhookOutput", payloads[0]["function"])
+	assert.Equal(t, map[string]interface{}{"attempt": float64(3)}, payloads[0]["fields"])
+	assert.Equal(t, float64(1), payloads[0]["count"])
+	assert.Equal(t, false, payloads[0]["digest"])
+	assert.Equal(t, "Bearer token", receiver.headers[0].Get("Authorization"))
+	assert.Equal(t, "application/json", receiver.headers[0].Get("Content-Type"))
+}
+
+func TestWebhookOutputPresets(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	record := &log.Record{Level: log.ErrorLevel, Message: "this is a \"test\" message", Package: "github.com/timbasel/go-log/pkg/log_test", Function: "TestWebhookOutputPresets"}
+
+	slack, _ := prepareTestWebhookOutput(log.NewSlackWebhookOutput(server.URL))
+	assert.NoError(t, slack.WriteRecord(record))
+	assert.NoError(t, slack.Flush())
+	mattermost, _ := prepareTestWebhookOutput(log.NewMattermostWebhookOutput(server.URL))
+	assert.NoError(t, mattermost.WriteRecord(record))
+	assert.NoError(t, mattermost.Flush())
+
+	payloads := receiver.received()
+	assert.Equal(t, map[string]interface{}{
+		"text": "ERROR <log_test.TestWebhookOutputPresets>: this is a \"test\" message",
+	}, payloads[0])
+	assert.Equal(t, map[string]interface{}{
+		"username": "go-log",
+		"text":     "ERROR <log_test.TestWebhookOutputPresets>: this is a \"test\" message",
+	}, payloads[1])
+}
+
+func TestWebhookOutputCustomTemplate(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	output, _ := prepareTestWebhookOutput(log.NewWebhookOutput(server.URL))
+	output.Template = `{"summary":{{json .Message}},"severity":{{json .Level.String}},"attempt":{{json (index .Fields "attempt")}}}`
+	record := &log.Record{Level: log.ErrorLevel, Message: "this is a test message", Fields: []log.Field{{Key: "attempt", Value: 3}}}
+	assert.NoError(t, output.WriteRecord(record))
+	assert.NoError(t, output.Flush())
+
+	assert.Equal(t, []map[string]interface{}{{"summary": "this is a test message", "severity": "ERROR", "attempt": float64(3)}}, receiver.received())
+
+	output.Template = `{"summary":{{.Message}}}`
+	assert.Error(t, output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "another message"}))
+}
+
+func TestWebhookOutputDeduplication(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	output, mock := prepareTestWebhookOutput(log.NewWebhookOutput(server.URL))
+	output.DedupWindow = time.Minute
+
+	for i := 0; i < 3; i++ {
+		output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "database unavailable"})
+	}
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "another message"})
+	waitUntil(func() bool { return len(receiver.received()) >= 2 })
+	assert.Len(t, receiver.received(), 2)
+
+	mock.Add(time.Minute)
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "database unavailable"})
+	waitUntil(func() bool { return len(receiver.received()) >= 3 })
+	assert.Len(t, receiver.received(), 3)
+
+	assert.NoError(t, output.Close())
+	payloads := receiver.received()
+	assert.Len(t, payloads, 4)
+	assert.Equal(t, "suppressed 2 alerts", payloads[3]["message"])
+	assert.Equal(t, float64(2), payloads[3]["count"])
+	assert.Equal(t, true, payloads[3]["digest"])
+}
+
+func TestWebhookOutputRateLimit(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	output, mock := prepareTestWebhookOutput(log.NewSlackWebhookOutput(server.URL))
+	output.RateLimit = 2
+	output.RateInterval = time.Minute
+
+	for _, msg := range []string{"first message", "second message", "third message", "fourth message", "third message"} {
+		output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: msg, Package: "main", Function: "main"})
+	}
+	waitUntil(func() bool { return len(receiver.received()) >= 2 })
+	assert.Len(t, receiver.received(), 2)
+
+	mock.Add(time.Minute)
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "fifth message", Package: "main", Function: "main"})
+	waitUntil(func() bool { return len(receiver.received()) >= 3 })
+	assert.Len(t, receiver.received(), 3)
+
+	assert.NoError(t, output.Flush())
+	payloads := receiver.received()
+	assert.Len(t, payloads, 4)
+	assert.Equal(t, "suppressed 3 alerts:\n2x [ERROR] third message\n1x [ERROR] fourth message", payloads[3]["text"])
+
+	// nothing was suppressed since the last digest
+	assert.NoError(t, output.Flush())
+	assert.Len(t, receiver.received(), 4)
+}
+
+func TestWebhookOutputDigestInterval(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	output, mock := prepareTestWebhookOutput(log.NewWebhookOutput(server.URL))
+	output.DigestInterval = time.Minute
+	defer output.Close()
+
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "database unavailable"})
+	output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "database unavailable"})
+	waitUntil(func() bool { return len(receiver.received()) >= 1 })
+	assert.Len(t, receiver.received(), 1)
+
+	mock.Add(time.Minute)
+	waitUntil(func() bool { return len(receiver.received()) >= 2 })
+	payloads := receiver.received()
+	assert.Len(t, payloads, 2)
+	assert.Equal(t, true, payloads[1]["digest"])
+}
+
+func TestWebhookOutputLiteral(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	// outputs that are not initialized by NewWebhookOutput must not panic on their first write
+	output := &log.WebhookOutput{
+		URL:         server.URL,
+		Template:    log.WebhookTemplateJSON,
+		Level:       log.ErrorLevel,
+		Formatter:   log.NewRawFormatter(),
+		DedupWindow: time.Minute,
+		Client:      server.Client(),
+		Clock:       clock.NewMock(),
+	}
+	assert.NoError(t, output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "database unavailable"}))
+	assert.NoError(t, output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "database unavailable"}))
+	assert.NoError(t, output.Close())
+
+	payloads := receiver.received()
+	assert.Len(t, payloads, 2)
+	assert.Equal(t, "suppressed 1 alerts", payloads[1]["message"])
+}
+
+func TestWebhookOutputSendsInBackground(t *testing.T) {
+	receiver := &webhookReceiver{}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		receiver.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	output, _ := prepareTestWebhookOutput(log.NewWebhookOutput(server.URL))
+	output.DedupWindow = 0
+
+	// writing must not wait for the webhook to respond
+	assert.NoError(t, output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "first error"}))
+	assert.NoError(t, output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "second error"}))
+	assert.Len(t, receiver.received(), 0)
+
+	close(release)
+	assert.NoError(t, output.Close())
+	payloads := receiver.received()
+	assert.Len(t, payloads, 2)
+	assert.Equal(t, "first error", payloads[0]["message"])
+	assert.Equal(t, "second error", payloads[1]["message"])
+	assert.Equal(t, log.ErrOutputClosed, output.WriteRecord(&log.Record{Level: log.ErrorLevel, Message: "third error"}))
+}
@@ -0,0 +1,50 @@
+package log
+
+import "time"
+
+// A Record is a single log message together with the information collected when it was written
+type Record struct {
+	Time     time.Time
+	Level    Level
+	Message  string
+	Package  string
+	Function string
+	Fields   []Field
+	Caller   *Caller
+
+	callerSkip int
+	// encoded is the representation of the record prepared by a batching output when the record was written
+	encoded interface{}
+}
+
+const (
+	// TraceIDField is the key of the field holding the trace id a record belongs to
+	TraceIDField = "trace_id"
+	// SpanIDField is the key of the field holding the span id a record belongs to
+	SpanIDField = "span_id"
+)
+
+// A Field is a key value pair attached to a log message. Fields created by the typed constructors like String or Int
+// hold their value without boxing it, Interface returns the value of all fields.
+type Field struct {
+	Key   string
+	Value interface{}
+
+	kind      fieldKind
+	integer   int64
+	text      string
+	reference interface{}
+}
+
+// resolveCaller looks up the caller that wrote the record if it is not already known
+func (record *Record) resolveCaller() {
+	if record.Caller == nil && record.Package == "" && record.Function == "" {
+		record.setCaller(findCaller(record.callerSkip))
+	}
+}
+
+// setCaller sets the caller and the package and function derived from it
+func (record *Record) setCaller(caller *Caller) {
+	record.Caller = caller
+	record.Package, record.Function = caller.Package, caller.QualifiedFunction()
+}
@@ -0,0 +1,270 @@
+package log
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The LogValuer interface is implemented by types that control their own logged form, the returned value is logged
+// instead of the value itself
+type LogValuer interface {
+	LogValue() interface{}
+}
+
+// RedactedValue is the form in which Redacted values are logged
+const RedactedValue = "[REDACTED]"
+
+// Redacted wraps a value that must never appear in the log, while still allowing a Redactor in hashing mode to
+// correlate equal values
+type Redacted struct {
+	Value interface{}
+}
+
+// LogValue returns the redacted form of the value
+func (r Redacted) LogValue() interface{} {
+	return RedactedValue
+}
+
+// String returns the redacted form of the value
+func (r Redacted) String() string {
+	return RedactedValue
+}
+
+// GoString returns the redacted form of the value
+func (r Redacted) GoString() string {
+	return RedactedValue
+}
+
+// MarshalJSON returns the redacted form of the value
+func (r Redacted) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + RedactedValue + `"`), nil
+}
+
+// A RedactionRule replaces all matches of its pattern, or only the first submatch if the pattern has one. Matches
+// are only replaced if Validate is not set or reports the match as valid.
+type RedactionRule struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool
+}
+
+var (
+	// BearerTokenRule redacts tokens of bearer authorization headers
+	BearerTokenRule = RedactionRule{Name: "bearer_token", Pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`)}
+	// AWSAccessKeyRule redacts AWS access key ids
+	AWSAccessKeyRule = RedactionRule{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b((?:AKIA|ASIA|AROA|AIDA)[0-9A-Z]{16})\b`)}
+	// AWSSecretKeyRule redacts AWS secret access keys assigned to a key containing "secret"
+	AWSSecretKeyRule = RedactionRule{Name: "aws_secret_key", Pattern: regexp.MustCompile(`(?i)secret[a-z_]*["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)}
+	// CreditCardRule redacts credit card numbers that pass the Luhn check
+	CreditCardRule = RedactionRule{Name: "credit_card", Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), Validate: isLuhnValid}
+	// EmailRule redacts email addresses
+	EmailRule = RedactionRule{Name: "email", Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)}
+)
+
+// DefaultRedactedKeys are the field keys whose values are redacted by default, the comparison ignores case, "-", "_" and "."
+var DefaultRedactedKeys = []string{
+	"password", "passwd", "pwd", "secret", "client_secret", "token", "access_token", "refresh_token",
+	"api_key", "authorization", "cookie", "set_cookie", "private_key",
+}
+
+// A Redactor removes sensitive data from records before they are formatted. Rules are applied to the message and to
+// all string field values, the values of fields with one of the redacted keys are replaced entirely. The nested values
+// of rendered structs, maps and slices are redacted the same way, while fields holding an ObjectMarshaler or
+// ArrayMarshaler are only replaced by their key.
+// In hashing mode the replacement contains a keyed hash of the redacted value, so equal values can be correlated.
+// Without a HashKey a random key is generated once per process, as hashes with a known key allow to recover values
+// with few possible values like PINs by brute force. Set a secret HashKey to correlate values across processes.
+type Redactor struct {
+	Rules       []RedactionRule
+	Keys        []string
+	Replacement string
+	Hash        bool
+	HashKey     []byte
+}
+
+// NewRedactor initializes a new Redactor with the built-in rules and the default redacted keys
+func NewRedactor() *Redactor {
+	return &Redactor{
+		Rules:       []RedactionRule{BearerTokenRule, AWSAccessKeyRule, AWSSecretKeyRule, CreditCardRule, EmailRule},
+		Keys:        append([]string{}, DefaultRedactedKeys...),
+		Replacement: RedactedValue,
+	}
+}
+
+// RedactRecord returns a copy of the record with the message and fields redacted
+func (r *Redactor) RedactRecord(record *Record) *Record {
+	redacted := *record
+	redacted.Message = r.RedactString(record.Message)
+	if len(record.Fields) > 0 {
+		redacted.Fields = make([]Field, len(record.Fields))
+		for i, field := range record.Fields {
+			redacted.Fields[i] = r.redactField(field)
+		}
+	}
+	return &redacted
+}
+
+// RedactString applies all rules to the string
+func (r *Redactor) RedactString(value string) string {
+	for _, rule := range r.Rules {
+		builder := strings.Builder{}
+		last, replaced := 0, false
+		for _, match := range rule.Pattern.FindAllStringSubmatchIndex(value, -1) {
+			start, end := match[0], match[1]
+			if len(match) >= 4 && match[2] >= 0 {
+				start, end = match[2], match[3]
+			}
+			if rule.Validate != nil && !rule.Validate(value[start:end]) {
+				continue
+			}
+			builder.WriteString(value[last:start])
+			builder.WriteString(r.replacement(value[start:end]))
+			last, replaced = end, true
+		}
+		if replaced {
+			builder.WriteString(value[last:])
+			value = builder.String()
+		}
+	}
+	return value
+}
+
+// redactField redacts the value of the field, typed fields keep their type unless they are replaced entirely
+func (r *Redactor) redactField(field Field) Field {
+	if field.kind == lazyKind {
+		// lazy fields are redacted once they are computed
+		value := field.reference.(*lazyValue)
+		return Field{Key: field.Key, kind: lazyKind, reference: &lazyValue{compute: func() Field { return r.redactField(value.get()) }}}
+	}
+
+	field = renderField(field)
+	switch {
+	case field.kind == anyKind:
+		return Field{Key: field.Key, Value: r.redactValue(field.Key, field.Value)}
+	case r.isRedactedKey(field.Key):
+		return String(field.Key, r.replacement(fmt.Sprint(field.Interface())))
+	case field.kind == stringKind:
+		return String(field.Key, r.RedactString(field.text))
+	case field.kind == objectKind || field.kind == arrayKind:
+		// the nested values of rendered structs, maps and slices are redacted while they are rendered
+		if rendered, ok := field.reference.(*renderedValue); ok {
+			field.reference = rendered.withRedactor(r)
+		}
+		return field
+	default:
+		return field
+	}
+}
+
+func (r *Redactor) redactValue(key string, value interface{}) interface{} {
+	if redacted, ok := value.(Redacted); ok {
+		return r.replacement(fmt.Sprint(resolveLogValue(redacted.Value)))
+	}
+	value = resolveLogValue(value)
+
+	if r.isRedactedKey(key) {
+		return r.replacement(fmt.Sprint(fieldValue(value)))
+	}
+	if err, ok := value.(error); ok {
+		return NewErrorDetails(err).mapMessages(r.RedactString)
+	}
+	switch v := fieldValue(value).(type) {
+	case string:
+		return r.RedactString(v)
+	default:
+		return value
+	}
+}
+
+func (r *Redactor) isRedactedKey(key string) bool {
+	normalized := normalizeRedactedKey(key)
+	for _, redacted := range r.Keys {
+		if normalizeRedactedKey(redacted) == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// replacement returns the text that replaces the value, which contains a hash of the value in hashing mode
+func (r *Redactor) replacement(value string) string {
+	if !r.Hash {
+		return r.Replacement
+	}
+	key := r.HashKey
+	if len(key) == 0 {
+		key = processHashKey()
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return r.Replacement + ":" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+var (
+	hashKeyOnce sync.Once
+	hashKey     []byte
+)
+
+// processHashKey returns the random key used by redactors in hashing mode without a HashKey
+func processHashKey() []byte {
+	hashKeyOnce.Do(func() {
+		hashKey = make([]byte, 32)
+		if _, err := rand.Read(hashKey); err != nil {
+			panic(fmt.Sprintf("failed to generate redaction hash key: %v", err))
+		}
+	})
+	return hashKey
+}
+
+func normalizeRedactedKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "", ".", "").Replace(key))
+}
+
+// resolveLogValue replaces values implementing LogValuer with their logged form
+func resolveLogValue(value interface{}) interface{} {
+	for i := 0; i < 8; i++ {
+		valuer, ok := value.(LogValuer)
+		if !ok {
+			break
+		}
+		value = valuer.LogValue()
+	}
+	return value
+}
+
+// formatMessage formats the message like fmt.Sprintf, but logs arguments implementing LogValuer in their logged form
+func formatMessage(format string, arguments []interface{}) string {
+	resolved := make([]interface{}, len(arguments))
+	for i, argument := range arguments {
+		resolved[i] = resolveLogValue(argument)
+	}
+	return fmt.Sprintf(format, resolved...)
+}
+
+// isLuhnValid reports if the digits of the number pass the Luhn checksum used by credit card numbers
+func isLuhnValid(number string) bool {
+	sum, digits, double := 0, 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		digits++
+		double = !double
+	}
+	return digits >= 13 && sum%10 == 0
+}
@@ -0,0 +1,480 @@
+package log
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxDepthValue replaces values nested deeper than the maximum depth of the renderer
+	MaxDepthValue = "[max depth]"
+	// CycleValue replaces values that reference one of the values containing them
+	CycleValue = "[cycle]"
+	// TruncatedKey is the key of the entry that counts the map entries removed by the maximum length of the renderer
+	TruncatedKey = "..."
+)
+
+// A Renderer converts structs, maps, slices and arrays into nested objects and arrays, which are written as nested json
+// by the JSONFormatter and flattened into dotted keys by the text formatters. Values implementing fmt.Stringer,
+// encoding.TextMarshaler or json.Marshaler are logged in their own form.
+//
+// Struct fields are controlled by the "log" tag: `log:"-"` skips the field, `log:"name"` renames it, `log:",redact"`
+// replaces its value with RedactedValue and `log:",omitempty"` skips it if it is empty. Unexported fields are skipped
+// and the fields of embedded structs are inlined.
+type Renderer struct {
+	// MaxDepth limits the number of nested objects and arrays, deeper values are replaced with MaxDepthValue
+	MaxDepth int
+	// MaxLength limits the number of elements of slices, arrays and maps, the removed elements are counted in an
+	// additional "... N more" element or in the TruncatedKey entry of maps
+	MaxLength int
+}
+
+// NewRenderer initializes a new Renderer with the default limits
+func NewRenderer() *Renderer {
+	return &Renderer{
+		MaxDepth:  8,
+		MaxLength: 100,
+	}
+}
+
+// defaultRenderer renders the fields of records that were not rendered by a logger
+var defaultRenderer = NewRenderer()
+
+// renderFields returns the fields with all structs, maps, slices and arrays rendered, the slice is only copied if one
+// of the fields has to be rendered
+func (r *Renderer) renderFields(fields []Field) []Field {
+	for i, field := range fields {
+		rendered, ok := r.renderField(field)
+		if !ok {
+			continue
+		}
+		copied := make([]Field, len(fields))
+		copy(copied, fields)
+		copied[i] = rendered
+		for j := i + 1; j < len(fields); j++ {
+			if rendered, ok := r.renderField(fields[j]); ok {
+				copied[j] = rendered
+			}
+		}
+		return copied
+	}
+	return fields
+}
+
+// renderField converts fields holding a struct, map, slice or array into object and array fields, other fields are
+// not modified and reported as not rendered
+func (r *Renderer) renderField(field Field) (Field, bool) {
+	if field.kind != anyKind || !isRenderedValue(field.Value) {
+		return field, false
+	}
+	rendered := (&renderedValue{renderer: r}).field(field.Key, reflect.ValueOf(field.Value), 0)
+	if rendered.kind != objectKind && rendered.kind != arrayKind {
+		return field, false
+	}
+	return rendered, true
+}
+
+// isRenderedValue reports if the value might have to be rendered, which excludes all values that are logged in their
+// own form
+func isRenderedValue(value interface{}) bool {
+	switch value.(type) {
+	case nil, string, bool, int, int64, int32, uint, uint64, uint32, float64, []byte,
+		error, fmt.Stringer, encoding.TextMarshaler, json.Marshaler:
+		return false
+	}
+	return true
+}
+
+// renderField renders the field with the default renderer
+func renderField(field Field) Field {
+	field, _ = defaultRenderer.renderField(field)
+	return field
+}
+
+// renderState holds the state of a single rendering of a value, which is shared by all nested values
+type renderState struct {
+	// seen holds the pointers, maps and slices containing the value that is currently rendered
+	seen map[uintptr]struct{}
+}
+
+// A renderedValue is a struct, map, slice or array that is rendered as object or array by reflection
+type renderedValue struct {
+	value    reflect.Value
+	renderer *Renderer
+	redactor *Redactor
+	depth    int
+	pointer  uintptr
+	state    *renderState
+}
+
+// MarshalLogObject adds the fields of structs or the entries of maps to the encoder
+func (v *renderedValue) MarshalLogObject(encoder ObjectEncoder) error {
+	child, done := v.enter()
+	defer done()
+
+	if v.value.Kind() == reflect.Map {
+		return v.marshalMap(encoder, child)
+	}
+	for _, field := range cachedStructFields(v.value.Type()) {
+		value, err := v.value.FieldByIndexErr(field.index)
+		if err != nil {
+			// the field belongs to an embedded struct pointer that is nil
+			continue
+		}
+		if field.omitEmpty && isEmptyValue(value) {
+			continue
+		}
+		var rendered Field
+		if field.redact || (v.redactor != nil && v.redactor.isRedactedKey(field.name)) {
+			rendered = String(field.name, child.replacement(value))
+		} else {
+			rendered = child.field(field.name, value, v.depth)
+		}
+		if err := addField(encoder, rendered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalLogArray appends the elements of slices and arrays to the encoder
+func (v *renderedValue) MarshalLogArray(encoder ArrayEncoder) error {
+	child, done := v.enter()
+	defer done()
+
+	length := v.value.Len()
+	for i := 0; i < length && i < v.renderer.MaxLength; i++ {
+		if err := appendField(encoder, child.field("", v.value.Index(i), v.depth)); err != nil {
+			return err
+		}
+	}
+	if length > v.renderer.MaxLength {
+		encoder.AppendString("... " + strconv.Itoa(length-v.renderer.MaxLength) + " more")
+	}
+	return nil
+}
+
+// enter marks the value as being rendered and returns the template of its nested values together with the function
+// that removes the mark again
+func (v *renderedValue) enter() (*renderedValue, func()) {
+	state := v.state
+	if state == nil {
+		// every rendering of a field starts with its own state, as fields may be formatted concurrently
+		state = &renderState{seen: map[uintptr]struct{}{}}
+	}
+	if v.pointer == 0 {
+		return &renderedValue{renderer: v.renderer, redactor: v.redactor, state: state}, func() {}
+	}
+	state.seen[v.pointer] = struct{}{}
+	return &renderedValue{renderer: v.renderer, redactor: v.redactor, state: state}, func() { delete(state.seen, v.pointer) }
+}
+
+func (v *renderedValue) marshalMap(encoder ObjectEncoder, child *renderedValue) error {
+	type mapEntry struct {
+		key   string
+		value reflect.Value
+	}
+	entries := make([]mapEntry, 0, v.value.Len())
+	iterator := v.value.MapRange()
+	for iterator.Next() {
+		entries = append(entries, mapEntry{key: mapKey(iterator.Key()), value: iterator.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	for i, entry := range entries {
+		if i == v.renderer.MaxLength {
+			encoder.AddString(TruncatedKey, strconv.Itoa(len(entries)-i)+" more")
+			break
+		}
+		var rendered Field
+		if v.redactor != nil && v.redactor.isRedactedKey(entry.key) {
+			rendered = String(entry.key, child.replacement(entry.value))
+		} else {
+			rendered = child.field(entry.key, entry.value, v.depth)
+		}
+		if err := addField(encoder, rendered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field converts the nested value into a field, where structs, maps, slices and arrays become object and array fields
+// of the next depth
+func (v *renderedValue) field(key string, value reflect.Value, depth int) Field {
+	field := v.convert(key, value, depth)
+	if v.redactor != nil && field.kind == stringKind {
+		field.text = v.redactor.RedactString(field.text)
+	}
+	return field
+}
+
+func (v *renderedValue) convert(key string, value reflect.Value, depth int) Field {
+	var pointer uintptr
+	for value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return Any(key, nil)
+		}
+		if value.Kind() == reflect.Pointer {
+			if field, ok := v.convertInterface(key, value, depth); ok {
+				return field
+			}
+			if pointer == 0 {
+				pointer = value.Pointer()
+			}
+		}
+		value = value.Elem()
+	}
+	if field, ok := v.convertInterface(key, value, depth); ok {
+		return field
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return String(key, value.String())
+	case reflect.Bool:
+		return Bool(key, value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int64(key, value.Int())
+	case reflect.Float64:
+		return Float64(key, value.Float())
+	case reflect.Map, reflect.Slice:
+		if value.IsNil() {
+			return Any(key, nil)
+		}
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			return Any(key, value.Bytes())
+		}
+		pointer = value.Pointer()
+	case reflect.Struct, reflect.Array:
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return String(key, value.Type().String())
+	default:
+		if value.CanInterface() {
+			return Any(key, value.Interface())
+		}
+		return String(key, fmt.Sprint(value))
+	}
+
+	if v.state != nil && pointer != 0 {
+		if _, ok := v.state.seen[pointer]; ok {
+			return String(key, CycleValue)
+		}
+	}
+	if depth >= v.renderer.MaxDepth {
+		return String(key, MaxDepthValue)
+	}
+	nested := &renderedValue{value: value, renderer: v.renderer, redactor: v.redactor, depth: depth + 1, pointer: pointer, state: v.state}
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		return Array(key, nested)
+	}
+	return Object(key, nested)
+}
+
+// convertInterface converts values that implement one of the interfaces controlling their logged form
+func (v *renderedValue) convertInterface(key string, value reflect.Value, depth int) (Field, bool) {
+	if !value.CanInterface() {
+		return Field{}, false
+	}
+	switch i := value.Interface().(type) {
+	case time.Time:
+		return Time(key, i), true
+	case time.Duration:
+		return Duration(key, i), true
+	case ObjectMarshaler:
+		return Object(key, i), true
+	case ArrayMarshaler:
+		return Array(key, i), true
+	case LogValuer:
+		return v.convert(key, reflect.ValueOf(resolveLogValue(i)), depth), true
+	case error:
+		return String(key, i.Error()), true
+	case json.Marshaler:
+		return Any(key, i), true
+	case encoding.TextMarshaler:
+		text, err := i.MarshalText()
+		if err != nil {
+			return String(key, err.Error()), true
+		}
+		return String(key, string(text)), true
+	case fmt.Stringer:
+		return String(key, i.String()), true
+	}
+	return Field{}, false
+}
+
+// replacement returns the text that replaces a redacted value
+func (v *renderedValue) replacement(value reflect.Value) string {
+	if v.redactor == nil {
+		return RedactedValue
+	}
+	if value.CanInterface() {
+		return v.redactor.replacement(fmt.Sprint(value.Interface()))
+	}
+	return v.redactor.replacement(fmt.Sprint(value))
+}
+
+// withRedactor returns a copy of the value that redacts its nested values
+func (v *renderedValue) withRedactor(redactor *Redactor) *renderedValue {
+	copied := *v
+	copied.redactor = redactor
+	return &copied
+}
+
+// mapKey converts the key of a map entry into a string
+func mapKey(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return key.String()
+	}
+	if marshaler, ok := key.Interface().(encoding.TextMarshaler); ok {
+		if text, err := marshaler.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(key.Interface())
+}
+
+// A structField is an exported field of a struct, including the fields of embedded structs
+type structField struct {
+	index     []int
+	name      string
+	redact    bool
+	omitEmpty bool
+}
+
+var structFieldCache sync.Map
+
+// cachedStructFields returns the rendered fields of the struct type, which are only looked up once per type
+func cachedStructFields(structType reflect.Type) []structField {
+	if fields, ok := structFieldCache.Load(structType); ok {
+		return fields.([]structField)
+	}
+	fields := structFields(structType, nil, map[reflect.Type]bool{})
+
+	// fields of embedded structs are shadowed by fields with the same name at a lower depth
+	depths := map[string]int{}
+	for _, field := range fields {
+		if depth, ok := depths[field.name]; !ok || len(field.index) < depth {
+			depths[field.name] = len(field.index)
+		}
+	}
+	visible := make([]structField, 0, len(fields))
+	for _, field := range fields {
+		if depths[field.name] == len(field.index) {
+			visible = append(visible, field)
+			depths[field.name] = -1
+		}
+	}
+
+	cached, _ := structFieldCache.LoadOrStore(structType, visible)
+	return cached.([]structField)
+}
+
+func structFields(structType reflect.Type, index []int, visited map[reflect.Type]bool) []structField {
+	visited[structType] = true
+	defer delete(visited, structType)
+
+	fields := []structField{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag := field.Tag.Get("log")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		fieldIndex := append(append([]int{}, index...), i)
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			if !field.IsExported() && field.Type.Kind() == reflect.Pointer {
+				// pointers to unexported structs can not be dereferenced
+				continue
+			}
+			if !visited[fieldType] {
+				fields = append(fields, structFields(fieldType, fieldIndex, visited)...)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		rendered := structField{index: fieldIndex, name: name}
+		for _, option := range strings.Split(options, ",") {
+			switch option {
+			case "redact":
+				rendered.redact = true
+			case "omitempty":
+				rendered.omitEmpty = true
+			}
+		}
+		fields = append(fields, rendered)
+	}
+	return fields
+}
+
+// isEmptyValue reports if the value is empty like the omitempty option of encoding/json
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Interface, reflect.Pointer:
+		return value.IsZero()
+	}
+	return false
+}
+
+// addField adds the field to the object encoder using the method matching its kind
+func addField(encoder ObjectEncoder, field Field) error {
+	switch field.kind {
+	case stringKind:
+		encoder.AddString(field.Key, field.text)
+	case intKind:
+		encoder.AddInt64(field.Key, field.integer)
+	case boolKind:
+		encoder.AddBool(field.Key, field.integer == 1)
+	case floatKind, durationKind, timeKind:
+		encoder.AddAny(field.Key, field.Interface())
+	case objectKind:
+		return encoder.AddObject(field.Key, field.reference.(ObjectMarshaler))
+	case arrayKind:
+		return encoder.AddArray(field.Key, field.reference.(ArrayMarshaler))
+	default:
+		encoder.AddAny(field.Key, field.Interface())
+	}
+	return nil
+}
+
+// appendField appends the value of the field to the array encoder using the method matching its kind
+func appendField(encoder ArrayEncoder, field Field) error {
+	switch field.kind {
+	case stringKind:
+		encoder.AppendString(field.text)
+	case intKind:
+		encoder.AppendInt64(field.integer)
+	case boolKind:
+		encoder.AppendBool(field.integer == 1)
+	case objectKind:
+		return encoder.AppendObject(field.reference.(ObjectMarshaler))
+	case arrayKind:
+		return encoder.AppendArray(field.reference.(ArrayMarshaler))
+	default:
+		encoder.AppendAny(field.Interface())
+	}
+	return nil
+}
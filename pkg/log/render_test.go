@@ -0,0 +1,161 @@
+package log_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+type testVersion struct {
+	Major int
+	Minor int
+}
+
+func (version testVersion) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("v%d.%d", version.Major, version.Minor)), nil
+}
+
+type testMetadata struct {
+	Region string
+}
+
+type testDatabase struct {
+	Host     string
+	Port     int
+	Password string `log:",redact"`
+}
+
+type testConfig struct {
+	testMetadata
+	Name     string        `log:"name"`
+	Debug    bool          `log:"debug,omitempty"`
+	Timeout  time.Duration `log:"timeout"`
+	Token    string        `log:"-"`
+	Version  testVersion   `log:"version"`
+	Level    log.Level     `log:"level"`
+	Database *testDatabase `log:"db"`
+	Replicas []string      `log:"replicas,omitempty"`
+	Labels   map[string]int
+	internal string
+}
+
+var testConfigValue = testConfig{
+	testMetadata: testMetadata{Region: "eu"},
+	Name:         "api",
+	Timeout:      5 * time.Second,
+	Token:        "secret-token",
+	Version:      testVersion{Major: 1, Minor: 2},
+	Level:        log.InfoLevel,
+	Database:     &testDatabase{Host: "db.local", Port: 5432, Password: "hunter2"},
+	Labels:       map[string]int{"b": 2, "a": 1},
+	internal:     "hidden",
+}
+
+type testNode struct {
+	Name string
+	Next *testNode
+}
+
+func TestRenderJSON(t *testing.T) {
+	logger, output := prepareTestFieldLogger(prepareTestErrorJSONFormatter())
+
+	logger.WithFields(log.Any("config", testConfigValue)).Info("started")
+	assert.Equal(t, `{"config":{"Region":"eu","name":"api","timeout":"5s","version":"v1.2","level":"INFO",`+
+		`"db":{"Host":"db.local","Port":5432,"Password":"[REDACTED]"},"Labels":{"a":1,"b":2}},"level":"INFO","msg":"started"}`+"\n", output.String())
+}
+
+func TestRenderText(t *testing.T) {
+	logger, output := prepareTestRedactionLogger()
+	logger.SetRedactor(nil)
+
+	logger.WithFields(log.Any("config", &testConfigValue)).Info("started")
+	assert.Equal(t, `level=INFO msg=started config.Region=eu config.name=api config.timeout=5s config.version=v1.2 `+
+		`config.level=INFO config.db.Host=db.local config.db.Port=5432 config.db.Password=[REDACTED] config.Labels.a=1 config.Labels.b=2`+"\n", output.String())
+}
+
+func TestRenderMatchesJSON(t *testing.T) {
+	formatter := prepareTestJSONFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+
+	values := []interface{}{
+		testNode{Name: "first", Next: &testNode{Name: "second"}},
+		map[string][]int{"b": {1, 2}, "a": nil},
+		[]map[string]interface{}{{"float": 0.5, "nested": map[int]string{2: "two", 1: "one"}}},
+		[2]bool{true, false},
+		struct{ Empty struct{} }{},
+	}
+
+	for _, value := range values {
+		record := &log.Record{Level: log.InfoLevel, Message: "message", Fields: []log.Field{{Key: "value", Value: value}}}
+
+		expected := &strings.Builder{}
+		json.NewEncoder(expected).Encode(map[string]interface{}{"level": "INFO", "msg": "message", "value": value})
+		assert.Equal(t, expected.String(), formatter.FormatRecord(record))
+	}
+}
+
+func TestRenderLimits(t *testing.T) {
+	logger, output := prepareTestFieldLogger(prepareTestErrorJSONFormatter())
+	renderer := log.NewRenderer()
+	renderer.MaxDepth = 2
+	renderer.MaxLength = 2
+	logger.SetRenderer(renderer)
+
+	cycle := &testNode{Name: "first", Next: &testNode{Name: "second"}}
+	cycle.Next.Next = cycle
+
+	logger.WithFields(
+		log.Any("list", []int{1, 2, 3, 4}),
+		log.Any("map", map[string]int{"a": 1, "b": 2, "c": 3}),
+		log.Any("nested", [][][]int{{{1}}}),
+	).Info("limits")
+	logger.WithFields(log.Any("cycle", cycle)).Info("cycle")
+
+	assert.Equal(t, strings.Join([]string{
+		`{"level":"INFO","list":[1,2,"... 2 more"],"map":{"a":1,"b":2,"...":"1 more"},"msg":"limits","nested":[["[max depth]"]]}`,
+		`{"cycle":{"Name":"first","Next":{"Name":"second","Next":"[cycle]"}},"level":"INFO","msg":"cycle"}`,
+	}, "\n")+"\n", output.String())
+}
+
+func TestRenderDefaultLimits(t *testing.T) {
+	formatter := prepareTestLogfmtFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+
+	// records that are not written by a logger are rendered by the formatters with the default limits
+	cycle := &testNode{Name: "first"}
+	cycle.Next = cycle
+	record := &log.Record{Level: log.InfoLevel, Message: "cycle", Fields: []log.Field{{Key: "node", Value: cycle}}}
+	assert.Equal(t, "level=INFO msg=cycle node.Name=first node.Next=[cycle]\n", formatter.FormatRecord(record))
+}
+
+func TestRenderRedaction(t *testing.T) {
+	logger, output := prepareTestFieldLogger(prepareTestErrorJSONFormatter())
+	logger.SetRedactor(log.NewRedactor())
+
+	logger.WithFields(log.Any("user", map[string]interface{}{
+		"name":     "jane",
+		"contact":  "jane@example.com",
+		"password": "hunter2",
+		"db":       testDatabase{Host: "db.local", Password: "hunter2"},
+	})).Info("signup")
+	assert.Equal(t, `{"level":"INFO","msg":"signup","user":{"contact":"[REDACTED]","db":{"Host":"db.local","Port":0,"Password":"[REDACTED]"},`+
+		`"name":"jane","password":"[REDACTED]"}}`+"\n", output.String())
+}
+
+func TestRenderRecordOutputs(t *testing.T) {
+	logger := log.NewLogger()
+	output := &recordingOutput{}
+	logger.SetRecordOutputs(output)
+
+	logger.WithFields(log.Any("db", testDatabase{Host: "db.local", Port: 5432, Password: "hunter2"})).Info("connected")
+	output.Flush()
+
+	assert.Equal(t, map[string]interface{}{"Host": "db.local", "Port": int64(5432), "Password": "[REDACTED]"}, output.records[0].Fields[0].Interface())
+}
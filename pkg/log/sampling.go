@@ -0,0 +1,180 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// SamplingKey selects which records are counted together by a sampling policy
+type SamplingKey int
+
+const (
+	// SampleByCaller counts the records of every call site separately
+	SampleByCaller SamplingKey = iota
+	// SampleByMessage counts the records of every message template separately, which is the format string of
+	// formatted messages and the message itself otherwise
+	SampleByMessage
+)
+
+// SuppressedField is the key of the field holding the number of suppressed records in the reports of a Sampler
+const SuppressedField = "suppressed"
+
+// A SamplingPolicy limits the number of similar records that are written. The First records of every Interval are
+// written and afterwards only every Thereafter-th record, if First is set. If Rate is set, records are additionally
+// limited by a token bucket that is refilled with Rate tokens per second and holds up to Burst tokens.
+type SamplingPolicy struct {
+	Key        SamplingKey
+	First      int
+	Thereafter int
+	Interval   time.Duration
+	Rate       float64
+	Burst      int
+}
+
+// A Sampler drops similar records according to the policy of their level. The number of suppressed records is
+// written as a report like "suppressed 1234 similar messages from pkg.Func" every ReportInterval, measured by the
+// Clock of the sampler, and when the logger is closed.
+type Sampler struct {
+	Policies       map[Level]SamplingPolicy
+	ReportInterval time.Duration
+	Clock          clock.Clock
+
+	mutex  sync.Mutex
+	groups map[samplingGroup]*samplingState
+}
+
+// NewSampler initializes a new Sampler without policies, which have to be added for the sampled levels
+func NewSampler() *Sampler {
+	return &Sampler{
+		Policies:       map[Level]SamplingPolicy{},
+		ReportInterval: time.Minute,
+		Clock:          clock.New(),
+	}
+}
+
+// samplingGroup identifies records that are counted together, call sites are compared by value as inlined calls have
+// their own program counters
+type samplingGroup struct {
+	level     Level
+	byMessage bool
+	caller    Caller
+	template  string
+}
+
+// samplingState holds the counters of a sampling group
+type samplingState struct {
+	caller   *Caller
+	template string
+
+	count         int
+	intervalStart time.Time
+	tokens        float64
+	refilled      time.Time
+	suppressed    int
+	lastSeen      time.Time
+}
+
+// A samplingReport counts the suppressed records of a sampling group
+type samplingReport struct {
+	level      Level
+	caller     *Caller
+	message    string
+	suppressed int
+}
+
+// sample reports if the record of the level written by the caller is written
+func (s *Sampler) sample(level Level, policy SamplingPolicy, caller *Caller, template string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.Clock.Now()
+	group := samplingGroup{level: level, caller: *caller}
+	if policy.Key == SampleByMessage {
+		group = samplingGroup{level: level, byMessage: true, template: template}
+	}
+	if s.groups == nil {
+		s.groups = map[samplingGroup]*samplingState{}
+	}
+	state, ok := s.groups[group]
+	if !ok {
+		state = &samplingState{caller: caller, template: template, intervalStart: now, tokens: policy.burst(), refilled: now}
+		s.groups[group] = state
+	}
+	state.lastSeen = now
+
+	allowed := state.allow(policy, now)
+	if !allowed {
+		state.suppressed++
+	}
+	return allowed
+}
+
+// allow applies the policy to the next record of the group
+func (state *samplingState) allow(policy SamplingPolicy, now time.Time) bool {
+	if policy.First > 0 {
+		if policy.Interval > 0 && now.Sub(state.intervalStart) >= policy.Interval {
+			state.count, state.intervalStart = 0, now
+		}
+		state.count++
+		if state.count > policy.First && (policy.Thereafter <= 0 || (state.count-policy.First)%policy.Thereafter != 0) {
+			return false
+		}
+	}
+
+	if policy.Rate > 0 {
+		state.tokens += now.Sub(state.refilled).Seconds() * policy.Rate
+		if burst := policy.burst(); state.tokens > burst {
+			state.tokens = burst
+		}
+		state.refilled = now
+		if state.tokens < 1 {
+			return false
+		}
+		state.tokens--
+	}
+	return true
+}
+
+// burst returns the capacity of the token bucket, which holds at least one token
+func (policy SamplingPolicy) burst() float64 {
+	if policy.Burst < 1 {
+		return 1
+	}
+	return float64(policy.Burst)
+}
+
+// flush returns the reports of all groups with suppressed records ordered by level and message and resets their
+// counts, groups that were not seen for longer than a report interval are removed
+func (s *Sampler) flush() (reports []samplingReport) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.Clock.Now()
+	for group, state := range s.groups {
+		if state.suppressed > 0 {
+			report := samplingReport{level: group.level, caller: state.caller, suppressed: state.suppressed}
+			if group.byMessage {
+				report.message = fmt.Sprintf("suppressed %d similar messages like %q", state.suppressed, state.template)
+			} else {
+				report.message = fmt.Sprintf("suppressed %d similar messages from %s", state.suppressed,
+					appendFullFunctionName(nil, state.caller.Package, state.caller.QualifiedFunction()))
+			}
+			reports = append(reports, report)
+			state.suppressed = 0
+		} else if now.Sub(state.lastSeen) > s.ReportInterval {
+			delete(s.groups, group)
+		}
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].level != reports[j].level {
+			return reports[i].level < reports[j].level
+		}
+		return reports[i].message < reports[j].message
+	})
+	return reports
+}
@@ -0,0 +1,197 @@
+package log_test
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/timbasel/go-log/pkg/log"
+)
+
+func prepareTestSamplerFormatter() *log.LogfmtFormatter {
+	formatter := log.NewLogfmtFormatter()
+	formatter.TimestampDisabled = true
+	formatter.CallerDisabled = true
+	formatter.ColorsDisabled = true
+	return formatter
+}
+
+func prepareTestSampler(policies map[log.Level]log.SamplingPolicy) (*log.Logger, *strings.Builder, *clock.Mock) {
+	output := &strings.Builder{}
+	logger := log.NewLogger()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{output: prepareTestSamplerFormatter()})
+
+	mock := clock.NewMock()
+	sampler := log.NewSampler()
+	sampler.Policies = policies
+	sampler.Clock = mock
+	logger.SetSampler(sampler)
+	return logger, output, mock
+}
+
+func TestSamplerFirstThenEvery(t *testing.T) {
+	logger, output, mock := prepareTestSampler(map[log.Level]log.SamplingPolicy{
+		log.InfoLevel: {First: 2, Thereafter: 3, Interval: time.Second},
+	})
+
+	for i := 0; i < 10; i++ {
+		logger.Infof("first %d", i)
+	}
+	for i := 0; i < 3; i++ {
+		logger.Infof("second %d", i)
+	}
+	mock.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		logger.Infof("first %d", i)
+	}
+
+	// every call site is sampled separately and starts over in the next interval
+	assert.Equal(t, strings.Join([]string{
+		"level=INFO msg=\"first 0\"", "level=INFO msg=\"first 1\"", "level=INFO msg=\"first 4\"", "level=INFO msg=\"first 7\"",
+		"level=INFO msg=\"second 0\"", "level=INFO msg=\"second 1\"",
+		"level=INFO msg=\"first 0\"", "level=INFO msg=\"first 1\"",
+	}, "\n")+"\n", output.String())
+}
+
+func TestSamplerTokenBucket(t *testing.T) {
+	logger, output, mock := prepareTestSampler(map[log.Level]log.SamplingPolicy{
+		log.ErrorLevel: {Rate: 2, Burst: 3},
+	})
+
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			mock.Add(time.Second)
+		}
+		logger.Errorf("attempt %d", i)
+		logger.Info("not sampled")
+	}
+
+	assert.Equal(t, 10, strings.Count(output.String(), "not sampled"), "levels without policy must not be sampled")
+	assert.Equal(t, []string{"attempt 0", "attempt 1", "attempt 2", "attempt 5", "attempt 6"}, loggedMessages(output.String(), "ERROR"))
+}
+
+func TestSamplerByMessage(t *testing.T) {
+	logger, output, _ := prepareTestSampler(map[log.Level]log.SamplingPolicy{
+		log.InfoLevel: {Key: log.SampleByMessage, First: 1},
+	})
+
+	// records with the same template are sampled together independent of their call site and arguments
+	logger.Infof("user %s logged in", "alice")
+	logger.Infof("user %s logged in", "bob")
+	logger.WithFields(log.Int("attempt", 1)).Infof("user %s logged in", "carol")
+	logger.Infof("user %s logged out", "alice")
+	logger.Info("static message")
+	logger.Info("static message")
+
+	assert.Equal(t, []string{"user alice logged in", "user alice logged out", "static message"}, loggedMessages(output.String(), "INFO"))
+}
+
+func TestSamplerReports(t *testing.T) {
+	requireDebug(t)
+	logger, output, mock := prepareTestSampler(map[log.Level]log.SamplingPolicy{
+		log.InfoLevel:  {First: 1},
+		log.DebugLevel: {Key: log.SampleByMessage, First: 1},
+	})
+	logger.SetDebugMode(true)
+	mutex := &sync.Mutex{}
+	logger.ClearOutputs()
+	logger.SetFormattedOutputs(map[io.Writer]log.Formatter{lockedWriter{output, mutex}: prepareTestSamplerFormatter()})
+	written := func() string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return output.String()
+	}
+
+	process := func(i int) {
+		logger.Infof("processing item %d", i)
+		logger.Debugf("retrying %d", i)
+	}
+	for i := 0; i < 5; i++ {
+		process(i)
+	}
+	assert.NotContains(t, written(), "suppressed")
+
+	// reports are written every report interval, even if no further records are written
+	mock.Add(time.Minute)
+	for i := 0; i < 1000 && strings.Count(written(), "suppressed=") < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Contains(t, written(), "level=DEBUG msg=\"suppressed 4 similar messages like \\\"retrying %d\\\"\" suppressed=4\n"+
+		"level=INFO msg=\"suppressed 4 similar messages from log_test.TestSamplerReports.func2\" suppressed=4\n")
+
+	// reports of the remaining suppressed records are written when the logger is closed
+	mutex.Lock()
+	output.Reset()
+	mutex.Unlock()
+	process(5)
+	process(6)
+	assert.Equal(t, "", written())
+	assert.NoError(t, logger.Close())
+	assert.Equal(t, "level=DEBUG msg=\"suppressed 2 similar messages like \\\"retrying %d\\\"\" suppressed=2\n"+
+		"level=INFO msg=\"suppressed 2 similar messages from log_test.TestSamplerReports.func2\" suppressed=2\n", written())
+}
+
+func TestSamplerReportCaller(t *testing.T) {
+	output := &recordingOutput{}
+	logger := log.NewLogger()
+	logger.SetRecordOutputs(output)
+	sampler := log.NewSampler()
+	sampler.Policies[log.InfoLevel] = log.SamplingPolicy{First: 1}
+	sampler.Clock = clock.NewMock()
+	logger.SetSampler(sampler)
+
+	for i := 0; i < 3; i++ {
+		logger.Info("message")
+	}
+	logger.Close()
+	output.Flush()
+
+	// the report is attributed to the call site of the suppressed records
+	assert.Len(t, output.records, 2)
+	assert.Equal(t, output.records[0].Caller, output.records[1].Caller)
+	assert.Equal(t, "TestSamplerReportCaller", output.records[1].Function)
+	assert.Equal(t, int64(2), output.records[1].Fields[0].Interface())
+}
+
+func TestSamplerReportsConcurrentWrites(t *testing.T) {
+	logger, output, mock := prepareTestSampler(map[log.Level]log.SamplingPolicy{log.InfoLevel: {First: 1}})
+
+	// reports are written by the report loop while the application writes records and changes the outputs, which must
+	// neither race on the writer nor on the outputs of the logger
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			mock.Add(time.Minute)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		logger.Info("processing item")
+		logger.SetOutputs(&strings.Builder{})
+	}
+	<-done
+
+	assert.NoError(t, logger.Close())
+	assert.Contains(t, output.String(), "level=INFO msg=\"processing item\"\n")
+}
+
+// loggedMessages returns the messages of the logfmt lines of the level
+func loggedMessages(output string, level string) (messages []string) {
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if !strings.HasPrefix(line, "level="+level+" ") {
+			continue
+		}
+		message := strings.TrimPrefix(line, "level="+level+" msg=")
+		if strings.HasPrefix(message, "\"") {
+			message = message[1:strings.LastIndex(message, "\"")]
+		} else if space := strings.Index(message, " "); space >= 0 {
+			message = message[:space]
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
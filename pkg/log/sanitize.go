@@ -0,0 +1,60 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/acarl005/stripansi"
+)
+
+// SanitizeMode controls how formatters treat line breaks, control characters and ANSI escape sequences contained in
+// messages and field values, which could otherwise be used to forge log lines or manipulate the terminal
+type SanitizeMode int
+
+const (
+	// SanitizeOff writes messages and field values unchanged
+	SanitizeOff SanitizeMode = iota
+	// SanitizeEscape escapes line breaks and control characters, which leaves ANSI escape sequences visible but inert
+	SanitizeEscape
+	// SanitizeStrip removes ANSI escape sequences and escapes line breaks and other control characters
+	SanitizeStrip
+	// SanitizeMultiline removes ANSI escape sequences and escapes control characters, but keeps line breaks and
+	// indents the continuation lines under the header of the entry
+	SanitizeMultiline
+)
+
+// sanitize applies the mode to untrusted text, continuation lines of the multiline mode are prefixed with the indent
+func sanitize(text string, mode SanitizeMode, indent string) string {
+	if mode == SanitizeOff {
+		return text
+	}
+	if mode != SanitizeEscape {
+		text = stripansi.Strip(text)
+	}
+	if mode == SanitizeMultiline {
+		text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	}
+
+	builder := &strings.Builder{}
+	for _, r := range text {
+		switch {
+		case r == '\n' && mode == SanitizeMultiline:
+			builder.WriteString("\n")
+			builder.WriteString(indent)
+		case r == '\t':
+			builder.WriteRune(r)
+		case r == '\n':
+			builder.WriteString(`\n`)
+		case r == '\r':
+			builder.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(builder, `\x%02x`, r)
+		case unicode.Is(unicode.Cc, r) || unicode.Is(unicode.Bidi_Control, r) || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(builder, `\u%04x`, r)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}